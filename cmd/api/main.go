@@ -1,6 +1,10 @@
 package main
 
-import "reservista.kz/internal/app"
+import (
+	"reservista.kz/internal/app"
+	// restaurant timezones are loaded at runtime, the image has no zoneinfo
+	_ "time/tzdata"
+)
 
 const configsDir = "configs"
 const envDir = ".env"
@@ -4,16 +4,23 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/redis/go-redis/v9"
 	"net/http"
 	"os"
 	"os/signal"
+	"reservista.kz/internal/audit"
 	"reservista.kz/internal/config"
 	"reservista.kz/internal/delivery"
+	"reservista.kz/internal/policy"
+	"reservista.kz/internal/repository"
 	"reservista.kz/internal/server"
 	"reservista.kz/pkg/dialog"
+	"reservista.kz/pkg/hash"
 	"reservista.kz/pkg/logger"
 	auth "reservista.kz/pkg/manager"
+	"reservista.kz/pkg/oidc"
 	"reservista.kz/pkg/s3client"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -38,17 +45,110 @@ func Run(configPath, envPath string) {
 		logger.Error(err)
 		return
 	}
+	repos, closeStorage, err := newRepositories(cfg.Storage, cfg.Audit.MaxEntries)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	defer closeStorage()
+	idempotencyStore, closeIdempotencyStore, err := newIdempotencyStore(cfg.Idempotency)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	defer closeIdempotencyStore()
+	repos.Idempotency = idempotencyStore
+	reminderStore, closeReminderStore, err := newReminderStore(cfg.Reminders)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	defer closeReminderStore()
+	repos.Reminders = reminderStore
+	auditSinks, err := newAuditSinks(cfg.Audit)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	policyEngine, err := newPolicyEngine(cfg.Policy, repos.Staff)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	// validated by config.Init
+	reservationLocation, err := time.LoadLocation(cfg.Reservation.Timezone)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
 	handlers := delivery.NewHandler(
 		delivery.Handler{
-			CookieTTL:    cfg.Cookie.Ttl,
-			Environment:  cfg.Environment,
-			Dialog:       dial,
-			TokenManager: tokenManager,
-			HttpAddress:  cfg.HTTP.Host + ":" + cfg.HTTP.Port,
-			S3Client:     s3Client,
-			PageDefault:  cfg.Limiter.PageDefault,
-			LimitDefault: cfg.Limiter.ElementLimiterDefault,
+			Cookies:          newCookiePolicy(cfg.Cookie, cfg.JWT),
+			Environment:      cfg.Environment,
+			Dialog:           dial,
+			TokenManager:     tokenManager,
+			HttpAddress:      cfg.HTTP.Host + ":" + cfg.HTTP.Port,
+			PublicURL:        cfg.HTTP.PublicURL,
+			S3Client:         s3Client,
+			PageDefault:      cfg.Limiter.PageDefault,
+			LimitDefault:     cfg.Limiter.ElementLimiterDefault,
+			Repos:            repos,
+			OIDC:             newOIDCProviders(cfg.OIDC),
+			OIDCStateTTL:     cfg.OIDC.StateTTL,
+			SecretHasher:     hash.NewSHA256Hasher(cfg.APIKey.Salt),
+			Policy:           policyEngine,
+			InviteTTL:        cfg.Staff.InviteTTL,
+			Auditor:          audit.NewAuditor(repos.Audit, auditSinks...),
+			ImpersonationTTL: cfg.Impersonation.TTL,
+			Avatar: delivery.AvatarPolicy{
+				MaxBytes:  cfg.Avatar.MaxBytes,
+				MaxPixels: cfg.Avatar.MaxPixels,
+			},
+			Reservation: delivery.ReservationPolicy{
+				Location:     reservationLocation,
+				SlotInterval: cfg.Reservation.SlotInterval,
+				LeadTime:     cfg.Reservation.LeadTime,
+				MaxAdvance:   cfg.Reservation.MaxAdvance,
+				Duration:     cfg.Reservation.Duration,
+				Turnover:     cfg.Reservation.Turnover,
+			},
+			Idempotency: delivery.IdempotencyPolicy{
+				TTL:         cfg.Idempotency.TTL,
+				LockTimeout: cfg.Idempotency.LockTimeout,
+			},
+			Reminders: delivery.ReminderPolicy{
+				Offsets:     cfg.Reminders.Offsets,
+				Interval:    cfg.Reminders.Interval,
+				Lease:       cfg.Reminders.Lease,
+				MaxAttempts: cfg.Reminders.MaxAttempts,
+			},
+			Waitlist: delivery.WaitlistPolicy{
+				OfferTTL: cfg.Waitlist.OfferTTL,
+				Interval: cfg.Waitlist.Interval,
+			},
+			CORS: delivery.CORSPolicy{
+				AllowedOrigins: cfg.CORS.AllowedOrigins,
+				AllowedMethods: cfg.CORS.AllowedMethods,
+				AllowedHeaders: cfg.CORS.AllowedHeaders,
+				ExposedHeaders: cfg.CORS.ExposedHeaders,
+				MaxAge:         cfg.CORS.MaxAge,
+			},
+			Erasure: delivery.ErasurePolicy{
+				ConfirmTTL:  cfg.Erasure.ConfirmTTL,
+				MaxAttempts: cfg.Erasure.MaxAttempts,
+				GracePeriod: cfg.Erasure.GracePeriod,
+				Interval:    cfg.Erasure.Interval,
+			},
+			Suspension: delivery.SuspensionPolicy{
+				Interval: cfg.Suspension.Interval,
+			},
 		})
+	jobs, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go handlers.RunErasures(jobs)
+	go handlers.RunSuspensions(jobs)
+	go handlers.RunWaitlist(jobs)
+	go handlers.RunReminders(jobs)
 	// HTTP Server
 	httpServer := server.NewServer(cfg, handlers.Init())
 	go func() {
@@ -71,5 +171,173 @@ func Run(configPath, envPath string) {
 	if err := httpServer.Stop(ctx); err != nil {
 		logger.Errorf("failed to stop server: %v", err)
 	}
+	stopJobs()
+
+}
+
+// newOIDCProviders builds the social login providers. Providers without a client ID
+// in the environment are skipped, so the gateway can run with any subset of them.
+func newOIDCProviders(cfg config.OIDCConfig) map[string]oidc.Provider {
+	providers := make(map[string]oidc.Provider)
+	for name, p := range cfg.Providers {
+		if p.ClientID == "" {
+			logger.Infof("oidc provider %s is disabled: missing client id", name)
+			continue
+		}
+		providerCfg := oidc.Config{
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+			Scopes:       p.Scopes,
+		}
+		switch p.Type {
+		case "google":
+			providers[name] = oidc.NewGoogleProvider(providerCfg)
+		case "apple":
+			provider, err := oidc.NewAppleProvider(providerCfg, p.TeamID, p.KeyID, p.PrivateKey)
+			if err != nil {
+				logger.Errorf("oidc provider %s is disabled: %v", name, err)
+				continue
+			}
+			providers[name] = provider
+		default:
+			providers[name] = oidc.NewProvider(name, providerCfg)
+		}
+	}
+	return providers
+}
+
+// newPolicyEngine creates the authorization engine with the rules from the config.
+// The rules of the routes themselves are registered by the delivery layer and are
+// always enforced, policy.dryRun only makes the rules of the config dry-run ones.
+func newPolicyEngine(cfg config.PolicyConfig, staff policy.StaffLookup) (*policy.Engine, error) {
+	engine := policy.NewEngine(policy.Options{Staff: staff})
+	for _, r := range cfg.Rules {
+		method, path, found := strings.Cut(r.Route, " ")
+		if !found {
+			return nil, fmt.Errorf("policy rule route %q must be \"METHOD /path\"", r.Route)
+		}
+		var conditions []policy.Condition
+		if r.Activated {
+			conditions = append(conditions, policy.Activated())
+		}
+		if len(r.Roles) > 0 {
+			conditions = append(conditions, policy.AnyRole(r.Roles...))
+		}
+		if r.Scope != "" {
+			conditions = append(conditions, policy.Scope(r.Scope))
+		}
+		if r.Hours != nil {
+			loc, err := time.LoadLocation(r.Hours.Timezone)
+			if err != nil {
+				return nil, fmt.Errorf("policy rule %s: %w", r.Route, err)
+			}
+			hours, err := policy.Hours(r.Hours.From, r.Hours.To, loc)
+			if err != nil {
+				return nil, fmt.Errorf("policy rule %s: %w", r.Route, err)
+			}
+			conditions = append(conditions, hours)
+		}
+		if r.Ownership != nil {
+			conditions = append(conditions, engine.Ownership(r.Ownership.Resolver, r.Ownership.Param, r.Ownership.Roles...))
+		}
+		engine.Register(policy.Rule{
+			Method:             method,
+			Path:               strings.TrimSpace(path),
+			Conditions:         conditions,
+			DryRun:             r.DryRun || cfg.DryRun,
+			AllowImpersonation: r.AllowImpersonation,
+		})
+	}
+	return engine, nil
+}
 
+func newAuditSinks(cfg config.AuditConfig) ([]audit.Sink, error) {
+	var sinks []audit.Sink
+	for _, name := range cfg.Sinks {
+		switch name {
+		case "stdout":
+			sinks = append(sinks, audit.NewStdoutSink())
+		case "file":
+			sink, err := audit.NewFileSink(cfg.File)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open audit file: %w", err)
+			}
+			sinks = append(sinks, sink)
+		case "http":
+			sinks = append(sinks, audit.NewHTTPSink(cfg.CollectorURL, cfg.Timeout, cfg.MaxEntries))
+		default:
+			return nil, fmt.Errorf("unknown audit sink %q", name)
+		}
+	}
+	return sinks, nil
+}
+
+// newRepositories picks where the gateway keeps its own data, only the redis store
+// keeps it across restarts.
+func newRepositories(cfg config.StorageConfig, auditMaxEntries int) (*repository.Repositories, func(), error) {
+	if cfg.Store == "memory" {
+		return repository.NewRepositories(auditMaxEntries), func() {}, nil
+	}
+	client, closeClient, err := newRedisClient(cfg.Redis)
+	if err != nil {
+		return nil, nil, err
+	}
+	return repository.NewRedisRepositories(client, cfg.Redis.Prefix, auditMaxEntries), closeClient, nil
+}
+
+// newIdempotencyStore picks where idempotency keys are kept.
+func newIdempotencyStore(cfg config.IdempotencyConfig) (repository.Idempotency, func(), error) {
+	if cfg.Store == "memory" {
+		return repository.NewIdempotencyRepo(), func() {}, nil
+	}
+	client, closeClient, err := newRedisClient(cfg.Redis)
+	if err != nil {
+		return nil, nil, err
+	}
+	return repository.NewRedisIdempotencyRepo(client, cfg.Redis.Prefix), closeClient, nil
+}
+
+func newReminderStore(cfg config.RemindersConfig) (repository.Reminders, func(), error) {
+	if cfg.Store == "memory" {
+		return repository.NewRemindersRepo(), func() {}, nil
+	}
+	client, closeClient, err := newRedisClient(cfg.Redis)
+	if err != nil {
+		return nil, nil, err
+	}
+	return repository.NewRedisRemindersRepo(client, cfg.Redis.Prefix), closeClient, nil
+}
+
+// newRedisClient connects to the redis of cfg. The gateway refuses to start
+// without it rather than fail on the first request that needs it.
+func newRedisClient(cfg config.RedisConfig) (redis.UniversalClient, func(), error) {
+	client := redis.NewClient(&redis.Options{Addr: cfg.Addr, Password: cfg.Password, DB: cfg.DB})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("failed to connect to redis at %s: %w", cfg.Addr, err)
+	}
+	return client, func() { client.Close() }, nil
+}
+
+func newCookiePolicy(cfg config.CookieConfig, jwt config.JWTConfig) delivery.CookiePolicy {
+	sameSite := http.SameSiteLaxMode
+	switch cfg.SameSite {
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+	return delivery.CookiePolicy{
+		Domain:     cfg.Domain,
+		Path:       cfg.Path,
+		Secure:     cfg.Secure,
+		SameSite:   sameSite,
+		HostPrefix: cfg.HostPrefix,
+		AccessTTL:  jwt.AccessTokenTTL,
+		RefreshTTL: jwt.RefreshTokenTTL,
+	}
 }
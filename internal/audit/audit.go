@@ -0,0 +1,63 @@
+package audit
+
+import (
+	"context"
+	"reservista.kz/internal/domain"
+	"reservista.kz/pkg/logger"
+)
+
+// Sink receives every audit entry, e.g. to ship it to durable storage.
+type Sink interface {
+	Write(ctx context.Context, entry domain.AuditEntry) error
+}
+
+// Store keeps entries queryable by admins.
+type Store interface {
+	Create(ctx context.Context, entry domain.AuditEntry) error
+	Anonymize(ctx context.Context, userID, alias string) error
+}
+
+// Anonymizer is implemented by sinks that can rewrite what they have written.
+// Sinks that ship entries elsewhere, like stdout or a collector, can't take them
+// back; erasures have to be handled where they end up.
+type Anonymizer interface {
+	Anonymize(ctx context.Context, userID, alias string) error
+}
+
+type Auditor struct {
+	store Store
+	sinks []Sink
+}
+
+func NewAuditor(store Store, sinks ...Sink) *Auditor {
+	return &Auditor{store: store, sinks: sinks}
+}
+
+// Record saves the entry and hands it to every sink. Failures are logged and
+// never fail the audited request.
+func (a *Auditor) Record(ctx context.Context, entry domain.AuditEntry) {
+	if err := a.store.Create(ctx, entry); err != nil {
+		logger.Errorf("failed to store audit entry %s: %v", entry.ID, err)
+	}
+	for _, sink := range a.sinks {
+		if err := sink.Write(ctx, entry); err != nil {
+			logger.Errorf("failed to write audit entry %s: %v", entry.ID, err)
+		}
+	}
+}
+
+// Anonymize replaces the id of an erased user with alias in the store and in the
+// sinks that can rewrite their entries.
+func (a *Auditor) Anonymize(ctx context.Context, userID, alias string) error {
+	if err := a.store.Anonymize(ctx, userID, alias); err != nil {
+		return err
+	}
+	for _, sink := range a.sinks {
+		if anonymizer, ok := sink.(Anonymizer); ok {
+			if err := anonymizer.Anonymize(ctx, userID, alias); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
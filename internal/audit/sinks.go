@@ -0,0 +1,147 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reservista.kz/internal/domain"
+	"reservista.kz/pkg/logger"
+	"sync"
+	"time"
+)
+
+// JSONSink writes one JSON document per line, e.g. to stdout or a file. Only a
+// file can be anonymized.
+type JSONSink struct {
+	mu   sync.Mutex
+	w    io.Writer
+	path string
+}
+
+func NewStdoutSink() *JSONSink {
+	return &JSONSink{w: os.Stdout}
+}
+
+func NewFileSink(path string) (*JSONSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONSink{w: f, path: path}, nil
+}
+
+func (s *JSONSink) Write(_ context.Context, entry domain.AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// Anonymize rewrites the file with the entries of the user anonymized. Lines
+// that aren't audit entries are kept as they are.
+func (s *JSONSink) Anonymize(_ context.Context, userID, alias string) error {
+	if s.path == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	changed := false
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		var entry domain.AuditEntry
+		if len(bytes.TrimSpace(line)) == 0 || json.Unmarshal(line, &entry) != nil || !entry.Anonymize(userID, alias) {
+			out.Write(line)
+			continue
+		}
+		anonymized, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		out.Write(append(anonymized, '\n'))
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, out.Bytes(), 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	// the old file is gone, later entries go to the rewritten one
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if old, ok := s.w.(io.Closer); ok {
+		old.Close()
+	}
+	s.w = f
+	return nil
+}
+
+// HTTPSink posts entries to a collector in the background, so a slow collector
+// doesn't hold up requests. Entries are dropped when the buffer is full.
+type HTTPSink struct {
+	url     string
+	client  *http.Client
+	entries chan domain.AuditEntry
+}
+
+func NewHTTPSink(url string, timeout time.Duration, buffer int) *HTTPSink {
+	s := &HTTPSink{
+		url:     url,
+		client:  &http.Client{Timeout: timeout},
+		entries: make(chan domain.AuditEntry, buffer),
+	}
+	go s.run()
+	return s
+}
+
+func (s *HTTPSink) Write(_ context.Context, entry domain.AuditEntry) error {
+	select {
+	case s.entries <- entry:
+		return nil
+	default:
+		return fmt.Errorf("audit collector buffer is full")
+	}
+}
+
+func (s *HTTPSink) run() {
+	for entry := range s.entries {
+		if err := s.post(entry); err != nil {
+			logger.Errorf("failed to send audit entry %s to collector: %v", entry.ID, err)
+		}
+	}
+}
+
+func (s *HTTPSink) post(entry domain.AuditEntry) error {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("collector returned %d", resp.StatusCode)
+	}
+	return nil
+}
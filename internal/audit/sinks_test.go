@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reservista.kz/internal/domain"
+	"testing"
+)
+
+func TestFileSinkAnonymize(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []domain.AuditEntry{
+		{ID: "1", ActorID: "user-1", IP: "10.0.0.1", Targets: map[string]string{"user_id": "user-1"}},
+		{ID: "2", ActorID: "admin-1", IP: "10.0.0.2", Targets: map[string]string{"user_id": "user-1"}},
+		{ID: "3", ActorID: "user-2", IP: "10.0.0.3"},
+	}
+	for _, entry := range entries {
+		if err := sink.Write(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Anonymize(ctx, "user-1", "erased-1"); err != nil {
+		t.Fatalf("Anonymize: %v", err)
+	}
+	// entries written afterwards end up in the rewritten file
+	if err := sink.Write(ctx, domain.AuditEntry{ID: "4", ActorID: "user-2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []domain.AuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry domain.AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		got = append(got, entry)
+	}
+	if len(got) != 4 {
+		t.Fatalf("file has %d entries, want 4", len(got))
+	}
+	if got[0].ActorID != "erased-1" || got[0].IP != "" || got[0].Targets["user_id"] != "erased-1" {
+		t.Errorf("entry of the user = %+v, want the id replaced and no IP", got[0])
+	}
+	if got[1].ActorID != "admin-1" || got[1].IP != "10.0.0.2" || got[1].Targets["user_id"] != "erased-1" {
+		t.Errorf("entry about the user = %+v, want only the target replaced", got[1])
+	}
+	if got[2].ActorID != "user-2" || got[2].IP != "10.0.0.3" {
+		t.Errorf("entry of another user = %+v, want it unchanged", got[2])
+	}
+}
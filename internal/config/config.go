@@ -1,15 +1,20 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"github.com/joho/godotenv"
 	"github.com/spf13/viper"
 	"log"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 )
 
 const (
 	defaultHTTPPort               = "8000"
+	defaultHTTPPublicURL          = "http://localhost:8000"
 	defaultHTTPRWTimeout          = 10 * time.Second
 	defaultHTTPMaxHeaderMegabytes = 1
 	defaultAccessTokenTTL         = 15 * time.Minute
@@ -17,8 +22,41 @@ const (
 	defaultGRPCPort               = "443"
 	authority                     = "api-gateway"
 	EnvLocal                      = "local"
+	EnvDevelopment                = "dev"
+	EnvProduction                 = "prod"
 	defaultPage                   = "1"
 	defaultLimiter                = "10"
+	defaultOIDCStateTTL           = 10 * time.Minute
+	defaultInviteTTL              = 72 * time.Hour
+	defaultAuditMaxEntries        = 10000
+	defaultImpersonationTTL       = 30 * time.Minute
+	defaultCORSMaxAge             = 10 * time.Minute
+	defaultErasureConfirmTTL      = time.Hour
+	defaultErasureMaxAttempts     = 5
+	defaultErasureGracePeriod     = 30 * 24 * time.Hour
+	defaultErasureInterval        = time.Hour
+	defaultSuspensionInterval     = time.Minute
+	defaultAvatarMaxBytes         = 5 << 20
+	defaultAvatarMaxPixels        = 40_000_000
+	defaultTimezone               = "Asia/Almaty"
+	defaultReservationSlot        = 30 * time.Minute
+	defaultReservationLeadTime    = 15 * time.Minute
+	defaultReservationMaxAdvance  = 90 * 24 * time.Hour
+	defaultReservationDuration    = 2 * time.Hour
+	defaultReservationTurnover    = 15 * time.Minute
+	defaultIdempotencyStore       = "memory"
+	defaultIdempotencyTTL         = 24 * time.Hour
+	defaultIdempotencyLockTimeout = time.Minute
+	defaultIdempotencyRedisPrefix = "idempotency:"
+	defaultWaitlistOfferTTL       = 15 * time.Minute
+	defaultWaitlistInterval       = time.Minute
+	defaultRemindersStore         = "memory"
+	defaultRemindersInterval      = time.Minute
+	defaultRemindersLease         = 5 * time.Minute
+	defaultRemindersMaxAttempts   = 5
+	defaultRemindersRedisPrefix   = "reminders:"
+	defaultStorageStore           = "memory"
+	defaultStorageRedisPrefix     = "gateway:"
 )
 
 type (
@@ -33,8 +71,153 @@ type (
 		HTTP          HTTPConfig         `mapstructure:"http"`
 		JWT           JWTConfig          `mapstructure:"jwt"`
 		Cookie        CookieConfig       `mapstructure:"cookie"`
+		CORS          CORSConfig         `mapstructure:"cors"`
+		Erasure       ErasureConfig      `mapstructure:"erasure"`
+		Suspension    SuspensionConfig   `mapstructure:"suspension"`
+		Avatar        AvatarConfig       `mapstructure:"avatar"`
+		Reservation   ReservationConfig  `mapstructure:"reservation"`
+		Idempotency   IdempotencyConfig  `mapstructure:"idempotency"`
+		Waitlist      WaitlistConfig     `mapstructure:"waitlist"`
+		Reminders     RemindersConfig    `mapstructure:"reminders"`
+		Storage       StorageConfig      `mapstructure:"storage"`
 		AWS           AWSConfig          `mapstructure:"aws"`
 		Limiter       LimiterConfig      `mapstructure:"limiter"`
+		OIDC          OIDCConfig         `mapstructure:"oidc"`
+		APIKey        APIKeyConfig
+		Policy        PolicyConfig        `mapstructure:"policy"`
+		Staff         StaffConfig         `mapstructure:"staff"`
+		Audit         AuditConfig         `mapstructure:"audit"`
+		Impersonation ImpersonationConfig `mapstructure:"impersonation"`
+	}
+	AuditConfig struct {
+		// MaxEntries is how many recent entries are kept for the admin endpoint
+		MaxEntries int `mapstructure:"maxEntries"`
+		// Sinks are any of stdout, file and http
+		Sinks        []string      `mapstructure:"sinks"`
+		File         string        `mapstructure:"file"`
+		CollectorURL string        `mapstructure:"collectorURL"`
+		Timeout      time.Duration `mapstructure:"timeout"`
+	}
+	StaffConfig struct {
+		InviteTTL time.Duration `mapstructure:"inviteTTL"`
+	}
+	ErasureConfig struct {
+		// ConfirmTTL is how long the emailed confirmation code is valid
+		ConfirmTTL time.Duration `mapstructure:"confirmTTL"`
+		// MaxAttempts is how many codes may be tried before the request is cancelled
+		MaxAttempts int `mapstructure:"maxAttempts"`
+		// GracePeriod is how long a confirmed erasure can still be cancelled
+		GracePeriod time.Duration `mapstructure:"gracePeriod"`
+		Interval    time.Duration `mapstructure:"interval"`
+	}
+	SuspensionConfig struct {
+		// Interval is how often accounts of ended suspensions are activated again
+		Interval time.Duration `mapstructure:"interval"`
+	}
+	AvatarConfig struct {
+		MaxBytes  int64 `mapstructure:"maxBytes"`
+		MaxPixels int   `mapstructure:"maxPixels"`
+	}
+	ReservationConfig struct {
+		// Timezone is used for restaurants without one of their own
+		Timezone string `mapstructure:"timezone"`
+		// SlotInterval is the grid reservations start on, counted from midnight
+		SlotInterval time.Duration `mapstructure:"slotInterval"`
+		// LeadTime is how far ahead of now a reservation has to start at least
+		LeadTime   time.Duration `mapstructure:"leadTime"`
+		MaxAdvance time.Duration `mapstructure:"maxAdvance"`
+		// Duration is how long a reservation holds its table, Turnover is the time
+		// needed to get the table ready for the next one
+		Duration time.Duration `mapstructure:"duration"`
+		Turnover time.Duration `mapstructure:"turnover"`
+	}
+	IdempotencyConfig struct {
+		// Store is memory or redis
+		Store string `mapstructure:"store"`
+		// TTL is how long responses are replayed, LockTimeout how long a request
+		// in flight holds its key
+		TTL         time.Duration `mapstructure:"ttl"`
+		LockTimeout time.Duration `mapstructure:"lockTimeout"`
+		Redis       RedisConfig   `mapstructure:"redis"`
+	}
+	WaitlistConfig struct {
+		// OfferTTL is how long a freed table is held for the guest it is offered to
+		OfferTTL time.Duration `mapstructure:"offerTTL"`
+		Interval time.Duration `mapstructure:"interval"`
+	}
+	RemindersConfig struct {
+		// Store is memory or redis, only redis keeps the jobs across restarts
+		Store string `mapstructure:"store"`
+		// Offsets are how long before a reservation its reminders are sent
+		Offsets  []time.Duration `mapstructure:"offsets"`
+		Interval time.Duration   `mapstructure:"interval"`
+		// Lease is how long a reminder being sent is held before it is sent again
+		Lease       time.Duration `mapstructure:"lease"`
+		MaxAttempts int           `mapstructure:"maxAttempts"`
+		Redis       RedisConfig   `mapstructure:"redis"`
+	}
+	// StorageConfig is where the gateway keeps the data it owns itself, like linked
+	// identities. Store is memory or redis, only redis keeps it across restarts.
+	StorageConfig struct {
+		Store string      `mapstructure:"store"`
+		Redis RedisConfig `mapstructure:"redis"`
+	}
+	RedisConfig struct {
+		Addr   string `mapstructure:"addr"`
+		DB     int    `mapstructure:"db"`
+		Prefix string `mapstructure:"prefix"`
+		// Password is read from REDIS_PASSWORD
+		Password string
+	}
+	ImpersonationConfig struct {
+		TTL time.Duration `mapstructure:"ttl"`
+	}
+	PolicyConfig struct {
+		// DryRun only logs what the rules of the config would deny, the rules of
+		// the routes in code are always enforced
+		DryRun bool               `mapstructure:"dryRun"`
+		Rules  []PolicyRuleConfig `mapstructure:"rules"`
+	}
+	PolicyRuleConfig struct {
+		// Route is the method and the gin path, e.g. "DELETE /api/tables/delete/:id"
+		Route     string                 `mapstructure:"route"`
+		Roles     []string               `mapstructure:"roles"`
+		Activated bool                   `mapstructure:"activated"`
+		Scope     string                 `mapstructure:"scope"`
+		Ownership *PolicyOwnershipConfig `mapstructure:"ownership"`
+		Hours     *PolicyHoursConfig     `mapstructure:"hours"`
+		DryRun    bool                   `mapstructure:"dryRun"`
+		// AllowImpersonation lets impersonation sessions call the route
+		AllowImpersonation bool `mapstructure:"allowImpersonation"`
+	}
+	PolicyOwnershipConfig struct {
+		Resolver string   `mapstructure:"resolver"`
+		Param    string   `mapstructure:"param"`
+		Roles    []string `mapstructure:"roles"`
+	}
+	PolicyHoursConfig struct {
+		From     string `mapstructure:"from"`
+		To       string `mapstructure:"to"`
+		Timezone string `mapstructure:"timezone"`
+	}
+	APIKeyConfig struct {
+		Salt string
+	}
+	OIDCConfig struct {
+		StateTTL  time.Duration                 `mapstructure:"stateTTL"`
+		Providers map[string]OIDCProviderConfig `mapstructure:"providers"`
+	}
+	OIDCProviderConfig struct {
+		Type        string   `mapstructure:"type"`
+		Issuer      string   `mapstructure:"issuer"`
+		RedirectURL string   `mapstructure:"redirectURL"`
+		Scopes      []string `mapstructure:"scopes"`
+		// secrets are read from OIDC_<PROVIDER>_* environment variables
+		ClientID     string
+		ClientSecret string
+		TeamID       string
+		KeyID        string
+		PrivateKey   string
 	}
 	LimiterConfig struct {
 		ElementLimiterDefault string `mapstructure:"elementLimiter"`
@@ -46,8 +229,25 @@ type (
 		AccessKey  string `mapstructure:"accessKey"`
 		PrivateKey string `mapstructure:"privateKey"`
 	}
+	// CORSConfig lists the origins allowed to call the gateway from a browser, either
+	// exact or with a wildcard subdomain, e.g. "https://*.reservista.kz".
+	CORSConfig struct {
+		AllowedOrigins []string      `mapstructure:"allowedOrigins"`
+		AllowedMethods []string      `mapstructure:"allowedMethods"`
+		AllowedHeaders []string      `mapstructure:"allowedHeaders"`
+		ExposedHeaders []string      `mapstructure:"exposedHeaders"`
+		MaxAge         time.Duration `mapstructure:"maxAge"`
+	}
+	// CookieConfig is the policy of the cookies set by the gateway. Their lifetimes
+	// follow the access and refresh token TTLs of JWTConfig.
 	CookieConfig struct {
-		Ttl time.Duration `mapstructure:"ttl"`
+		Domain string `mapstructure:"domain"`
+		Path   string `mapstructure:"path"`
+		Secure bool   `mapstructure:"secure"`
+		// SameSite is one of lax, strict, none
+		SameSite string `mapstructure:"sameSite"`
+		// HostPrefix names the cookies __Host-<name>, it needs secure, path "/" and no domain
+		HostPrefix bool `mapstructure:"hostPrefix"`
 	}
 	GRPCConfig struct {
 		Host    string        `mapstructure:"host"`
@@ -69,6 +269,7 @@ type (
 		ReadTimeout        time.Duration `mapstructure:"readTimeout"`
 		WriteTimeout       time.Duration `mapstructure:"writeTimeout"`
 		MaxHeaderMegabytes int           `mapstructure:"maxHeaderBytes"`
+		PublicURL          string        `mapstructure:"publicURL"`
 	}
 )
 
@@ -86,6 +287,10 @@ func Init(configsDir, envDir string) (*Config, error) {
 
 	setFromEnv(&cfg)
 
+	if err := validate(&cfg); err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
 }
 
@@ -111,22 +316,206 @@ func unmarshal(cfg *Config) error {
 	if err := viper.UnmarshalKey("cookie", &cfg.Cookie); err != nil {
 		return err
 	}
+	if err := viper.UnmarshalKey("cors", &cfg.CORS); err != nil {
+		return err
+	}
+	if err := viper.UnmarshalKey("erasure", &cfg.Erasure); err != nil {
+		return err
+	}
+	if err := viper.UnmarshalKey("suspension", &cfg.Suspension); err != nil {
+		return err
+	}
+	if err := viper.UnmarshalKey("avatar", &cfg.Avatar); err != nil {
+		return err
+	}
+	if err := viper.UnmarshalKey("reservation", &cfg.Reservation); err != nil {
+		return err
+	}
+	if err := viper.UnmarshalKey("idempotency", &cfg.Idempotency); err != nil {
+		return err
+	}
+	if err := viper.UnmarshalKey("waitlist", &cfg.Waitlist); err != nil {
+		return err
+	}
+	if err := viper.UnmarshalKey("reminders", &cfg.Reminders); err != nil {
+		return err
+	}
+	if err := viper.UnmarshalKey("storage", &cfg.Storage); err != nil {
+		return err
+	}
 	if err := viper.UnmarshalKey("limiter", &cfg.Limiter); err != nil {
 		return err
 	}
+	if err := viper.UnmarshalKey("oidc", &cfg.OIDC); err != nil {
+		return err
+	}
+	if err := viper.UnmarshalKey("policy", &cfg.Policy); err != nil {
+		return err
+	}
+	if err := viper.UnmarshalKey("staff", &cfg.Staff); err != nil {
+		return err
+	}
+	if err := viper.UnmarshalKey("audit", &cfg.Audit); err != nil {
+		return err
+	}
+	if err := viper.UnmarshalKey("impersonation", &cfg.Impersonation); err != nil {
+		return err
+	}
 	return viper.UnmarshalKey("grpc", &cfg.GRPC)
 }
 
 func setFromEnv(cfg *Config) {
 	cfg.HTTP.Host = os.Getenv("HTTP_HOST")
 	cfg.GRPC.Host = os.Getenv("GRPC_HOST")
-	cfg.Environment = EnvLocal
+	cfg.Environment = os.Getenv("APP_ENV")
+	if cfg.Environment == "" {
+		cfg.Environment = EnvLocal
+	}
 	cfg.Authority = authority
 	cfg.JWT.SigningKey = os.Getenv("JWT_SIGNING_KEY")
 	cfg.AWS.Bucket = os.Getenv("AWS_BUCKET")
 	cfg.AWS.Region = os.Getenv("AWS_REGION")
 	cfg.AWS.AccessKey = os.Getenv("AWS_ACCESS_KEY")
 	cfg.AWS.PrivateKey = os.Getenv("AWS_SECRET_KEY")
+	cfg.APIKey.Salt = os.Getenv("API_KEY_SALT")
+	cfg.Idempotency.Redis.Password = os.Getenv("REDIS_PASSWORD")
+	cfg.Reminders.Redis.Password = os.Getenv("REDIS_PASSWORD")
+	cfg.Storage.Redis.Password = os.Getenv("REDIS_PASSWORD")
+	for name, provider := range cfg.OIDC.Providers {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider.ClientID = os.Getenv(prefix + "CLIENT_ID")
+		provider.ClientSecret = os.Getenv(prefix + "CLIENT_SECRET")
+		provider.TeamID = os.Getenv(prefix + "TEAM_ID")
+		provider.KeyID = os.Getenv(prefix + "KEY_ID")
+		provider.PrivateKey = os.Getenv(prefix + "PRIVATE_KEY")
+		cfg.OIDC.Providers[name] = provider
+	}
+}
+
+// validate rejects settings that are unsafe, and in production also those that
+// are merely insecure.
+func validate(cfg *Config) error {
+	switch cfg.Environment {
+	case EnvLocal, EnvDevelopment, EnvProduction:
+	default:
+		return fmt.Errorf("unknown environment %q, expected %s, %s or %s", cfg.Environment, EnvLocal, EnvDevelopment, EnvProduction)
+	}
+
+	publicURL, err := url.Parse(cfg.HTTP.PublicURL)
+	if err != nil || (publicURL.Scheme != "http" && publicURL.Scheme != "https") || publicURL.Host == "" {
+		return fmt.Errorf("http.publicURL %q must be an absolute http or https URL", cfg.HTTP.PublicURL)
+	}
+
+	cookie := cfg.Cookie
+	switch cookie.SameSite {
+	case "lax", "strict":
+	case "none":
+		if !cookie.Secure {
+			return errors.New("cookie.sameSite none requires cookie.secure")
+		}
+	default:
+		return fmt.Errorf("unknown cookie.sameSite %q, expected lax, strict or none", cookie.SameSite)
+	}
+	if cookie.HostPrefix && (!cookie.Secure || cookie.Path != "/" || cookie.Domain != "") {
+		return errors.New("cookie.hostPrefix requires cookie.secure, path \"/\" and no domain")
+	}
+
+	for _, origin := range cfg.CORS.AllowedOrigins {
+		if origin == "*" {
+			return errors.New("cors.allowedOrigins can't be \"*\", the gateway allows credentials")
+		}
+	}
+
+	if cfg.Erasure.MaxAttempts < 1 || cfg.Erasure.Interval <= 0 {
+		return errors.New("erasure.maxAttempts and erasure.interval must be positive")
+	}
+	if cfg.Suspension.Interval <= 0 {
+		return errors.New("suspension.interval must be positive")
+	}
+
+	if _, err := time.LoadLocation(cfg.Reservation.Timezone); err != nil {
+		return fmt.Errorf("invalid reservation.timezone: %w", err)
+	}
+	if cfg.Reservation.SlotInterval <= 0 || cfg.Reservation.SlotInterval > 24*time.Hour {
+		return errors.New("reservation.slotInterval must be between 0 and 24h")
+	}
+	if cfg.Reservation.Duration <= 0 {
+		return errors.New("reservation.duration must be positive")
+	}
+
+	switch cfg.Idempotency.Store {
+	case "memory":
+	case "redis":
+		if cfg.Idempotency.Redis.Addr == "" {
+			return errors.New("idempotency.redis.addr must be set for the redis store")
+		}
+	default:
+		return fmt.Errorf("unknown idempotency.store %q, expected memory or redis", cfg.Idempotency.Store)
+	}
+	if cfg.Idempotency.TTL <= 0 || cfg.Idempotency.LockTimeout <= 0 {
+		return errors.New("idempotency.ttl and idempotency.lockTimeout must be positive")
+	}
+	if cfg.Waitlist.OfferTTL <= 0 || cfg.Waitlist.Interval <= 0 {
+		return errors.New("waitlist.offerTTL and waitlist.interval must be positive")
+	}
+	switch cfg.Reminders.Store {
+	case "memory":
+	case "redis":
+		if cfg.Reminders.Redis.Addr == "" {
+			return errors.New("reminders.redis.addr must be set for the redis store")
+		}
+	default:
+		return fmt.Errorf("unknown reminders.store %q, expected memory or redis", cfg.Reminders.Store)
+	}
+	for _, offset := range cfg.Reminders.Offsets {
+		if offset <= 0 {
+			return errors.New("reminders.offsets must be positive")
+		}
+	}
+	if cfg.Reminders.Interval <= 0 || cfg.Reminders.Lease <= 0 || cfg.Reminders.MaxAttempts < 1 {
+		return errors.New("reminders.interval, reminders.lease and reminders.maxAttempts must be positive")
+	}
+
+	// without a salt the stored hashes of API keys are plain SHA-256 of the secret
+	if cfg.APIKey.Salt == "" {
+		return errors.New("API_KEY_SALT must be set")
+	}
+
+	switch cfg.Storage.Store {
+	case "memory":
+	case "redis":
+		if cfg.Storage.Redis.Addr == "" {
+			return errors.New("storage.redis.addr must be set for the redis store")
+		}
+	default:
+		return fmt.Errorf("unknown storage.store %q, expected memory or redis", cfg.Storage.Store)
+	}
+
+	if cfg.Environment != EnvProduction {
+		return nil
+	}
+	if !cookie.Secure {
+		return errors.New("cookie.secure must be enabled in production")
+	}
+	if cookie.SameSite == "none" {
+		return errors.New("cookie.sameSite none is not allowed in production")
+	}
+	if cfg.JWT.SigningKey == "" {
+		return errors.New("JWT_SIGNING_KEY must be set in production")
+	}
+	if publicURL.Scheme != "https" {
+		return errors.New("http.publicURL must be https in production")
+	}
+	if cfg.Policy.DryRun {
+		return errors.New("policy.dryRun is not allowed in production, set dryRun on single rules instead")
+	}
+	if cfg.Storage.Store != "redis" {
+		return errors.New("storage.store must be redis in production, the memory store loses linked identities on restart")
+	}
+	if cfg.Reminders.Store != "redis" {
+		return errors.New("reminders.store must be redis in production, the memory store loses scheduled reminders on restart")
+	}
+	return nil
 }
 
 func parseConfigFile(folder string) error {
@@ -151,12 +540,48 @@ func loadEnvVariables(envPath string) {
 
 func populateDefaults() {
 	viper.SetDefault("http.port", defaultHTTPPort)
+	viper.SetDefault("http.publicURL", defaultHTTPPublicURL)
 	viper.SetDefault("grpc.port", defaultGRPCPort)
 	viper.SetDefault("http.max_header_megabytes", defaultHTTPMaxHeaderMegabytes)
 	viper.SetDefault("http.timeouts.read", defaultHTTPRWTimeout)
 	viper.SetDefault("http.timeouts.write", defaultHTTPRWTimeout)
-	viper.SetDefault("jwt.accessTokenTTL", defaultAccessTokenTTL)
-	viper.SetDefault("jwt.refreshTokenTTL", defaultRefreshTokenTTL)
+	viper.SetDefault("auth.accessTokenTTL", defaultAccessTokenTTL)
+	viper.SetDefault("auth.refreshTokenTTL", defaultRefreshTokenTTL)
+	viper.SetDefault("cookie.path", "/")
+	viper.SetDefault("cookie.sameSite", "lax")
+	viper.SetDefault("cors.allowedMethods", []string{"GET", "POST", "PUT", "PATCH", "DELETE"})
+	viper.SetDefault("cors.maxAge", defaultCORSMaxAge)
+	viper.SetDefault("erasure.confirmTTL", defaultErasureConfirmTTL)
+	viper.SetDefault("erasure.maxAttempts", defaultErasureMaxAttempts)
+	viper.SetDefault("erasure.gracePeriod", defaultErasureGracePeriod)
+	viper.SetDefault("erasure.interval", defaultErasureInterval)
+	viper.SetDefault("suspension.interval", defaultSuspensionInterval)
+	viper.SetDefault("avatar.maxBytes", defaultAvatarMaxBytes)
+	viper.SetDefault("avatar.maxPixels", defaultAvatarMaxPixels)
+	viper.SetDefault("reservation.timezone", defaultTimezone)
+	viper.SetDefault("reservation.slotInterval", defaultReservationSlot)
+	viper.SetDefault("reservation.leadTime", defaultReservationLeadTime)
+	viper.SetDefault("reservation.maxAdvance", defaultReservationMaxAdvance)
+	viper.SetDefault("reservation.duration", defaultReservationDuration)
+	viper.SetDefault("reservation.turnover", defaultReservationTurnover)
+	viper.SetDefault("idempotency.store", defaultIdempotencyStore)
+	viper.SetDefault("idempotency.ttl", defaultIdempotencyTTL)
+	viper.SetDefault("idempotency.lockTimeout", defaultIdempotencyLockTimeout)
+	viper.SetDefault("idempotency.redis.prefix", defaultIdempotencyRedisPrefix)
+	viper.SetDefault("waitlist.offerTTL", defaultWaitlistOfferTTL)
+	viper.SetDefault("waitlist.interval", defaultWaitlistInterval)
+	viper.SetDefault("reminders.store", defaultRemindersStore)
+	viper.SetDefault("reminders.interval", defaultRemindersInterval)
+	viper.SetDefault("reminders.lease", defaultRemindersLease)
+	viper.SetDefault("reminders.maxAttempts", defaultRemindersMaxAttempts)
+	viper.SetDefault("reminders.redis.prefix", defaultRemindersRedisPrefix)
+	viper.SetDefault("storage.store", defaultStorageStore)
+	viper.SetDefault("storage.redis.prefix", defaultStorageRedisPrefix)
 	viper.SetDefault("limiter.page", defaultPage)
 	viper.SetDefault("limiter.elementLimiter", defaultLimiter)
+	viper.SetDefault("oidc.stateTTL", defaultOIDCStateTTL)
+	viper.SetDefault("staff.inviteTTL", defaultInviteTTL)
+	viper.SetDefault("audit.maxEntries", defaultAuditMaxEntries)
+	viper.SetDefault("audit.timeout", defaultHTTPRWTimeout)
+	viper.SetDefault("impersonation.ttl", defaultImpersonationTTL)
 }
@@ -0,0 +1,188 @@
+package delivery
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"reservista.kz/internal/domain"
+	"strings"
+	"time"
+)
+
+const apiKeyPrefix = "rsv"
+
+func (h *Handler) apiKey(api *gin.RouterGroup) {
+	keys := api.Group("/api-keys", h.userIdentity, h.authorize, h.idempotency)
+	{
+		keys.POST("/create", h.createAPIKey)
+		keys.GET("/all/restaurant/:id", h.getAPIKeysByRestaurantId)
+		keys.POST("/rotate/:id", h.rotateAPIKey)
+		keys.DELETE("/revoke/:id", h.revokeAPIKey)
+	}
+}
+
+func (h *Handler) createAPIKey(c *gin.Context) {
+	var input apiKeyInput
+	if err := c.BindJSON(&input); err != nil {
+		newResponse(c, http.StatusBadRequest, "invalid input body: "+err.Error())
+		return
+	}
+	if !h.authorizeRestaurant(c, input.RestaurantID, domain.RestaurantAdminRole) {
+		return
+	}
+	userID, exists := c.Get(idCtx)
+	if !exists {
+		newResponse(c, http.StatusUnauthorized, "missing id in context")
+		return
+	}
+
+	id := primitive.NewObjectID().Hex()
+	secret, hashed, err := h.newAPIKeySecret()
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to generate api key: "+err.Error())
+		return
+	}
+	key := domain.APIKey{
+		ID:           id,
+		RestaurantID: input.RestaurantID,
+		Name:         input.Name,
+		Hash:         hashed,
+		Scopes:       input.Scopes,
+		CreatedBy:    userID.(string),
+		CreatedAt:    time.Now(),
+	}
+	if err := h.Repos.APIKeys.Create(c.Request.Context(), key); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to save api key: "+err.Error())
+		return
+	}
+	h.audit(c, "apikey.create", map[string]string{"restaurant_id": key.RestaurantID, "api_key_id": key.ID})
+	h.auditChange(c, nil, map[string]interface{}{"scopes": key.Scopes})
+	c.JSON(http.StatusCreated, apiKeyResponse{Key: formatAPIKey(id, secret), APIKey: key})
+}
+
+func (h *Handler) getAPIKeysByRestaurantId(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		newResponse(c, http.StatusBadRequest, "missing ID in the URL")
+		return
+	}
+	keys, err := h.Repos.APIKeys.GetByRestaurant(c.Request.Context(), id)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get api keys: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+// rotateAPIKey replaces the secret of the key, keeping its id and scopes.
+// The previous secret stops working immediately.
+func (h *Handler) rotateAPIKey(c *gin.Context) {
+	key, ok := h.activeAPIKeyFromParam(c)
+	if !ok {
+		return
+	}
+	secret, hashed, err := h.newAPIKeySecret()
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to generate api key: "+err.Error())
+		return
+	}
+	now := time.Now()
+	key.Hash = hashed
+	key.RotatedAt = &now
+	if err := h.Repos.APIKeys.Update(c.Request.Context(), key); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to update api key: "+err.Error())
+		return
+	}
+	h.audit(c, "apikey.rotate", map[string]string{"restaurant_id": key.RestaurantID})
+	c.JSON(http.StatusOK, apiKeyResponse{Key: formatAPIKey(key.ID, secret), APIKey: key})
+}
+
+func (h *Handler) revokeAPIKey(c *gin.Context) {
+	key, ok := h.activeAPIKeyFromParam(c)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	key.RevokedAt = &now
+	if err := h.Repos.APIKeys.Update(c.Request.Context(), key); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to update api key: "+err.Error())
+		return
+	}
+	h.audit(c, "apikey.revoke", map[string]string{"restaurant_id": key.RestaurantID})
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func (h *Handler) activeAPIKeyFromParam(c *gin.Context) (domain.APIKey, bool) {
+	id := c.Param("id")
+	if id == "" {
+		newResponse(c, http.StatusBadRequest, "missing ID in the URL")
+		return domain.APIKey{}, false
+	}
+	key, err := h.Repos.APIKeys.GetByID(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			newResponse(c, http.StatusNotFound, "api key not found")
+			return domain.APIKey{}, false
+		}
+		newResponse(c, http.StatusInternalServerError, "failed to get api key: "+err.Error())
+		return domain.APIKey{}, false
+	}
+	if !h.authorizeRestaurant(c, key.RestaurantID, domain.RestaurantAdminRole) {
+		return domain.APIKey{}, false
+	}
+	if key.RevokedAt != nil {
+		newResponse(c, http.StatusBadRequest, "api key is already revoked")
+		return domain.APIKey{}, false
+	}
+	return key, true
+}
+
+func (h *Handler) newAPIKeySecret() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret := hex.EncodeToString(b)
+	hashed, err := h.SecretHasher.Hash(secret)
+	if err != nil {
+		return "", "", err
+	}
+	return secret, hashed, nil
+}
+
+// authenticateAPIKey resolves a raw "rsv_<id>_<secret>" key to an active key.
+func (h *Handler) authenticateAPIKey(ctx context.Context, raw string) (domain.APIKey, error) {
+	parts := strings.Split(raw, "_")
+	if len(parts) != 3 || parts[0] != apiKeyPrefix {
+		return domain.APIKey{}, domain.ErrAPIKeyInvalid
+	}
+	key, err := h.Repos.APIKeys.GetByID(ctx, parts[1])
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return domain.APIKey{}, domain.ErrAPIKeyInvalid
+		}
+		return domain.APIKey{}, err
+	}
+	hashed, err := h.SecretHasher.Hash(parts[2])
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+	if key.RevokedAt != nil || subtle.ConstantTimeCompare([]byte(hashed), []byte(key.Hash)) != 1 {
+		return domain.APIKey{}, domain.ErrAPIKeyInvalid
+	}
+	now := time.Now()
+	key.LastUsedAt = &now
+	if err := h.Repos.APIKeys.MarkUsed(ctx, key.ID, now); err != nil {
+		return domain.APIKey{}, err
+	}
+	return key, nil
+}
+
+func formatAPIKey(id, secret string) string {
+	return apiKeyPrefix + "_" + id + "_" + secret
+}
@@ -0,0 +1,170 @@
+package delivery
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"reservista.kz/internal/domain"
+	"reservista.kz/internal/policy"
+	"time"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+
+	requestIDCtx = "requestID"
+	auditCtx     = "auditRecord"
+	erasureCtx   = "erasure"
+	errorCtx     = "errorMessage"
+)
+
+// auditRecord is what handlers add to the audit entry of their request.
+type auditRecord struct {
+	action  string
+	targets map[string]string
+	before  map[string]interface{}
+	after   map[string]interface{}
+}
+
+// requestID makes sure every request carries an id that shows up in the
+// response, the logs and the audit trail.
+func (h *Handler) requestID(c *gin.Context) {
+	id := c.GetHeader(requestIDHeader)
+	if id == "" || len(id) > 64 {
+		id = primitive.NewObjectID().Hex()
+	}
+	c.Set(requestIDCtx, id)
+	c.Header(requestIDHeader, id)
+	c.Next()
+}
+
+// auditTrail records every mutating request once it has been handled, along with
+// read requests whose handler called audit or that a policy rule denied, even in
+// dry-run.
+func (h *Handler) auditTrail(c *gin.Context) {
+	c.Next()
+
+	_, recorded := c.Get(auditCtx)
+	var decision *policy.Decision
+	if value, exists := c.Get(policyDecisionCtx); exists {
+		d := value.(policy.Decision)
+		decision = &d
+	}
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		if !recorded && (decision == nil || (decision.Allowed() && len(decision.DryRunDenials) == 0)) {
+			return
+		}
+	}
+	if c.FullPath() == "" {
+		// no route matched
+		return
+	}
+
+	entry := domain.AuditEntry{
+		ID:      primitive.NewObjectID().Hex(),
+		Time:    time.Now(),
+		IP:      c.ClientIP(),
+		Method:  c.Request.Method,
+		Route:   c.FullPath(),
+		Status:  c.Writer.Status(),
+		Targets: make(map[string]string),
+	}
+	entry.RequestID = c.GetString(requestIDCtx)
+	entry.ActorID = c.GetString(idCtx)
+	entry.ImpersonatorID = c.GetString(impersonatorCtx)
+	entry.Roles = c.GetStringSlice(roleCtx)
+	entry.Reason = c.GetString(errorCtx)
+	for _, p := range c.Params {
+		entry.Targets[p.Key] = p.Value
+	}
+	if value, exists := c.Get(auditCtx); exists {
+		record := value.(*auditRecord)
+		entry.Action = record.action
+		entry.Before = record.before
+		entry.After = record.after
+		for key, id := range record.targets {
+			entry.Targets[key] = id
+		}
+	}
+	if value, exists := c.Get(erasureCtx); exists {
+		erasure := value.(domain.ErasureRequest)
+		entry.Anonymize(erasure.UserID, erasure.Alias())
+	}
+	if decision != nil {
+		for _, violation := range decision.DryRunDenials {
+			entry.PolicyDryRunDenials = append(entry.PolicyDryRunDenials, violation.Reason)
+		}
+	}
+	switch {
+	case entry.Status < http.StatusBadRequest:
+		entry.Outcome = domain.AuditOutcomeSuccess
+	case entry.Status == http.StatusUnauthorized || entry.Status == http.StatusForbidden:
+		entry.Outcome = domain.AuditOutcomeDenied
+	default:
+		entry.Outcome = domain.AuditOutcomeFailure
+	}
+
+	h.Auditor.Record(c.Request.Context(), entry)
+}
+
+func (h *Handler) auditRecord(c *gin.Context) *auditRecord {
+	if value, exists := c.Get(auditCtx); exists {
+		return value.(*auditRecord)
+	}
+	record := &auditRecord{targets: make(map[string]string)}
+	c.Set(auditCtx, record)
+	return record
+}
+
+// audit names the action of the request and the ids it touched for the audit trail.
+func (h *Handler) audit(c *gin.Context, action string, targets map[string]string) {
+	record := h.auditRecord(c)
+	record.action = action
+	for key, id := range targets {
+		record.targets[key] = id
+	}
+}
+
+// auditChange adds a before/after summary to the audit entry of the request.
+func (h *Handler) auditChange(c *gin.Context, before, after map[string]interface{}) {
+	record := h.auditRecord(c)
+	record.before = before
+	record.after = after
+}
+
+func (h *Handler) getAuditLog(c *gin.Context) {
+	limit, offset, ok := h.pagination(c)
+	if !ok {
+		return
+	}
+	var err error
+	filter := domain.AuditFilter{
+		ActorID:  c.Query("actor"),
+		Action:   c.Query("action"),
+		Route:    c.Query("route"),
+		TargetID: c.Query("target"),
+		Outcome:  c.Query("outcome"),
+		Limit:    limit,
+		Offset:   offset,
+	}
+	if from := c.Query("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			newResponse(c, http.StatusBadRequest, "invalid from parameter, expected RFC 3339")
+			return
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			newResponse(c, http.StatusBadRequest, "invalid to parameter, expected RFC 3339")
+			return
+		}
+	}
+
+	entries, err := h.Repos.Audit.Find(c.Request.Context(), filter)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to query audit log: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
@@ -16,12 +16,17 @@ func (h *Handler) auth(api *gin.RouterGroup) {
 	{
 		users.POST("/sign-up", h.userSignUp)
 		users.POST("/sign-in", h.userSignIn)
+		users.GET("/oidc/:provider/login", h.oidcLogin)
+		users.GET("/oidc/:provider/callback", h.oidcCallback)
+		users.POST("/oidc/:provider/callback", h.oidcCallback)
+		users.GET("/csrf", h.getCSRFToken)
 		authenticated := users.Use(h.userIdentity)
 		{
 			authenticated.POST("/activate", h.userActivation)
 			authenticated.GET("/new-activation-code", h.sendNewVerificationCode)
 			authenticated.GET("/healthcheck", h.healthcheck)
 			authenticated.POST("/sign-out", h.signOut)
+			authenticated.GET("/oidc/:provider/link", h.oidcLink)
 		}
 	}
 }
@@ -67,6 +72,9 @@ func (h *Handler) userSignUp(c *gin.Context) {
 		AccessToken:  resp.Tokens.Jwt,
 		RefreshToken: resp.Tokens.Rt,
 	})
+	if claims, err := h.TokenManager.ParseClaims(resp.Tokens.Jwt); err == nil {
+		h.recordUser(c.Request.Context(), claims.UserID)
+	}
 	err = h.sendVerificationCodeMail(c.Request.Context(), inp.Email, resp.GetActivationToken())
 	if err != nil {
 		st, ok := status.FromError(err)
@@ -162,6 +170,8 @@ func (h *Handler) userActivation(c *gin.Context) {
 		newResponse(c, http.StatusInternalServerError, "unknown error when activate user:"+err.Error())
 		return
 	}
+	user.Activated = true
+	h.recordProfile(c.Request.Context(), id.(string), user)
 	conn, err = h.Dialog.NewConnection(h.Dialog.Addresses.Notifications)
 	if err != nil {
 		newResponse(c, http.StatusInternalServerError, "something went wrong...")
@@ -293,6 +303,15 @@ func (h *Handler) userSignIn(c *gin.Context) {
 		}
 		return
 	}
+	claims, err := h.TokenManager.ParseClaims(tokens.Jwt)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to parse jwt to id: "+err.Error())
+		return
+	}
+	if !h.checkSuspension(c, claims.UserID) {
+		return
+	}
+	h.recordUser(c.Request.Context(), claims.UserID)
 
 	h.setCookies(c, tokenResponse{
 		AccessToken:  tokens.Jwt,
@@ -302,14 +321,14 @@ func (h *Handler) userSignIn(c *gin.Context) {
 }
 
 func (h *Handler) signOut(c *gin.Context) {
-	c.SetCookie("jwt", "", -1, "/", "", false, true)
-	c.SetCookie("RT", "", -1, "/", "", false, true)
+	h.deleteCookie(c, jwtCookie)
+	h.deleteCookie(c, refreshCookie)
 	c.JSON(http.StatusOK, healthResponse{
 		Status: "success",
 	})
 }
 
 func (h *Handler) setCookies(c *gin.Context, tokens tokenResponse) {
-	c.SetCookie("jwt", tokens.AccessToken, int(h.CookieTTL.Seconds()), "/", "", false, true)
-	c.SetCookie("RT", tokens.RefreshToken, int(h.CookieTTL.Seconds()), "/", "", false, true)
+	h.setCookie(c, jwtCookie, tokens.AccessToken, seconds(h.Cookies.AccessTTL), true)
+	h.setCookie(c, refreshCookie, tokens.RefreshToken, seconds(h.Cookies.RefreshTTL), true)
 }
@@ -0,0 +1,239 @@
+package delivery
+
+import (
+	"context"
+	proto_reservation "github.com/aidostt/protos/gen/go/reservista/reservation"
+	proto_table "github.com/aidostt/protos/gen/go/reservista/table"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"reservista.kz/pkg/logger"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// getAvailability lists the times on a date at which a party can be seated, with
+// the tables free at each of them. from and to ("15:04") narrow down the day.
+func (h *Handler) getAvailability(c *gin.Context) {
+	restaurantID := c.Param("id")
+	settings, err := h.restaurantSettings(c.Request.Context(), restaurantID)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get restaurant settings: "+err.Error())
+		return
+	}
+	loc, err := h.location(settings)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get restaurant timezone: "+err.Error())
+		return
+	}
+
+	fields := make(map[string]string)
+	date, err := time.ParseInLocation("2006-01-02", c.Query("date"), loc)
+	if err != nil {
+		fields["date"] = "must be a date, e.g. 2024-05-01"
+	}
+	partySize, err := strconv.Atoi(c.Query("party_size"))
+	if err != nil || partySize < 1 {
+		fields["party_size"] = "must be a positive number"
+	}
+	from, to := date, date.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	if value := c.Query("from"); value != "" {
+		if from, err = clockOn(date, value); err != nil {
+			fields["from"] = "must be a time, e.g. 18:00"
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = clockOn(date, value); err != nil {
+			fields["to"] = "must be a time, e.g. 22:00"
+		}
+	}
+	if len(fields) == 0 && to.Before(from) {
+		fields["to"] = "must not be before from"
+	}
+	if len(fields) > 0 {
+		newValidationResponse(c, fields)
+		return
+	}
+
+	tables, booked, err := h.restaurantBookings(c.Request.Context(), restaurantID)
+	if err != nil {
+		h.reservationServiceError(c, err)
+		return
+	}
+	combinations, err := h.Repos.Combinations.GetByRestaurant(c.Request.Context(), restaurantID)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get table combinations: "+err.Error())
+		return
+	}
+	tablesByID := byID(tables)
+	slots := make([]availabilitySlot, 0)
+	now := time.Now()
+	for start := h.firstSlot(from); !start.After(to); start = start.Add(h.Reservation.SlotInterval) {
+		if h.checkSlot(start, now) != "" {
+			continue
+		}
+		slot := availabilitySlot{
+			Time:         start,
+			Tables:       h.freeTables(tables, booked, start, partySize, settings.MinOccupancy, ""),
+			Combinations: h.freeCombinations(combinations, tablesByID, booked, start, partySize, settings.MinOccupancy),
+		}
+		if len(slot.Tables) > 0 || len(slot.Combinations) > 0 {
+			if slot.Tables == nil {
+				slot.Tables = make([]availableTable, 0)
+			}
+			slots = append(slots, slot)
+		}
+	}
+	c.JSON(http.StatusOK, slots)
+}
+
+// fits reports whether a party can sit at the table without leaving more seats
+// empty than the minimum occupancy of the restaurant allows.
+func fits(table *proto_table.TableObject, partySize, minOccupancy int) bool {
+	seats := int(table.GetNumberOfSeats())
+	return partySize <= seats && partySize*100 >= seats*minOccupancy
+}
+
+// freeTables returns the tables that fit the party and are free at start, the
+// best fitting, i.e. smallest, first.
+func (h *Handler) freeTables(tables []*proto_table.TableObject, booked bookings, start time.Time, partySize, minOccupancy int, reservationID string) []availableTable {
+	var free []availableTable
+	for _, table := range tables {
+		if fits(table, partySize, minOccupancy) && booked.free(table.GetId(), start, h.blockedFor(), reservationID) {
+			free = append(free, availableTable{
+				ID:          table.GetId(),
+				TableNumber: table.GetTableNumber(),
+				Seats:       table.GetNumberOfSeats(),
+			})
+		}
+	}
+	sort.SliceStable(free, func(i, j int) bool {
+		return free[i].Seats < free[j].Seats
+	})
+	return free
+}
+
+// booking is a reservation holding a table from Start.
+type booking struct {
+	ReservationID string
+	Start         time.Time
+}
+
+// bookings are the reservations per table.
+type bookings map[string][]booking
+
+// free reports whether a reservation at start doesn't overlap any other on the
+// table, apart from the reservation ignored. length is how long a reservation
+// blocks the table, turnover included.
+func (b bookings) free(tableID string, start time.Time, length time.Duration, ignored string) bool {
+	for _, booked := range b[tableID] {
+		if booked.ReservationID == ignored {
+			continue
+		}
+		if start.Before(booked.Start.Add(length)) && booked.Start.Before(start.Add(length)) {
+			return false
+		}
+	}
+	return true
+}
+
+// restaurantBookings returns the tables of a restaurant and their reservations.
+func (h *Handler) restaurantBookings(ctx context.Context, restaurantID string) ([]*proto_table.TableObject, bookings, error) {
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+	tables, err := proto_table.NewTableClient(conn).GetTablesByRestId(ctx, &proto_table.IDRequest{Id: restaurantID})
+	if err != nil {
+		return nil, nil, err
+	}
+	reservations, err := proto_reservation.NewReservationClient(conn).GetAllReservationByRestaurantId(ctx, &proto_reservation.IDRequest{Id: restaurantID})
+	if err != nil {
+		return nil, nil, err
+	}
+	booked := make(bookings)
+	for _, reservation := range reservations.GetReservations() {
+		// reservations that are over don't hold their table any more
+		if details, err := h.Repos.Reservations.Get(ctx, reservation.GetId()); err == nil && details.Final() {
+			continue
+		}
+		tableID := reservation.GetTable().GetId()
+		booked[tableID] = append(booked[tableID], booking{
+			ReservationID: reservation.GetId(),
+			Start:         h.reservationStart(ctx, reservation),
+		})
+	}
+	// tables offered to the waitlist are held until the offer expires
+	if err := h.heldOffers(ctx, restaurantID, booked); err != nil {
+		return nil, nil, err
+	}
+	return tables.GetTables(), booked, nil
+}
+
+// seatParty checks that the table fits the party and that no other reservation
+// holds it at start. Otherwise the response suggests the tables that would do.
+// It writes the error response itself and reports whether the party can be seated.
+func (h *Handler) seatParty(c *gin.Context, table *proto_table.TableObject, start time.Time, partySize int, reservationID string) bool {
+	restaurantID := table.GetRestaurant().GetId()
+	settings, err := h.restaurantSettings(c.Request.Context(), restaurantID)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get restaurant settings: "+err.Error())
+		return false
+	}
+	tables, booked, err := h.restaurantBookings(c.Request.Context(), restaurantID)
+	if err != nil {
+		h.reservationServiceError(c, err)
+		return false
+	}
+
+	seats := int(table.GetNumberOfSeats())
+	resp := seatingResponse{Message: "invalid input"}
+	statusCode := http.StatusBadRequest
+	switch {
+	case partySize > seats:
+		resp.Fields = map[string]string{"party_size": "the table seats " + strconv.Itoa(seats) + " guests at most"}
+	case !fits(table, partySize, settings.MinOccupancy):
+		minimum := (seats*settings.MinOccupancy + 99) / 100
+		resp.Fields = map[string]string{"party_size": "the table is for " + strconv.Itoa(minimum) + " guests or more"}
+	case !booked.free(table.GetId(), start, h.blockedFor(), reservationID):
+		resp.Message = "the table is already reserved at this time"
+		statusCode = http.StatusConflict
+	default:
+		return true
+	}
+	resp.Alternatives = make([]availableTable, 0)
+	for _, alternative := range h.freeTables(tables, booked, start, partySize, settings.MinOccupancy, reservationID) {
+		if alternative.ID != table.GetId() {
+			resp.Alternatives = append(resp.Alternatives, alternative)
+		}
+	}
+	logger.Errorf("%s: %v", resp.Message, resp.Fields)
+	c.Set(errorCtx, resp.Message)
+	c.AbortWithStatusJSON(statusCode, resp)
+	return false
+}
+
+// blockedFor is how long a reservation keeps its table from other reservations.
+func (h *Handler) blockedFor() time.Duration {
+	return h.Reservation.Duration + h.Reservation.Turnover
+}
+
+// firstSlot rounds t up to the slot grid of its day.
+func (h *Handler) firstSlot(t time.Time) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+	if rest := offset % h.Reservation.SlotInterval; rest != 0 {
+		offset += h.Reservation.SlotInterval - rest
+	}
+	return midnight.Add(offset)
+}
+
+// clockOn returns the "15:04" time of day on date.
+func clockOn(date time.Time, clock string) (time.Time, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), t.Hour(), t.Minute(), 0, 0, date.Location()), nil
+}
@@ -0,0 +1,157 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"net/http"
+	"reservista.kz/internal/domain"
+	"reservista.kz/pkg/imaging"
+	"reservista.kz/pkg/logger"
+	"strconv"
+	"time"
+)
+
+// AvatarPolicy limits avatar uploads. MaxPixels guards against images that are
+// small on the wire but huge once decoded.
+type AvatarPolicy struct {
+	MaxBytes  int64
+	MaxPixels int
+}
+
+// avatarSizes are the square variants generated for every avatar.
+var avatarSizes = map[string]int{
+	domain.AvatarDetail: 512,
+	domain.AvatarList:   96,
+}
+
+// uploadAvatar takes the "avatar" file of a multipart form, optionally cropped to
+// the square crop_x, crop_y, crop_size, and replaces the current avatar.
+func (h *Handler) uploadAvatar(c *gin.Context) {
+	userID := c.GetString(idCtx)
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.Avatar.MaxBytes+1<<20)
+	fileHeader, err := c.FormFile("avatar")
+	if err != nil {
+		newResponse(c, http.StatusBadRequest, "missing avatar file: "+err.Error())
+		return
+	}
+	if fileHeader.Size > h.Avatar.MaxBytes {
+		newResponse(c, http.StatusRequestEntityTooLarge, "avatar is larger than "+strconv.FormatInt(h.Avatar.MaxBytes, 10)+" bytes")
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to open file")
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, h.Avatar.MaxBytes))
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to read file")
+		return
+	}
+
+	crop := make([]int, 0, 3)
+	for _, field := range []string{"crop_x", "crop_y", "crop_size"} {
+		value, err := strconv.Atoi(c.DefaultPostForm(field, "0"))
+		if err != nil {
+			newResponse(c, http.StatusBadRequest, "invalid "+field)
+			return
+		}
+		crop = append(crop, value)
+	}
+	img, err := imaging.Decode(data, h.Avatar.MaxPixels)
+	if err != nil {
+		switch {
+		case errors.Is(err, imaging.ErrUnsupportedType):
+			newResponse(c, http.StatusUnsupportedMediaType, err.Error())
+		case errors.Is(err, imaging.ErrTooLarge):
+			newResponse(c, http.StatusRequestEntityTooLarge, err.Error())
+		default:
+			newResponse(c, http.StatusBadRequest, "invalid image: "+err.Error())
+		}
+		return
+	}
+	img, err = imaging.CropSquare(img, crop[0], crop[1], crop[2])
+	if err != nil {
+		newResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// every upload gets new keys, so cached variants of the old avatar don't linger
+	version := primitive.NewObjectID().Hex()
+	avatar := domain.Avatar{UserID: userID, URLs: make(map[string]string), UpdatedAt: time.Now()}
+	for variant, size := range avatarSizes {
+		var buf bytes.Buffer
+		if err := imaging.EncodeJPEG(&buf, imaging.Resize(img, size, size)); err != nil {
+			newResponse(c, http.StatusInternalServerError, "failed to encode avatar: "+err.Error())
+			return
+		}
+		key := "avatars/" + userID + "/" + version + "-" + variant + ".jpg"
+		url, err := h.S3Client.Upload(c.Request.Context(), key, "image/jpeg", &buf)
+		if err != nil {
+			h.deleteAvatarObjects(c.Request.Context(), avatar.Keys)
+			newResponse(c, http.StatusInternalServerError, "failed to upload avatar: "+err.Error())
+			return
+		}
+		avatar.Keys = append(avatar.Keys, key)
+		avatar.URLs[variant] = url
+	}
+
+	previous, err := h.Repos.Avatars.Get(c.Request.Context(), userID)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		newResponse(c, http.StatusInternalServerError, "failed to get avatar: "+err.Error())
+		return
+	}
+	if err := h.Repos.Avatars.Save(c.Request.Context(), avatar); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to save avatar: "+err.Error())
+		return
+	}
+	h.deleteAvatarObjects(c.Request.Context(), previous.Keys)
+	h.audit(c, "user.avatar.upload", map[string]string{"user_id": userID})
+	c.JSON(http.StatusOK, avatar)
+}
+
+func (h *Handler) deleteAvatar(c *gin.Context) {
+	userID := c.GetString(idCtx)
+	avatar, err := h.Repos.Avatars.Get(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			newResponse(c, http.StatusNotFound, "no avatar to delete")
+			return
+		}
+		newResponse(c, http.StatusInternalServerError, "failed to get avatar: "+err.Error())
+		return
+	}
+	if err := h.Repos.Avatars.Delete(c.Request.Context(), userID); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to delete avatar: "+err.Error())
+		return
+	}
+	h.deleteAvatarObjects(c.Request.Context(), avatar.Keys)
+	h.audit(c, "user.avatar.delete", map[string]string{"user_id": userID})
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// deleteAvatarObjects removes stored variants. Failures only leave orphaned
+// objects behind, so they are logged rather than returned.
+func (h *Handler) deleteAvatarObjects(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := h.S3Client.Delete(ctx, key); err != nil {
+			logger.Errorf("failed to delete avatar object %s: %v", key, err)
+		}
+	}
+}
+
+func (h *Handler) avatarURLs(ctx context.Context, userID string) (map[string]string, error) {
+	avatar, err := h.Repos.Avatars.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return avatar.URLs, nil
+}
@@ -0,0 +1,299 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	proto_reservation "github.com/aidostt/protos/gen/go/reservista/reservation"
+	proto_table "github.com/aidostt/protos/gen/go/reservista/table"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"reservista.kz/internal/domain"
+	"reservista.kz/pkg/logger"
+	"sort"
+	"time"
+)
+
+func (h *Handler) getTableCombinations(c *gin.Context) {
+	combinations, err := h.Repos.Combinations.GetByRestaurant(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get table combinations: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, combinations)
+}
+
+func (h *Handler) addTableCombination(c *gin.Context) {
+	var input tableCombinationInput
+	if err := c.BindJSON(&input); err != nil {
+		h.bindingError(c, err)
+		return
+	}
+	restaurantID := c.Param("id")
+	tables, err := h.restaurantTables(c.Request.Context(), restaurantID)
+	if err != nil {
+		h.reservationServiceError(c, err)
+		return
+	}
+	seen := make(map[string]bool, len(input.TableIDs))
+	for _, tableID := range input.TableIDs {
+		if seen[tableID] {
+			newValidationResponse(c, map[string]string{"table_ids": "must not repeat a table"})
+			return
+		}
+		seen[tableID] = true
+		if tables[tableID] == nil {
+			newValidationResponse(c, map[string]string{"table_ids": "table " + tableID + " is not a table of the restaurant"})
+			return
+		}
+	}
+
+	combination := domain.TableCombination{
+		ID:           primitive.NewObjectID().Hex(),
+		RestaurantID: restaurantID,
+		TableIDs:     input.TableIDs,
+		CreatedBy:    c.GetString(idCtx),
+		CreatedAt:    time.Now(),
+	}
+	if err := h.Repos.Combinations.Save(c.Request.Context(), combination); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to save table combination: "+err.Error())
+		return
+	}
+	h.audit(c, "restaurant.combination.add", map[string]string{"combinationID": combination.ID})
+	c.JSON(http.StatusCreated, combination)
+}
+
+func (h *Handler) deleteTableCombination(c *gin.Context) {
+	restaurantID, combinationID := c.Param("id"), c.Param("combinationID")
+	combination, err := h.Repos.Combinations.Get(c.Request.Context(), combinationID)
+	if errors.Is(err, domain.ErrNotFound) || (err == nil && combination.RestaurantID != restaurantID) {
+		newResponse(c, http.StatusNotFound, "table combination not found")
+		return
+	}
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get table combination: "+err.Error())
+		return
+	}
+	if err := h.Repos.Combinations.Delete(c.Request.Context(), combinationID); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to delete table combination: "+err.Error())
+		return
+	}
+	h.audit(c, "restaurant.combination.delete", map[string]string{"combinationID": combinationID})
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// makeCombinationReservation books every table of a combination. The reservation
+// service books one table at a time, so when one of them fails the ones already
+// made are cancelled again.
+func (h *Handler) makeCombinationReservation(c *gin.Context) {
+	var input combinationReservationInput
+	if err := c.BindJSON(&input); err != nil {
+		h.bindingError(c, err)
+		return
+	}
+	userID := c.GetString(idCtx)
+	fields := make(map[string]string)
+	combination, err := h.Repos.Combinations.Get(c.Request.Context(), input.CombinationID)
+	if errors.Is(err, domain.ErrNotFound) {
+		fields["combination_id"] = "table combination not found"
+	} else if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get table combination: "+err.Error())
+		return
+	}
+	start, err := time.Parse(time.RFC3339, input.ReservationTime)
+	if err != nil {
+		fields["reservation_time"] = "must be an RFC 3339 time, e.g. 2024-05-01T19:30:00+05:00"
+	}
+	if len(fields) > 0 {
+		newValidationResponse(c, fields)
+		return
+	}
+	start, ok := h.restaurantSlot(c, combination.RestaurantID, start)
+	if !ok || !h.checkPenalties(c, combination.RestaurantID, userID) {
+		return
+	}
+
+	settings, err := h.restaurantSettings(c.Request.Context(), combination.RestaurantID)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get restaurant settings: "+err.Error())
+		return
+	}
+	tables, booked, err := h.restaurantBookings(c.Request.Context(), combination.RestaurantID)
+	if err != nil {
+		h.reservationServiceError(c, err)
+		return
+	}
+	free, fit := h.combinationFits(combination, byID(tables), booked, start, input.PartySize, settings.MinOccupancy)
+	if !fit {
+		newValidationResponse(c, map[string]string{"party_size": "the combination doesn't fit the party"})
+		return
+	}
+	if free == nil {
+		newResponse(c, http.StatusConflict, "a table of the combination is already reserved at this time")
+		return
+	}
+
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
+	defer conn.Close()
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return
+	}
+	client := proto_reservation.NewReservationClient(conn)
+
+	groupID := primitive.NewObjectID().Hex()
+	reservationIDs := make([]string, 0, len(combination.TableIDs))
+	for _, tableID := range combination.TableIDs {
+		resp, err := client.MakeReservation(c.Request.Context(), &proto_reservation.ReservationSQLRequest{
+			UserID:          userID,
+			TableID:         tableID,
+			ReservationTime: start.Format(time.RFC3339),
+		})
+		if err != nil {
+			h.cancelReservations(context.Background(), reservationIDs)
+			h.reservationServiceError(c, err)
+			return
+		}
+		reservationIDs = append(reservationIDs, resp.GetId())
+	}
+	for i, reservationID := range reservationIDs {
+		err := h.Repos.Reservations.Save(c.Request.Context(), domain.ReservationDetails{
+			ReservationID: reservationID,
+			UserID:        userID,
+			RestaurantID:  combination.RestaurantID,
+			TableID:       combination.TableIDs[i],
+			PartySize:     input.PartySize,
+			GroupID:       groupID,
+			CombinationID: combination.ID,
+			Status:        domain.ReservationPending,
+			CreatedAt:     time.Now(),
+		})
+		if err != nil {
+			logger.Errorf("failed to save details of reservation %s: %v", reservationID, err)
+		}
+	}
+	// reminding of the first reservation and confirming it on arrival covers the
+	// whole group
+	h.scheduleReminders(c.Request.Context(), reservationIDs[0], userID, start)
+	if !h.sendQR(c, userID, reservationIDs[0]) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "group_id": groupID, "reservations": reservationIDs})
+}
+
+// combinationFits reports whether the party fits the combination and, if it does,
+// returns its tables when all of them are free at start.
+func (h *Handler) combinationFits(combination domain.TableCombination, tables map[string]*proto_table.TableObject, booked bookings, start time.Time, partySize, minOccupancy int) ([]availableTable, bool) {
+	var seats, largest int
+	taken := false
+	free := make([]availableTable, 0, len(combination.TableIDs))
+	for _, tableID := range combination.TableIDs {
+		table := tables[tableID]
+		if table == nil {
+			// the table was deleted since the combination was defined
+			return nil, false
+		}
+		seats += int(table.GetNumberOfSeats())
+		if int(table.GetNumberOfSeats()) > largest {
+			largest = int(table.GetNumberOfSeats())
+		}
+		taken = taken || !booked.free(tableID, start, h.blockedFor(), "")
+		free = append(free, availableTable{ID: tableID, TableNumber: table.GetTableNumber(), Seats: table.GetNumberOfSeats()})
+	}
+	// a party that fits a single table of the combination doesn't need it
+	if partySize <= largest || partySize > seats || partySize*100 < seats*minOccupancy {
+		return nil, false
+	}
+	if taken {
+		return nil, true
+	}
+	return free, true
+}
+
+// freeCombinations returns the combinations that fit the party and are free at
+// start, the smallest first.
+func (h *Handler) freeCombinations(combinations []domain.TableCombination, tables map[string]*proto_table.TableObject, booked bookings, start time.Time, partySize, minOccupancy int) []availableCombination {
+	var free []availableCombination
+	for _, combination := range combinations {
+		combined, fit := h.combinationFits(combination, tables, booked, start, partySize, minOccupancy)
+		if !fit || combined == nil {
+			continue
+		}
+		available := availableCombination{ID: combination.ID, Tables: combined}
+		for _, table := range combined {
+			available.Seats += table.Seats
+		}
+		free = append(free, available)
+	}
+	sort.SliceStable(free, func(i, j int) bool {
+		return free[i].Seats < free[j].Seats
+	})
+	return free
+}
+
+// cancelReservations is the compensation of a combination booking that failed
+// halfway. Failures are only logged, the booking error is what the client sees.
+func (h *Handler) cancelReservations(ctx context.Context, reservationIDs []string) {
+	if len(reservationIDs) == 0 {
+		return
+	}
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
+	if err != nil {
+		logger.Errorf("failed to cancel reservations %v: %v", reservationIDs, err)
+		return
+	}
+	defer conn.Close()
+	client := proto_reservation.NewReservationClient(conn)
+	for _, reservationID := range reservationIDs {
+		if _, err := client.DeleteReservationById(ctx, &proto_reservation.IDRequest{Id: reservationID}); err != nil {
+			logger.Errorf("failed to cancel reservation %s: %v", reservationID, err)
+			continue
+		}
+		if err := h.Repos.Reservations.Delete(ctx, reservationID); err != nil {
+			logger.Errorf("failed to delete details of reservation %s: %v", reservationID, err)
+		}
+	}
+}
+
+// groupSiblings returns the other reservations booked together with a reservation.
+func (h *Handler) groupSiblings(ctx context.Context, reservationID string) ([]string, error) {
+	details, err := h.Repos.Reservations.Get(ctx, reservationID)
+	if errors.Is(err, domain.ErrNotFound) || (err == nil && details.GroupID == "") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	group, err := h.Repos.Reservations.GetByGroup(ctx, details.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	var siblings []string
+	for _, member := range group {
+		if member.ReservationID != reservationID {
+			siblings = append(siblings, member.ReservationID)
+		}
+	}
+	return siblings, nil
+}
+
+func (h *Handler) restaurantTables(ctx context.Context, restaurantID string) (map[string]*proto_table.TableObject, error) {
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	tables, err := proto_table.NewTableClient(conn).GetTablesByRestId(ctx, &proto_table.IDRequest{Id: restaurantID})
+	if err != nil {
+		return nil, err
+	}
+	return byID(tables.GetTables()), nil
+}
+
+func byID(tables []*proto_table.TableObject) map[string]*proto_table.TableObject {
+	indexed := make(map[string]*proto_table.TableObject, len(tables))
+	for _, table := range tables {
+		indexed[table.GetId()] = table
+	}
+	return indexed
+}
@@ -0,0 +1,54 @@
+package delivery
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+const (
+	jwtCookie     = "jwt"
+	refreshCookie = "RT"
+
+	hostCookiePrefix = "__Host-"
+)
+
+// CookiePolicy decides how the gateway sets its cookies. With HostPrefix the
+// cookies are named __Host-<name>, which browsers only accept with Secure, path
+// "/" and no domain.
+type CookiePolicy struct {
+	Domain     string
+	Path       string
+	Secure     bool
+	SameSite   http.SameSite
+	HostPrefix bool
+	// AccessTTL is the lifetime of the jwt cookie, RefreshTTL of the RT cookie
+	// and of the other session-bound cookies.
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+func (p CookiePolicy) name(name string) string {
+	if p.HostPrefix {
+		return hostCookiePrefix + name
+	}
+	return name
+}
+
+// setCookie sets a cookie according to the policy, a negative maxAge deletes it.
+func (h *Handler) setCookie(c *gin.Context, name, value string, maxAge int, httpOnly bool) {
+	c.SetSameSite(h.Cookies.SameSite)
+	c.SetCookie(h.Cookies.name(name), value, maxAge, h.Cookies.Path, h.Cookies.Domain, h.Cookies.Secure, httpOnly)
+}
+
+func (h *Handler) deleteCookie(c *gin.Context, name string) {
+	h.setCookie(c, name, "", -1, true)
+}
+
+func (h *Handler) cookie(c *gin.Context, name string) (string, error) {
+	return c.Cookie(h.Cookies.name(name))
+}
+
+func seconds(d time.Duration) int {
+	return int(d.Seconds())
+}
@@ -0,0 +1,120 @@
+package delivery
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy lists what cross-origin requests may do. An origin is either exact,
+// e.g. "https://reservista.kz", or a wildcard subdomain, e.g. "https://*.reservista.kz".
+type CORSPolicy struct {
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	ExposedHeaders []string
+	MaxAge         time.Duration
+}
+
+func (p CORSPolicy) allowsOrigin(origin string) bool {
+	for _, allowed := range p.AllowedOrigins {
+		if matchOrigin(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchOrigin(pattern, origin string) bool {
+	prefix, suffix, wildcard := strings.Cut(pattern, "*")
+	if !wildcard {
+		return strings.EqualFold(pattern, origin)
+	}
+	if len(origin) <= len(prefix)+len(suffix) {
+		return false
+	}
+	origin = strings.ToLower(origin)
+	if !strings.HasPrefix(origin, strings.ToLower(prefix)) || !strings.HasSuffix(origin, strings.ToLower(suffix)) {
+		return false
+	}
+	// the wildcard only stands for subdomains, not for a port or a path
+	subdomain := origin[len(prefix) : len(origin)-len(suffix)]
+	return !strings.ContainsAny(subdomain, "/:@")
+}
+
+func isPreflight(c *gin.Context) bool {
+	return c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+}
+
+// cors adds the CORS headers for allowed origins. Preflight requests are answered
+// by the OPTIONS routes registered by registerPreflight.
+func (h *Handler) cors(c *gin.Context) {
+	c.Writer.Header().Add("Vary", "Origin")
+	origin := c.GetHeader("Origin")
+	if origin == "" {
+		c.Next()
+		return
+	}
+	if !h.CORS.allowsOrigin(origin) {
+		if isPreflight(c) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		c.Next()
+		return
+	}
+
+	c.Header("Access-Control-Allow-Origin", origin)
+	c.Header("Access-Control-Allow-Credentials", "true")
+	if !isPreflight(c) && len(h.CORS.ExposedHeaders) > 0 {
+		c.Header("Access-Control-Expose-Headers", strings.Join(h.CORS.ExposedHeaders, ", "))
+	}
+	c.Next()
+}
+
+// registerPreflight adds an OPTIONS route for every path of the router, so that
+// preflight requests only allow the methods the path actually serves.
+func (h *Handler) registerPreflight(router *gin.Engine) {
+	methods := make(map[string][]string)
+	for _, route := range router.Routes() {
+		methods[route.Path] = append(methods[route.Path], route.Method)
+	}
+	paths := make([]string, 0, len(methods))
+	for path := range methods {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		router.OPTIONS(path, h.preflight(methods[path]))
+	}
+}
+
+func (h *Handler) preflight(routeMethods []string) gin.HandlerFunc {
+	var allowed []string
+	for _, method := range routeMethods {
+		for _, m := range h.CORS.AllowedMethods {
+			if strings.EqualFold(method, m) {
+				allowed = append(allowed, method)
+				break
+			}
+		}
+	}
+	allow := strings.Join(append(routeMethods, http.MethodOptions), ", ")
+
+	return func(c *gin.Context) {
+		if !isPreflight(c) || c.GetHeader("Origin") == "" {
+			c.Header("Allow", allow)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Header("Access-Control-Allow-Methods", strings.Join(allowed, ", "))
+		c.Header("Access-Control-Allow-Headers", strings.Join(h.CORS.AllowedHeaders, ", "))
+		if h.CORS.MaxAge > 0 {
+			c.Header("Access-Control-Max-Age", strconv.Itoa(int(h.CORS.MaxAge.Seconds())))
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,213 @@
+package delivery
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCORSTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := &Handler{CORS: CORSPolicy{
+		AllowedOrigins: []string{"http://localhost:3000", "https://*.reservista.kz"},
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodDelete},
+		AllowedHeaders: []string{"Content-Type", "X-CSRF-Token"},
+		ExposedHeaders: []string{"X-Request-ID"},
+		MaxAge:         10 * time.Minute,
+	}}
+	router := gin.New()
+	router.Use(h.cors)
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) }
+	router.GET("/api/items", ok)
+	router.POST("/api/items", ok)
+	router.DELETE("/api/items/:id", ok)
+	router.PATCH("/api/items/:id", ok)
+	router.GET("/api/items/:id/qr", func(c *gin.Context) {
+		c.Header("Content-Type", "image/png")
+		c.Writer.Write([]byte("png"))
+	})
+	h.registerPreflight(router)
+	return router
+}
+
+func TestCORSOrigins(t *testing.T) {
+	router := newCORSTestRouter()
+	tests := []struct {
+		name    string
+		origin  string
+		allowed bool
+	}{
+		{name: "exact", origin: "http://localhost:3000", allowed: true},
+		{name: "exact with another port", origin: "http://localhost:3001"},
+		{name: "exact with another scheme", origin: "https://localhost:3000"},
+		{name: "wildcard subdomain", origin: "https://app.reservista.kz", allowed: true},
+		{name: "wildcard nested subdomain", origin: "https://admin.app.reservista.kz", allowed: true},
+		{name: "wildcard is case insensitive", origin: "HTTPS://App.Reservista.KZ", allowed: true},
+		{name: "wildcard doesn't match the apex", origin: "https://reservista.kz"},
+		{name: "wildcard with another scheme", origin: "http://app.reservista.kz"},
+		{name: "wildcard with a port", origin: "https://app.reservista.kz:8443"},
+		{name: "wildcard with credentials", origin: "https://user@app.reservista.kz"},
+		{name: "lookalike domain", origin: "https://evilreservista.kz"},
+		{name: "domain as a subdomain", origin: "https://app.reservista.kz.evil.example"},
+		{name: "no origin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/items", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			// the request is served either way, the browser decides what the page sees
+			if w.Code != http.StatusOK {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			if got := w.Header().Values("Vary"); len(got) == 0 || got[0] != "Origin" {
+				t.Errorf("Vary = %q, want Origin", got)
+			}
+			wantOrigin, wantCredentials, wantExposed := "", "", ""
+			if tt.allowed {
+				wantOrigin, wantCredentials, wantExposed = tt.origin, "true", "X-Request-ID"
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, wantOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, wantCredentials)
+			}
+			if got := w.Header().Get("Access-Control-Expose-Headers"); got != wantExposed {
+				t.Errorf("Access-Control-Expose-Headers = %q, want %q", got, wantExposed)
+			}
+		})
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	router := newCORSTestRouter()
+	tests := []struct {
+		name          string
+		path          string
+		origin        string
+		requestMethod string
+		wantCode      int
+		wantMethods   string
+		wantAllow     string
+	}{
+		{
+			name:          "collection",
+			path:          "/api/items",
+			origin:        "http://localhost:3000",
+			requestMethod: http.MethodPost,
+			wantCode:      http.StatusNoContent,
+			wantMethods:   "GET, POST",
+		},
+		{
+			name:          "item leaves out methods the config doesn't allow",
+			path:          "/api/items/42",
+			origin:        "https://app.reservista.kz",
+			requestMethod: http.MethodDelete,
+			wantCode:      http.StatusNoContent,
+			wantMethods:   "DELETE",
+		},
+		{
+			name:          "route that only reads",
+			path:          "/api/items/42/qr",
+			origin:        "https://app.reservista.kz",
+			requestMethod: http.MethodGet,
+			wantCode:      http.StatusNoContent,
+			wantMethods:   "GET",
+		},
+		{
+			name:          "disallowed origin",
+			path:          "/api/items",
+			origin:        "https://evil.example",
+			requestMethod: http.MethodPost,
+			wantCode:      http.StatusForbidden,
+		},
+		{
+			name:      "plain OPTIONS lists the methods of the route",
+			path:      "/api/items/42",
+			wantCode:  http.StatusNoContent,
+			wantAllow: "DELETE, OPTIONS, PATCH",
+		},
+		{
+			name:          "unknown path",
+			path:          "/api/unknown",
+			origin:        "http://localhost:3000",
+			requestMethod: http.MethodGet,
+			wantCode:      http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, tt.path, nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.requestMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+				req.Header.Set("Access-Control-Request-Headers", "content-type")
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+			if got := sortedList(w.Header().Get("Access-Control-Allow-Methods")); got != tt.wantMethods {
+				t.Errorf("Access-Control-Allow-Methods = %q, want %q", got, tt.wantMethods)
+			}
+			if got := sortedList(w.Header().Get("Allow")); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+			if tt.wantCode == http.StatusForbidden {
+				if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+					t.Errorf("Access-Control-Allow-Origin = %q for a disallowed origin", got)
+				}
+			}
+			if tt.wantMethods == "" {
+				return
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.origin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.origin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type, X-CSRF-Token" {
+				t.Errorf("Access-Control-Allow-Headers = %q", got)
+			}
+			if got := w.Header().Get("Access-Control-Max-Age"); got != "600" {
+				t.Errorf("Access-Control-Max-Age = %q, want 600", got)
+			}
+			if got := w.Header().Get("Access-Control-Expose-Headers"); got != "" {
+				t.Errorf("preflight exposes headers %q", got)
+			}
+		})
+	}
+}
+
+func TestCORSKeepsContentType(t *testing.T) {
+	router := newCORSTestRouter()
+	req := httptest.NewRequest(http.MethodGet, "/api/items/42/qr", nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if got := w.Header().Get("Content-Type"); got != "image/png" {
+		t.Errorf("Content-Type = %q, want image/png", got)
+	}
+}
+
+// sortedList sorts a comma separated header value, the order of the methods of a
+// route is up to the router.
+func sortedList(value string) string {
+	if value == "" {
+		return ""
+	}
+	items := strings.Split(value, ", ")
+	sort.Strings(items)
+	return strings.Join(items, ", ")
+}
@@ -0,0 +1,57 @@
+package delivery
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newCSRFTestRouter serves a route authenticated with the session cookies and a
+// stand-in for a route that authenticates with the API key.
+func newCSRFTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := &Handler{Cookies: CookiePolicy{Path: "/", RefreshTTL: time.Hour}}
+	router := gin.New()
+	router.Use(h.csrf)
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) }
+	router.POST("/api/cookie", h.userIdentity, ok)
+	router.POST("/api/key", ok)
+	return router
+}
+
+func TestCSRF(t *testing.T) {
+	router := newCSRFTestRouter()
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		apiKey string
+		want   int
+	}{
+		{name: "missing header", path: "/api/key", want: http.StatusForbidden},
+		{name: "wrong header", path: "/api/key", header: "other", want: http.StatusForbidden},
+		{name: "matching header", path: "/api/key", header: "token", want: http.StatusOK},
+		{name: "api key on a key route", path: "/api/key", apiKey: "rsv_key", want: http.StatusOK},
+		{name: "api key on a cookie route", path: "/api/cookie", apiKey: "rsv_key", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			req.AddCookie(&http.Cookie{Name: csrfCookie, Value: "token"})
+			req.AddCookie(&http.Cookie{Name: refreshCookie, Value: "refresh"})
+			if tt.header != "" {
+				req.Header.Set(csrfHeader, tt.header)
+			}
+			if tt.apiKey != "" {
+				req.Header.Set(apiKeyHeader, tt.apiKey)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
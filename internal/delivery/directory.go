@@ -0,0 +1,312 @@
+package delivery
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	proto_user "github.com/aidostt/protos/gen/go/reservista/user"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"reservista.kz/internal/domain"
+	"reservista.kz/pkg/logger"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// sortableTime formats times so that they sort as strings
+	sortableTime = "2006-01-02T15:04:05.000000000Z"
+
+	bulkActivate   = "activate"
+	bulkDeactivate = "deactivate"
+	bulkAssignRole = "assign_role"
+)
+
+// getUserDirectory lists users for admins. Paging works with page and limit like
+// the other listings, or with the cursor returned as nextCursor.
+func (h *Handler) getUserDirectory(c *gin.Context) {
+	limit, offset, ok := h.pagination(c)
+	if !ok {
+		return
+	}
+	filter := domain.DirectoryFilter{
+		Query:  strings.TrimSpace(c.Query("q")),
+		Role:   c.Query("role"),
+		Sort:   c.DefaultQuery("sort", domain.DirectorySortCreated),
+		Limit:  limit,
+		Offset: offset,
+	}
+	switch filter.Sort {
+	case domain.DirectorySortCreated, domain.DirectorySortName, domain.DirectorySortEmail:
+	default:
+		newResponse(c, http.StatusBadRequest, "invalid sort parameter, expected created, name or email")
+		return
+	}
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		filter.Desc = true
+	default:
+		newResponse(c, http.StatusBadRequest, "invalid order parameter, expected asc or desc")
+		return
+	}
+	if activated := c.Query("activated"); activated != "" {
+		value, err := strconv.ParseBool(activated)
+		if err != nil {
+			newResponse(c, http.StatusBadRequest, "invalid activated parameter")
+			return
+		}
+		filter.Activated = &value
+	}
+	var err error
+	if from := c.Query("created_from"); from != "" {
+		if filter.CreatedFrom, err = time.Parse(time.RFC3339, from); err != nil {
+			newResponse(c, http.StatusBadRequest, "invalid created_from parameter, expected RFC 3339")
+			return
+		}
+	}
+	if to := c.Query("created_to"); to != "" {
+		if filter.CreatedTo, err = time.Parse(time.RFC3339, to); err != nil {
+			newResponse(c, http.StatusBadRequest, "invalid created_to parameter, expected RFC 3339")
+			return
+		}
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		if filter.After, err = decodeDirectoryCursor(cursor); err != nil {
+			newResponse(c, http.StatusBadRequest, "invalid cursor parameter")
+			return
+		}
+	}
+
+	all, err := h.Repos.Directory.GetAll(c.Request.Context())
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to query user directory: "+err.Error())
+		return
+	}
+	users, more := findDirectoryUsers(all, filter)
+	resp := directoryResponse{Users: users}
+	if more {
+		last := users[len(users)-1]
+		resp.NextCursor = encodeDirectoryCursor(domain.DirectoryCursor{
+			Key: directorySortKey(last, filter.Sort),
+			ID:  last.ID,
+		})
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// bulkUpdateUsers applies one action to every listed user. A failure doesn't stop
+// the others, the outcome is reported per user.
+func (h *Handler) bulkUpdateUsers(c *gin.Context) {
+	var input bulkUsersInput
+	if err := c.BindJSON(&input); err != nil {
+		newResponse(c, http.StatusBadRequest, "invalid input body: "+err.Error())
+		return
+	}
+	if input.Action == bulkAssignRole && input.Role == "" {
+		newResponse(c, http.StatusBadRequest, "role is required to assign a role")
+		return
+	}
+	h.audit(c, "user.bulk."+input.Action, map[string]string{"user_ids": strings.Join(input.UserIDs, ",")})
+
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Users)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return
+	}
+	defer conn.Close()
+	client := proto_user.NewUserClient(conn)
+
+	results := make([]bulkResult, 0, len(input.UserIDs))
+	var succeeded []string
+	for _, userID := range input.UserIDs {
+		var err error
+		switch input.Action {
+		case bulkActivate, bulkDeactivate:
+			err = h.setActivated(c.Request.Context(), client, userID, input.Action == bulkActivate)
+		case bulkAssignRole:
+			_, _, err = h.updateUserRoles(c.Request.Context(), userID, func(roles []string) []string {
+				return addRole(roles, input.Role)
+			})
+		}
+		result := bulkResult{UserID: userID, Status: err == nil}
+		if err != nil {
+			result.Error = err.Error()
+			if st, ok := status.FromError(err); ok {
+				result.Error = st.Message()
+			}
+		} else {
+			succeeded = append(succeeded, userID)
+		}
+		results = append(results, result)
+	}
+	h.auditChange(c, nil, map[string]interface{}{"role": input.Role, "succeeded": succeeded})
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+func (h *Handler) setActivated(ctx context.Context, client proto_user.UserClient, userID string, activate bool) error {
+	statusResponse, err := client.Activate(ctx, &proto_user.ActivateRequest{
+		UserID:   userID,
+		Activate: activate,
+	})
+	if err != nil {
+		return err
+	}
+	if !statusResponse.GetStatus() {
+		return status.Error(codes.Internal, "user service failed to change activation")
+	}
+	h.recordUser(ctx, userID)
+	return nil
+}
+
+// recordUser keeps the profile of a user the gateway just wrote in the
+// directory, as the user service has it now. The directory is a convenience for
+// admins, so failures are only logged.
+func (h *Handler) recordUser(ctx context.Context, userID string) {
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Users)
+	if err != nil {
+		logger.Errorf("failed to get user %s for the directory: %v", userID, err)
+		return
+	}
+	defer conn.Close()
+	user, err := proto_user.NewUserClient(conn).GetByID(ctx, &proto_user.GetRequest{
+		UserId: userID,
+		Email:  domain.Plug,
+	})
+	if err != nil {
+		logger.Errorf("failed to get user %s for the directory: %v", userID, err)
+		return
+	}
+	h.recordProfile(ctx, userID, user)
+}
+
+// recordProfile keeps a profile the gateway just read or wrote in the directory.
+func (h *Handler) recordProfile(ctx context.Context, userID string, user *proto_user.UserResponse) {
+	err := h.Repos.Directory.Save(ctx, domain.DirectoryUser{
+		ID:        userID,
+		Name:      user.GetName(),
+		Surname:   user.GetSurname(),
+		Phone:     user.GetPhone(),
+		Email:     user.GetEmail(),
+		Roles:     user.GetRoles(),
+		Activated: user.GetActivated(),
+		CreatedAt: userCreatedAt(userID),
+	})
+	if err != nil {
+		logger.Errorf("failed to record user %s in the directory: %v", userID, err)
+	}
+}
+
+// userCreatedAt is the sign up time of a user, which the user service keeps in
+// the ObjectID of the user. It is zero for ids that aren't ObjectIDs.
+func userCreatedAt(userID string) time.Time {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return time.Time{}
+	}
+	return id.Timestamp()
+}
+
+// findDirectoryUsers returns a page of matching users and whether there are more.
+func findDirectoryUsers(users []domain.DirectoryUser, filter domain.DirectoryFilter) ([]domain.DirectoryUser, bool) {
+	matched := make([]domain.DirectoryUser, 0)
+	for _, user := range users {
+		if matchesDirectory(user, filter) {
+			matched = append(matched, user)
+		}
+	}
+
+	less := func(a, b domain.DirectoryUser) bool {
+		ka, kb := directorySortKey(a, filter.Sort), directorySortKey(b, filter.Sort)
+		if ka != kb {
+			return ka < kb != filter.Desc
+		}
+		return a.ID < b.ID != filter.Desc
+	}
+	sort.Slice(matched, func(i, j int) bool { return less(matched[i], matched[j]) })
+
+	start := filter.Offset
+	if filter.After != nil {
+		start = sort.Search(len(matched), func(i int) bool {
+			// the first user past the cursor, ties on the key are broken by id
+			a, b := directorySortKey(matched[i], filter.Sort), filter.After.Key
+			if a == b {
+				a, b = matched[i].ID, filter.After.ID
+			}
+			if filter.Desc {
+				return a < b
+			}
+			return a > b
+		})
+	}
+	if start > len(matched) {
+		start = len(matched)
+	}
+	matched = matched[start:]
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		return matched[:filter.Limit], true
+	}
+	return matched, false
+}
+
+// directorySortKey is the value users are ordered by for the given sort, which is
+// also what cursors point at.
+func directorySortKey(user domain.DirectoryUser, sortBy string) string {
+	switch sortBy {
+	case domain.DirectorySortName:
+		return strings.ToLower(user.Name + " " + user.Surname)
+	case domain.DirectorySortEmail:
+		return strings.ToLower(user.Email)
+	default:
+		return user.CreatedAt.UTC().Format(sortableTime)
+	}
+}
+
+func matchesDirectory(user domain.DirectoryUser, filter domain.DirectoryFilter) bool {
+	if filter.Query != "" {
+		query := strings.ToLower(filter.Query)
+		text := strings.ToLower(strings.Join([]string{user.Name, user.Surname, user.Email, user.Phone}, " "))
+		if !strings.Contains(text, query) {
+			return false
+		}
+	}
+	if filter.Role != "" && !hasAnyPermittedRole(user.Roles, []string{filter.Role}) {
+		return false
+	}
+	if filter.Activated != nil && user.Activated != *filter.Activated {
+		return false
+	}
+	if !filter.CreatedFrom.IsZero() && user.CreatedAt.Before(filter.CreatedFrom) {
+		return false
+	}
+	if !filter.CreatedTo.IsZero() && user.CreatedAt.After(filter.CreatedTo) {
+		return false
+	}
+	return true
+}
+
+func encodeDirectoryCursor(cursor domain.DirectoryCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeDirectoryCursor(value string) (*domain.DirectoryCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor domain.DirectoryCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	if cursor.ID == "" {
+		return nil, errors.New("cursor without id")
+	}
+	return &cursor, nil
+}
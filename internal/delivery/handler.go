@@ -3,43 +3,91 @@ package delivery
 import (
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"reservista.kz/internal/audit"
+	"reservista.kz/internal/policy"
+	"reservista.kz/internal/repository"
 	"reservista.kz/pkg/dialog"
+	"reservista.kz/pkg/hash"
 	manager "reservista.kz/pkg/manager"
+	"reservista.kz/pkg/oidc"
 	"reservista.kz/pkg/s3client"
+	"strconv"
 	"time"
 )
 
 type Handler struct {
-	CookieTTL    time.Duration
-	Dialog       *dialog.Dialog
-	S3Client     *s3client.S3Client
-	Environment  string
-	TokenManager manager.TokenManager
-	HttpAddress  string
-	PageDefault  string
-	LimitDefault string
+	Cookies          CookiePolicy
+	CORS             CORSPolicy
+	Erasure          ErasurePolicy
+	Suspension       SuspensionPolicy
+	Avatar           AvatarPolicy
+	Reservation      ReservationPolicy
+	Idempotency      IdempotencyPolicy
+	Waitlist         WaitlistPolicy
+	Reminders        ReminderPolicy
+	Dialog           *dialog.Dialog
+	S3Client         *s3client.S3Client
+	Environment      string
+	TokenManager     manager.TokenManager
+	HttpAddress      string
+	PublicURL        string
+	PageDefault      string
+	LimitDefault     string
+	Repos            *repository.Repositories
+	OIDC             map[string]oidc.Provider
+	OIDCStateTTL     time.Duration
+	SecretHasher     hash.PasswordHasher
+	Policy           *policy.Engine
+	InviteTTL        time.Duration
+	Auditor          *audit.Auditor
+	ImpersonationTTL time.Duration
 }
 
 func NewHandler(handler Handler) *Handler {
 	return &Handler{
-		Dialog:       handler.Dialog,
-		CookieTTL:    handler.CookieTTL,
-		Environment:  handler.Environment,
-		TokenManager: handler.TokenManager,
-		HttpAddress:  handler.HttpAddress,
-		S3Client:     handler.S3Client,
-		PageDefault:  handler.PageDefault,
-		LimitDefault: handler.LimitDefault,
+		Dialog:           handler.Dialog,
+		Cookies:          handler.Cookies,
+		CORS:             handler.CORS,
+		Erasure:          handler.Erasure,
+		Suspension:       handler.Suspension,
+		Avatar:           handler.Avatar,
+		Reservation:      handler.Reservation,
+		Idempotency:      handler.Idempotency,
+		Waitlist:         handler.Waitlist,
+		Reminders:        handler.Reminders,
+		Environment:      handler.Environment,
+		TokenManager:     handler.TokenManager,
+		HttpAddress:      handler.HttpAddress,
+		PublicURL:        handler.PublicURL,
+		S3Client:         handler.S3Client,
+		PageDefault:      handler.PageDefault,
+		LimitDefault:     handler.LimitDefault,
+		Repos:            handler.Repos,
+		OIDC:             handler.OIDC,
+		OIDCStateTTL:     handler.OIDCStateTTL,
+		SecretHasher:     handler.SecretHasher,
+		Policy:           handler.Policy,
+		InviteTTL:        handler.InviteTTL,
+		Auditor:          handler.Auditor,
+		ImpersonationTTL: handler.ImpersonationTTL,
 	}
 }
 
 func (h *Handler) Init() *gin.Engine {
+	h.Policy.SetResolver(policy.ResolverTable, h.restaurantOfTable)
+	h.Policy.SetResolver(policy.ResolverReservation, h.restaurantOfReservation)
+	h.Policy.SetResolver(policy.ResolverReservationGuest, h.guestOfReservation)
+	h.Policy.Register(h.policyRules()...)
+
 	router := gin.Default()
 
 	router.Use(
 		gin.Recovery(),
 		gin.Logger(),
-		corsMiddleware,
+		h.cors,
+		h.requestID,
+		h.auditTrail,
+		h.csrf,
 	)
 
 	router.GET("/ping", func(c *gin.Context) {
@@ -54,7 +102,31 @@ func (h *Handler) Init() *gin.Engine {
 		h.qr(api)
 		h.user(api)
 		h.reservation(api)
+		h.waitlist(api)
+		h.reminders(api)
+		h.apiKey(api)
+		h.admin(api)
+		h.staff(api)
+		h.impersonation(api)
+		h.suspension(api)
 	}
+	h.registerPreflight(router)
 
 	return router
 }
+
+// pagination reads the page and limit query parameters. It writes the error
+// response itself and reports whether they were valid.
+func (h *Handler) pagination(c *gin.Context) (limit, offset int, ok bool) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", h.PageDefault))
+	if err != nil || page < 1 {
+		newResponse(c, http.StatusBadRequest, "invalid page parameter")
+		return 0, 0, false
+	}
+	limit, err = strconv.Atoi(c.DefaultQuery("limit", h.LimitDefault))
+	if err != nil || limit < 1 {
+		newResponse(c, http.StatusBadRequest, "invalid limit parameter")
+		return 0, 0, false
+	}
+	return limit, (page - 1) * limit, true
+}
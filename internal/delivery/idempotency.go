@@ -0,0 +1,114 @@
+package delivery
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"reservista.kz/internal/domain"
+	"reservista.kz/pkg/logger"
+	"time"
+)
+
+const (
+	idempotencyKeyHeader   = "Idempotency-Key"
+	idempotentReplayHeader = "Idempotent-Replayed"
+	maxIdempotencyKey      = 255
+)
+
+// IdempotencyPolicy is how long the response to a request with an idempotency key
+// is replayed to its retries, and how long a request in flight holds the key.
+type IdempotencyPolicy struct {
+	TTL         time.Duration
+	LockTimeout time.Duration
+}
+
+// idempotency answers retries of a POST, PATCH or DELETE with the response to the
+// first request made with the same Idempotency-Key. Keys are per caller, so it is
+// registered after authorize, once the caller is known; other methods pass through.
+func (h *Handler) idempotency(c *gin.Context) {
+	key := c.GetHeader(idempotencyKeyHeader)
+	callerID := c.GetString(idCtx)
+	switch c.Request.Method {
+	case http.MethodPost, http.MethodPatch, http.MethodDelete:
+	default:
+		c.Next()
+		return
+	}
+	if key == "" || callerID == "" {
+		c.Next()
+		return
+	}
+	if len(key) > maxIdempotencyKey {
+		newResponse(c, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		newResponse(c, http.StatusBadRequest, "failed to read request body: "+err.Error())
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	fingerprint := sha256.New()
+	fingerprint.Write([]byte(c.Request.Method + " " + c.Request.URL.RequestURI() + "\n"))
+	fingerprint.Write(body)
+
+	storeKey := callerID + "|" + key
+	request := domain.IdempotentRequest{Fingerprint: hex.EncodeToString(fingerprint.Sum(nil)), CreatedAt: time.Now()}
+	first, claimed, err := h.Repos.Idempotency.Begin(c.Request.Context(), storeKey, request, h.Idempotency.LockTimeout)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to check idempotency key: "+err.Error())
+		return
+	}
+	if !claimed {
+		switch {
+		case first.Fingerprint != request.Fingerprint:
+			newResponse(c, http.StatusUnprocessableEntity, "Idempotency-Key was already used for another request")
+		case !first.Completed:
+			newResponse(c, http.StatusConflict, "a request with this Idempotency-Key is in progress")
+		default:
+			c.Header(idempotentReplayHeader, "true")
+			c.Data(first.Status, first.ContentType, first.Body)
+			c.Abort()
+		}
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: c.Writer}
+	c.Writer = recorder
+	c.Next()
+
+	// failures of the gateway or the services are worth retrying
+	if recorder.Status() >= http.StatusInternalServerError {
+		if err := h.Repos.Idempotency.Release(c.Request.Context(), storeKey); err != nil {
+			logger.Errorf("failed to release idempotency key: %v", err)
+		}
+		return
+	}
+	request.Completed = true
+	request.Status = recorder.Status()
+	request.ContentType = recorder.Header().Get("Content-Type")
+	request.Body = recorder.body.Bytes()
+	if err := h.Repos.Idempotency.Complete(c.Request.Context(), storeKey, request, h.Idempotency.TTL); err != nil {
+		logger.Errorf("failed to store idempotent response: %v", err)
+	}
+}
+
+// responseRecorder keeps a copy of the response body.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
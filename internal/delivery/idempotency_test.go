@@ -0,0 +1,138 @@
+package delivery
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"net/http"
+	"net/http/httptest"
+	"reservista.kz/internal/repository"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newIdempotencyTestRouter serves POST /api/items with the idempotency middleware
+// over store. Requests to /api/items?block wait for release before answering.
+func newIdempotencyTestRouter(store repository.Idempotency, calls *int32, started, release chan struct{}) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := &Handler{
+		Repos:       &repository.Repositories{Idempotency: store},
+		Idempotency: IdempotencyPolicy{TTL: time.Hour, LockTimeout: time.Minute},
+	}
+	router := gin.New()
+	caller := func(c *gin.Context) { c.Set(idCtx, "user-1") }
+	router.POST("/api/items", caller, h.idempotency, func(c *gin.Context) {
+		n := atomic.AddInt32(calls, 1)
+		if _, ok := c.GetQuery("block"); ok {
+			started <- struct{}{}
+			<-release
+		}
+		c.JSON(http.StatusCreated, gin.H{"call": n})
+	})
+	return router
+}
+
+func idempotencyStores(t *testing.T) map[string]func() repository.Idempotency {
+	return map[string]func() repository.Idempotency{
+		"memory": func() repository.Idempotency { return repository.NewIdempotencyRepo() },
+		"redis": func() repository.Idempotency {
+			server := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+			t.Cleanup(func() { client.Close() })
+			return repository.NewRedisIdempotencyRepo(client, "idempotency:")
+		},
+	}
+}
+
+func postItem(router *gin.Engine, path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	for name, newStore := range idempotencyStores(t) {
+		t.Run(name, func(t *testing.T) {
+			var calls int32
+			router := newIdempotencyTestRouter(newStore(), &calls, nil, nil)
+
+			first := postItem(router, "/api/items", "key-1", `{"name":"a"}`)
+			retry := postItem(router, "/api/items", "key-1", `{"name":"a"}`)
+			if first.Code != http.StatusCreated || retry.Code != http.StatusCreated {
+				t.Fatalf("statuses = %d, %d, want %d", first.Code, retry.Code, http.StatusCreated)
+			}
+			if retry.Body.String() != first.Body.String() {
+				t.Errorf("replayed body = %s, want %s", retry.Body, first.Body)
+			}
+			if got := retry.Header().Get(idempotentReplayHeader); got != "true" {
+				t.Errorf("%s = %q, want true", idempotentReplayHeader, got)
+			}
+			if first.Header().Get(idempotentReplayHeader) != "" {
+				t.Error("the first response is marked as replayed")
+			}
+			if calls != 1 {
+				t.Errorf("handler ran %d times, want 1", calls)
+			}
+
+			// requests without a key aren't replayed
+			postItem(router, "/api/items", "", `{"name":"a"}`)
+			postItem(router, "/api/items", "", `{"name":"a"}`)
+			if calls != 3 {
+				t.Errorf("handler ran %d times, want 3", calls)
+			}
+		})
+	}
+}
+
+func TestIdempotencyFingerprintMismatch(t *testing.T) {
+	for name, newStore := range idempotencyStores(t) {
+		t.Run(name, func(t *testing.T) {
+			var calls int32
+			router := newIdempotencyTestRouter(newStore(), &calls, nil, nil)
+
+			postItem(router, "/api/items", "key-1", `{"name":"a"}`)
+			w := postItem(router, "/api/items", "key-1", `{"name":"b"}`)
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusUnprocessableEntity)
+			}
+			if calls != 1 {
+				t.Errorf("handler ran %d times, want 1", calls)
+			}
+		})
+	}
+}
+
+func TestIdempotencyConcurrent(t *testing.T) {
+	for name, newStore := range idempotencyStores(t) {
+		t.Run(name, func(t *testing.T) {
+			var calls int32
+			started, release := make(chan struct{}), make(chan struct{})
+			router := newIdempotencyTestRouter(newStore(), &calls, started, release)
+
+			done := make(chan *httptest.ResponseRecorder)
+			go func() { done <- postItem(router, "/api/items?block", "key-1", `{}`) }()
+			<-started
+			w := postItem(router, "/api/items?block", "key-1", `{}`)
+			if w.Code != http.StatusConflict {
+				t.Errorf("status while the first request runs = %d, want %d", w.Code, http.StatusConflict)
+			}
+			close(release)
+			if first := <-done; first.Code != http.StatusCreated {
+				t.Errorf("first status = %d, want %d", first.Code, http.StatusCreated)
+			}
+			if retry := postItem(router, "/api/items?block", "key-1", `{}`); retry.Code != http.StatusCreated {
+				t.Errorf("status after the first request = %d, want the replayed %d", retry.Code, http.StatusCreated)
+			}
+			if calls != 1 {
+				t.Errorf("handler ran %d times, want 1", calls)
+			}
+		})
+	}
+}
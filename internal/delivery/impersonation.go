@@ -0,0 +1,157 @@
+package delivery
+
+import (
+	"errors"
+	proto_user "github.com/aidostt/protos/gen/go/reservista/user"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"reservista.kz/internal/domain"
+	"reservista.kz/pkg/logger"
+	manager "reservista.kz/pkg/manager"
+	"time"
+)
+
+const (
+	impersonatorCookie  = "jwt_impersonator"
+	impersonationIssuer = "reservista-gateway"
+
+	impersonatorCtx  = "impersonatorId"
+	impersonationCtx = "impersonationId"
+)
+
+func (h *Handler) impersonation(api *gin.RouterGroup) {
+	impersonation := api.Group("/impersonation", h.userIdentity, h.authorize, h.idempotency)
+	{
+		impersonation.POST("/start", h.startImpersonation)
+		impersonation.POST("/end", h.endImpersonation)
+	}
+}
+
+// startImpersonation swaps the jwt cookie of the admin for a token of the user.
+// The admin's own token is parked in a separate cookie until the session ends.
+func (h *Handler) startImpersonation(c *gin.Context) {
+	var input impersonationInput
+	if err := c.BindJSON(&input); err != nil {
+		newResponse(c, http.StatusBadRequest, "invalid input body: "+err.Error())
+		return
+	}
+	actorID := c.GetString(idCtx)
+	if input.UserID == actorID {
+		newResponse(c, http.StatusBadRequest, "can't impersonate yourself")
+		return
+	}
+	adminToken, err := h.cookie(c, jwtCookie)
+	if err != nil {
+		newResponse(c, http.StatusUnauthorized, "unauthorized access: "+err.Error())
+		return
+	}
+
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Users)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return
+	}
+	defer conn.Close()
+	user, err := proto_user.NewUserClient(conn).GetByID(c.Request.Context(), &proto_user.GetRequest{
+		UserId: input.UserID,
+		Email:  domain.Plug,
+	})
+	if err != nil {
+		h.userServiceError(c, err)
+		return
+	}
+	if hasAnyPermittedRole(user.GetRoles(), []string{domain.AdminRole}) {
+		newResponse(c, http.StatusForbidden, "admins can't be impersonated")
+		return
+	}
+
+	now := time.Now()
+	session := domain.Impersonation{
+		ID:        primitive.NewObjectID().Hex(),
+		ActorID:   actorID,
+		UserID:    input.UserID,
+		Reason:    input.Reason,
+		StartedAt: now,
+		ExpiresAt: now.Add(h.ImpersonationTTL),
+	}
+	token, err := h.TokenManager.NewImpersonationToken(session.UserID, session.ActorID, session.ID, h.ImpersonationTTL, user.GetRoles(), impersonationIssuer, user.GetActivated())
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to issue impersonation token: "+err.Error())
+		return
+	}
+	if err := h.Repos.Impersonations.Create(c.Request.Context(), session); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to save impersonation: "+err.Error())
+		return
+	}
+
+	h.setCookie(c, impersonatorCookie, adminToken, seconds(h.Cookies.RefreshTTL), true)
+	h.setCookie(c, jwtCookie, token, seconds(h.ImpersonationTTL), true)
+	logger.Infof("impersonation %s started: %s acting as %s until %s, reason: %s",
+		session.ID, session.ActorID, session.UserID, session.ExpiresAt.Format(time.RFC3339), session.Reason)
+	h.audit(c, "impersonation.start", map[string]string{"impersonation_id": session.ID, "user_id": session.UserID})
+	h.auditChange(c, nil, map[string]interface{}{"reason": session.Reason, "expiresAt": session.ExpiresAt})
+	c.JSON(http.StatusOK, session)
+}
+
+// endImpersonation gives the admin their own session back.
+func (h *Handler) endImpersonation(c *gin.Context) {
+	id := c.GetString(impersonationCtx)
+	if id == "" {
+		newResponse(c, http.StatusBadRequest, "not impersonating anyone")
+		return
+	}
+	session, err := h.Repos.Impersonations.Get(c.Request.Context(), id)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get impersonation: "+err.Error())
+		return
+	}
+	now := time.Now()
+	session.EndedAt = &now
+	if err := h.Repos.Impersonations.Update(c.Request.Context(), session); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to update impersonation: "+err.Error())
+		return
+	}
+	h.restoreImpersonator(c)
+	logger.Infof("impersonation %s ended: %s no longer acting as %s", session.ID, session.ActorID, session.UserID)
+	h.audit(c, "impersonation.end", map[string]string{"impersonation_id": session.ID, "user_id": session.UserID})
+	c.JSON(http.StatusOK, session)
+}
+
+// impersonationIdentity is userIdentity for impersonation tokens. They are never
+// refreshed: once the session expired or was ended the admin is signed back in.
+func (h *Handler) impersonationIdentity(c *gin.Context, claims *manager.CustomClaims, parseErr error) {
+	session, err := h.Repos.Impersonations.Get(c.Request.Context(), claims.Id)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		newResponse(c, http.StatusInternalServerError, "failed to get impersonation: "+err.Error())
+		return
+	}
+	// parseErr can only be an expired token here, other errors come without claims
+	if err != nil || parseErr != nil || !session.Active() || session.ActorID != claims.Actor.Subject {
+		h.restoreImpersonator(c)
+		newResponse(c, http.StatusUnauthorized, domain.ErrImpersonationEnded.Error())
+		return
+	}
+
+	logger.Infof("impersonation %s: %s acting as %s: %s %s", session.ID, session.ActorID, session.UserID, c.Request.Method, c.Request.URL.Path)
+	c.Set(idCtx, claims.UserID)
+	c.Set(roleCtx, claims.Roles)
+	c.Set(activatedCtx, claims.Activated)
+	c.Set(impersonatorCtx, session.ActorID)
+	c.Set(impersonationCtx, session.ID)
+	if !h.Policy.AllowsImpersonation(c.Request.Method, c.FullPath()) {
+		newResponse(c, http.StatusForbidden, domain.ErrImpersonationDenied.Error())
+		return
+	}
+	c.Next()
+}
+
+func (h *Handler) restoreImpersonator(c *gin.Context) {
+	token, err := h.cookie(c, impersonatorCookie)
+	if err != nil {
+		h.deleteCookie(c, jwtCookie)
+		return
+	}
+	h.setCookie(c, jwtCookie, token, seconds(h.Cookies.AccessTTL), true)
+	h.deleteCookie(c, impersonatorCookie)
+}
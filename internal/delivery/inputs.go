@@ -1,5 +1,11 @@
 package delivery
 
+import (
+	proto_reservation "github.com/aidostt/protos/gen/go/reservista/reservation"
+	"reservista.kz/internal/domain"
+	"time"
+)
+
 type userSignUpInput struct {
 	Name     string `json:"name" binding:"required,max=64"`
 	Surname  string `json:"surname" binding:"required,max=64"`
@@ -16,9 +22,11 @@ type restaurantInput struct {
 	Photos  []string `json:"restaurant_photos" binding:"max=64"`
 }
 
+// ReservationTime is an RFC 3339 time, it is stored in the timezone of the restaurant.
 type reservationInput struct {
-	TableID         string `json:"table_id"`
-	ReservationTime string `json:"reservation_time"`
+	TableID         string `json:"table_id" binding:"required"`
+	ReservationTime string `json:"reservation_time" binding:"required"`
+	PartySize       int    `json:"party_size" binding:"required,min=1,max=100"`
 }
 
 type idInput struct {
@@ -26,9 +34,11 @@ type idInput struct {
 }
 
 type reservationUpdateInput struct {
-	ReservationID   string `json:"reservation_id"`
-	TableID         string `json:"table_id"`
-	ReservationTime string `json:"reservation_time"`
+	ReservationID   string `json:"reservation_id" binding:"required"`
+	TableID         string `json:"table_id" binding:"required"`
+	ReservationTime string `json:"reservation_time" binding:"required"`
+	// PartySize keeps the current party size when it is left out
+	PartySize int `json:"party_size" binding:"omitempty,min=1,max=100"`
 }
 
 type tableInput struct {
@@ -53,6 +63,21 @@ type tokenResponse struct {
 	RefreshToken string `json:"refreshToken"`
 }
 
+// userResponse is a user as shown to the caller, fields the caller may not see
+// are left empty.
+type userResponse struct {
+	ID         string               `json:"id,omitempty"`
+	Name       string               `json:"name"`
+	Surname    string               `json:"surname"`
+	Avatar     map[string]string    `json:"avatar,omitempty"`
+	Phone      string               `json:"phone,omitempty"`
+	Email      string               `json:"email,omitempty"`
+	Roles      []string             `json:"roles,omitempty"`
+	Activated  *bool                `json:"activated,omitempty"`
+	Identities []string             `json:"identities,omitempty"`
+	Staff      []domain.StaffMember `json:"staff,omitempty"`
+}
+
 type healthResponse struct {
 	Status string `json:"status"`
 }
@@ -66,6 +91,191 @@ type getUserInput struct {
 	Email string `json:"email"`
 }
 
+type apiKeyInput struct {
+	RestaurantID string   `json:"restaurant_id" binding:"required"`
+	Name         string   `json:"name" binding:"required,max=64"`
+	Scopes       []string `json:"scopes" binding:"required,min=1,dive,oneof=tables:read tables:write reservations:read reservations:write"`
+}
+
+type apiKeyResponse struct {
+	Key string `json:"key"`
+	domain.APIKey
+}
+
+type staffInput struct {
+	UserID string `json:"user_id" binding:"required"`
+	Role   string `json:"role" binding:"required,oneof=restaurantAdmin waiter"`
+}
+
+type staffInviteInput struct {
+	RestaurantID string `json:"restaurant_id" binding:"required"`
+	Email        string `json:"email" binding:"required,email,max=64"`
+}
+
+type roleInput struct {
+	UserID string `json:"user_id" binding:"required"`
+	Role   string `json:"role" binding:"required,oneof=user admin restaurantAdmin waiter"`
+}
+
+type impersonationInput struct {
+	UserID string `json:"user_id" binding:"required"`
+	Reason string `json:"reason" binding:"required,max=256"`
+}
+
 type codeInput struct {
 	Code string `json:"code"`
 }
+
+type bulkUsersInput struct {
+	Action  string   `json:"action" binding:"required,oneof=activate deactivate assign_role"`
+	UserIDs []string `json:"user_ids" binding:"required,min=1,max=100,dive,required"`
+	Role    string   `json:"role" binding:"omitempty,oneof=user admin restaurantAdmin waiter"`
+}
+
+type bulkResult struct {
+	UserID string `json:"user_id"`
+	Status bool   `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type directoryResponse struct {
+	Users      []domain.DirectoryUser `json:"users"`
+	NextCursor string                 `json:"nextCursor,omitempty"`
+}
+
+type suspendInput struct {
+	UserID string     `json:"user_id" binding:"required"`
+	Reason string     `json:"reason" binding:"required,max=512"`
+	Until  *time.Time `json:"until"`
+}
+
+type liftSuspensionInput struct {
+	UserID string `json:"user_id" binding:"required"`
+}
+
+type appealInput struct {
+	Message string `json:"message" binding:"required,max=2048"`
+}
+
+type appealResolutionInput struct {
+	UserID   string `json:"user_id" binding:"required"`
+	Accept   bool   `json:"accept"`
+	Response string `json:"response" binding:"max=2048"`
+}
+
+// restaurantSettingsInput changes the settings that are present.
+type restaurantSettingsInput struct {
+	Timezone     *string `json:"timezone"`
+	MinOccupancy *int    `json:"min_occupancy" binding:"omitempty,min=0,max=100"`
+	// minutes before the start of a reservation
+	FreeCancelMinutes *int `json:"free_cancel_minutes" binding:"omitempty,min=0"`
+	CancelCutoff      *int `json:"cancel_cutoff_minutes" binding:"omitempty,min=0"`
+	MaxPenalties      *int `json:"max_penalties" binding:"omitempty,min=0"`
+}
+
+type availabilitySlot struct {
+	Time         time.Time              `json:"time"`
+	Tables       []availableTable       `json:"tables"`
+	Combinations []availableCombination `json:"combinations,omitempty"`
+}
+
+type availableTable struct {
+	ID          string `json:"id"`
+	TableNumber int32  `json:"table_number"`
+	Seats       int32  `json:"seats"`
+}
+
+type availableCombination struct {
+	ID     string           `json:"id"`
+	Tables []availableTable `json:"tables"`
+	Seats  int32            `json:"seats"`
+}
+
+type tableCombinationInput struct {
+	TableIDs []string `json:"table_ids" binding:"required,min=2,max=10,dive=required"`
+}
+
+type combinationReservationInput struct {
+	CombinationID   string `json:"combination_id" binding:"required"`
+	ReservationTime string `json:"reservation_time" binding:"required"`
+	PartySize       int    `json:"party_size" binding:"required,min=1,max=100"`
+}
+
+// reservationResponse is a reservation of the reservation service along with the
+// details kept by the gateway.
+type reservationResponse struct {
+	*proto_reservation.ReservationObject
+	PartySize int      `json:"party_size,omitempty"`
+	Status    string   `json:"status,omitempty"`
+	Actions   []string `json:"actions,omitempty"`
+	// GuestConfirmedAt is set once the guest confirmed from a reminder
+	GuestConfirmedAt *time.Time `json:"guest_confirmed_at,omitempty"`
+}
+
+type reservationStatusResponse struct {
+	ReservationID string   `json:"reservation_id"`
+	Status        string   `json:"status"`
+	Actions       []string `json:"actions"`
+	Penalty       string   `json:"penalty,omitempty"`
+	// Failed lists the reservations of the group the action could not be taken on.
+	Failed []string `json:"failed,omitempty"`
+}
+
+type declineInput struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+type waitlistInput struct {
+	From      string `json:"from" binding:"required"`
+	To        string `json:"to" binding:"required"`
+	PartySize int    `json:"party_size" binding:"required,min=1,max=100"`
+}
+
+// waitlistResponse is a waitlist entry with the place of a waiting guest in the
+// queue, counting from 1.
+type waitlistResponse struct {
+	domain.WaitlistEntry
+	Position int `json:"position,omitempty"`
+}
+
+type seriesReservationInput struct {
+	TableID         string `json:"table_id" binding:"required"`
+	ReservationTime string `json:"reservation_time" binding:"required"`
+	PartySize       int    `json:"party_size" binding:"required,min=1,max=100"`
+	// RRule is an RFC 5545 recurrence rule, e.g. FREQ=WEEKLY;UNTIL=20241231
+	RRule         string `json:"rrule" binding:"required,max=200"`
+	SkipConflicts bool   `json:"skip_conflicts"`
+}
+
+type skipOccurrenceInput struct {
+	Date string `json:"date" binding:"required"`
+}
+
+type seriesResponse struct {
+	domain.ReservationSeries
+	Occurrences []occurrenceResponse `json:"occurrences"`
+}
+
+type occurrenceResponse struct {
+	domain.SeriesOccurrence
+	ReservationStatus string `json:"reservationStatus,omitempty"`
+}
+
+type seriesConflictResponse struct {
+	Message   string      `json:"message"`
+	Conflicts []time.Time `json:"conflicts"`
+}
+
+// seriesChangeResponse lists the occurrences the cancellation policy kept booked,
+// and the number of late cancellations recorded.
+type seriesChangeResponse struct {
+	Series    seriesResponse   `json:"series"`
+	Kept      []keptOccurrence `json:"kept,omitempty"`
+	Penalties int              `json:"penalties"`
+}
+
+type keptOccurrence struct {
+	Start         time.Time `json:"start"`
+	ReservationID string    `json:"reservationID"`
+	Reason        string    `json:"reason"`
+}
@@ -0,0 +1,293 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	proto_reservation "github.com/aidostt/protos/gen/go/reservista/reservation"
+	proto_user "github.com/aidostt/protos/gen/go/reservista/user"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"reservista.kz/internal/domain"
+	"reservista.kz/pkg/logger"
+	"strconv"
+	"time"
+)
+
+func (h *Handler) seatReservation(c *gin.Context) {
+	h.changeStatus(c, "seat", domain.ActorStaff, "")
+}
+
+func (h *Handler) completeReservation(c *gin.Context) {
+	h.changeStatus(c, "complete", domain.ActorStaff, "")
+}
+
+// declineReservation cancels a reservation on behalf of the restaurant and tells
+// the guest why.
+func (h *Handler) declineReservation(c *gin.Context) {
+	var input declineInput
+	if err := c.BindJSON(&input); err != nil {
+		h.bindingError(c, err)
+		return
+	}
+	reservation, ok := h.changeStatus(c, "decline", domain.ActorStaff, input.Reason)
+	if !ok {
+		return
+	}
+	email, err := h.guestEmail(c.Request.Context(), reservation.GetUserID())
+	if err == nil {
+		err = h.sendMail(c.Request.Context(), email, "reservationDeclined", map[string]interface{}{
+			"Start":  h.reservationStart(c.Request.Context(), reservation),
+			"Reason": input.Reason,
+		})
+	}
+	if err != nil {
+		logger.Errorf("failed to notify the guest of declined reservation %s: %v", reservation.GetId(), err)
+	}
+}
+
+func (h *Handler) markNoShow(c *gin.Context) {
+	h.changeStatus(c, "no-show", domain.ActorStaff, "")
+}
+
+// cancelReservation is the guest's cancellation, within the cancellation policy of
+// the restaurant.
+func (h *Handler) cancelReservation(c *gin.Context) {
+	h.changeStatus(c, "cancel", domain.ActorGuest, "")
+}
+
+// changeStatus takes an action on the reservation of the URL and on the rest of
+// its group, if it was booked with a table combination. Late cancellations and
+// no-shows are recorded as penalties of the guest. It writes the response itself
+// and returns the reservation when the action was taken.
+func (h *Handler) changeStatus(c *gin.Context, action, actor, reason string) (*proto_reservation.ReservationObject, bool) {
+	id := c.Param("id")
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return nil, false
+	}
+	defer conn.Close()
+	client := proto_reservation.NewReservationClient(conn)
+
+	reservation, err := client.GetReservation(c.Request.Context(), &proto_reservation.IDRequest{Id: id})
+	if err != nil {
+		h.reservationServiceError(c, err)
+		return nil, false
+	}
+	if actor == domain.ActorGuest && reservation.GetUserID() != c.GetString(idCtx) {
+		newResponse(c, http.StatusForbidden, "access denied: not your reservation")
+		return nil, false
+	}
+	details, err := h.reservationDetails(c.Request.Context(), reservation)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get reservation details: "+err.Error())
+		return nil, false
+	}
+	start, now := h.reservationStart(c.Request.Context(), reservation), time.Now()
+	to, err := domain.Transition(details.Status, action, actor, start, now)
+	if err != nil {
+		newResponse(c, http.StatusConflict, err.Error())
+		return nil, false
+	}
+	restaurantID := details.RestaurantID
+	if restaurantID == "" {
+		if restaurantID, err = h.restaurantOfReservation(c.Request.Context(), id); err != nil {
+			h.reservationServiceError(c, err)
+			return nil, false
+		}
+		details.RestaurantID = restaurantID
+	}
+	var penalty string
+	switch action {
+	case "cancel":
+		settings, err := h.restaurantSettings(c.Request.Context(), restaurantID)
+		if err != nil {
+			newResponse(c, http.StatusInternalServerError, "failed to get restaurant settings: "+err.Error())
+			return nil, false
+		}
+		if penalty, err = settings.Cancellation.CheckCancel(start, now); err != nil {
+			newResponse(c, http.StatusConflict, err.Error())
+			return nil, false
+		}
+	case "no-show":
+		penalty = domain.PenaltyNoShow
+	}
+
+	// the primary goes first, so a failure leaves the rest of the group untouched
+	group := []domain.ReservationDetails{details}
+	if details.GroupID != "" {
+		members, err := h.Repos.Reservations.GetByGroup(c.Request.Context(), details.GroupID)
+		if err != nil {
+			newResponse(c, http.StatusInternalServerError, "failed to get reservation details: "+err.Error())
+			return nil, false
+		}
+		for _, member := range members {
+			if member.ReservationID == id {
+				continue
+			}
+			if _, err := domain.Transition(member.Status, action, actor, start, now); err != nil {
+				newResponse(c, http.StatusConflict, "reservation "+member.ReservationID+" of the group: "+err.Error())
+				return nil, false
+			}
+			group = append(group, member)
+		}
+	}
+	event := domain.ReservationEvent{Action: action, From: details.Status, To: to, By: c.GetString(idCtx), At: now, Reason: reason}
+	var failed []string
+	for i, member := range group {
+		var err error
+		switch action {
+		case "confirm":
+			// the reservation service keeps its own confirmed flag
+			_, err = client.ConfirmReservation(c.Request.Context(), &proto_reservation.IDRequest{Id: member.ReservationID})
+		case "cancel", "decline", "no-show":
+			// the table is only free again once the reservation service dropped it
+			err = deleteReservation(c.Request.Context(), client, member.ReservationID)
+		}
+		if err != nil && i == 0 {
+			h.reservationServiceError(c, err)
+			return nil, false
+		}
+		if err == nil {
+			memberEvent := event
+			memberEvent.From = member.Status
+			member.Status = to
+			member.History = append(member.History, memberEvent)
+			err = h.Repos.Reservations.Save(c.Request.Context(), member)
+		}
+		if err != nil {
+			if i == 0 {
+				newResponse(c, http.StatusInternalServerError, "failed to save reservation status: "+err.Error())
+				return nil, false
+			}
+			// the primary has already changed, the guest gets the members left behind
+			logger.Errorf("failed to %s reservation %s of the group of %s: %v", action, member.ReservationID, id, err)
+			failed = append(failed, member.ReservationID)
+		}
+	}
+	if penalty != "" {
+		h.addPenalty(c.Request.Context(), reservation.GetUserID(), restaurantID, id, penalty, now)
+	}
+	h.audit(c, "reservation."+action, map[string]string{"status": to})
+	c.JSON(http.StatusOK, reservationStatusResponse{
+		ReservationID: id,
+		Status:        to,
+		Actions:       domain.NextActions(to, actor, start, now),
+		Penalty:       penalty,
+		Failed:        failed,
+	})
+	if action == "cancel" || action == "decline" {
+		h.offerTables(c.Request.Context(), restaurantID, start)
+	}
+	return reservation, true
+}
+
+// deleteReservation drops a reservation in the reservation service, the gateway
+// keeps its details and history.
+func deleteReservation(ctx context.Context, client proto_reservation.ReservationClient, id string) error {
+	statusResponse, err := client.DeleteReservationById(ctx, &proto_reservation.IDRequest{Id: id})
+	if err != nil {
+		return err
+	}
+	if !statusResponse.GetStatus() {
+		return status.Error(codes.Internal, "reservation service failed to delete reservation "+id)
+	}
+	return nil
+}
+
+// addPenalty records a late cancellation or no-show of the guest. Failures are
+// only logged, the status change is what counts.
+func (h *Handler) addPenalty(ctx context.Context, userID, restaurantID, reservationID, kind string, now time.Time) {
+	err := h.Repos.Penalties.Add(ctx, domain.GuestPenalty{
+		ID:            primitive.NewObjectID().Hex(),
+		UserID:        userID,
+		RestaurantID:  restaurantID,
+		ReservationID: reservationID,
+		Kind:          kind,
+		CreatedAt:     now,
+	})
+	if err != nil {
+		logger.Errorf("failed to record %s of reservation %s: %v", kind, reservationID, err)
+	}
+}
+
+// reservationDetails returns the details kept for a reservation. Reservations made
+// before the gateway kept any get their status from the reservation service.
+func (h *Handler) reservationDetails(ctx context.Context, reservation *proto_reservation.ReservationObject) (domain.ReservationDetails, error) {
+	details, err := h.Repos.Reservations.Get(ctx, reservation.GetId())
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return domain.ReservationDetails{}, err
+	}
+	if details.ReservationID == "" {
+		details = domain.ReservationDetails{
+			ReservationID: reservation.GetId(),
+			UserID:        reservation.GetUserID(),
+			TableID:       reservation.GetTable().GetId(),
+		}
+	}
+	if details.Status == "" {
+		details.Status = domain.ReservationPending
+		if reservation.GetConfirmed() {
+			details.Status = domain.ReservationConfirmed
+		}
+	}
+	return details, nil
+}
+
+// guestEmail looks up where mails to a guest go.
+func (h *Handler) guestEmail(ctx context.Context, userID string) (string, error) {
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Users)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	user, err := proto_user.NewUserClient(conn).GetByID(ctx, &proto_user.GetRequest{
+		UserId: userID,
+		Email:  domain.Plug,
+	})
+	if err != nil {
+		return "", err
+	}
+	return user.GetEmail(), nil
+}
+
+func (h *Handler) getGuestPenalties(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		newValidationResponse(c, map[string]string{"user_id": "is required"})
+		return
+	}
+	penalties, err := h.Repos.Penalties.GetByUser(c.Request.Context(), c.Param("id"), userID)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get penalties: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, penalties)
+}
+
+// checkPenalties refuses guests who reached the penalty limit of the restaurant.
+// It writes the error response itself and reports whether the guest may book.
+func (h *Handler) checkPenalties(c *gin.Context, restaurantID, userID string) bool {
+	settings, err := h.restaurantSettings(c.Request.Context(), restaurantID)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get restaurant settings: "+err.Error())
+		return false
+	}
+	if settings.Cancellation.MaxPenalties == 0 {
+		return true
+	}
+	penalties, err := h.Repos.Penalties.GetByUser(c.Request.Context(), restaurantID, userID)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get penalties: "+err.Error())
+		return false
+	}
+	if len(penalties) >= settings.Cancellation.MaxPenalties {
+		newResponse(c, http.StatusForbidden, "the restaurant doesn't take reservations from guests with "+
+			strconv.Itoa(settings.Cancellation.MaxPenalties)+" late cancellations or no-shows")
+		return false
+	}
+	return true
+}
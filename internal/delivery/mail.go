@@ -0,0 +1,77 @@
+package delivery
+
+import (
+	"context"
+	proto_mailer "github.com/aidostt/protos/gen/go/reservista/mailer"
+	"strings"
+	"text/template"
+)
+
+// mailTemplates are the notices the gateway sends itself. The mailer only has
+// templates for its own flows, and of its calls only SendWelcome and SendAuthCode
+// take content. SendAuthCode presents the content as a one-time code, and
+// SendReminder, which has the right subject for reminders, takes no content to
+// carry their confirm and cancel links. So every notice goes out as the content
+// of SendWelcome, whose subject and layout are the most neutral around it, until
+// the mailer gets a call for gateway notices.
+var mailTemplates = template.Must(template.New("mail").Parse(`
+{{- define "staffInvite" -}}
+You are invited to join the staff of {{.Restaurant}} as {{.Role}}.
+Sign in with {{.Email}} and accept the invite at {{.Link}} before {{.ExpiresAt.Format "2006-01-02 15:04 MST"}}.
+{{- end -}}
+
+{{- define "waitlistOffer" -}}
+A table for {{.PartySize}} at {{.Start.Format "2006-01-02 15:04"}} is free for you until {{.ExpiresAt.Format "15:04"}}.
+Book it at {{.Link}}.
+{{- end -}}
+
+{{- define "reminder" -}}
+Reminder: you have a reservation{{with .Restaurant}} at {{.}}{{end}} on {{.Start.Format "2006-01-02 15:04"}}.
+Confirm you are coming: {{.ConfirmURL}}
+Can't make it? Cancel: {{.CancelURL}}
+{{- end -}}
+
+{{- define "reservationDeclined" -}}
+Your reservation for {{.Start.Format "2006-01-02 15:04"}} was cancelled by the restaurant. Reason: {{.Reason}}
+{{- end -}}
+
+{{- define "suspended" -}}
+Your account is suspended {{.End}}. Reason: {{.Reason}}
+You can appeal once at {{.Link}}.
+{{- end -}}
+
+{{- define "suspensionLifted" -}}
+Your account suspension has been lifted, you can sign in again.
+{{- end -}}
+
+{{- define "appealResolved" -}}
+{{if .Accepted}}Your appeal was accepted and the suspension has been lifted.
+{{- else}}Your appeal was rejected, the suspension stays in place.{{end}}
+{{- with .Response}} {{.}}{{end}}
+{{- end -}}
+`))
+
+// sendMail renders the template name with data and mails it to email, as the
+// content of the welcome mail, see mailTemplates.
+func (h *Handler) sendMail(ctx context.Context, email, name string, data interface{}) error {
+	var content strings.Builder
+	if err := mailTemplates.ExecuteTemplate(&content, name, data); err != nil {
+		return err
+	}
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Notifications)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = proto_mailer.NewMailerClient(conn).SendWelcome(ctx, &proto_mailer.ContentInput{
+		Email:   email,
+		Content: content.String(),
+	})
+	return err
+}
+
+// link returns the address of a gateway path as the users reach it, for links in
+// mails.
+func (h *Handler) link(path string) string {
+	return strings.TrimSuffix(h.PublicURL, "/") + path
+}
@@ -1,21 +1,52 @@
 package delivery
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"reservista.kz/internal/domain"
+	manager "reservista.kz/pkg/manager"
 )
 
 const (
 	authorizationHeader = "Authorization"
+	apiKeyHeader        = "X-API-Key"
 
 	idCtx        = "userId"
 	roleCtx      = "userRoles"
 	activatedCtx = "userActivated"
+	apiKeyCtx    = "apiKey"
 )
 
 func (h *Handler) userIdentity(c *gin.Context) {
-	id, roles, activated, err := h.parseAuthHeader(c)
+	// the cookies authenticate the request, so an API key it carries doesn't
+	// exempt it from the csrf check
+	if c.GetBool(csrfPendingCtx) && !h.checkCSRF(c) {
+		return
+	}
+	claims, err := h.parseAuthHeader(c)
+	if claims != nil && claims.Actor != nil {
+		h.impersonationIdentity(c, claims, err)
+		return
+	}
+	if claims != nil {
+		erased, erasedErr := h.isErased(c.Request.Context(), claims.UserID)
+		if erasedErr != nil {
+			newResponse(c, http.StatusInternalServerError, "failed to check erasure: "+erasedErr.Error())
+			return
+		}
+		if erased {
+			newResponse(c, http.StatusUnauthorized, "unauthorized access: account was erased")
+			return
+		}
+		if !h.checkSuspension(c, claims.UserID) {
+			return
+		}
+	}
+	if errors.Is(err, http.ErrNoCookie) && h.hasSessionCookie(c) {
+		// the jwt cookie expired along with the access token
+		err = domain.ErrTokenExpired
+	}
 	if err != nil {
 		switch err.Error() {
 		case domain.ErrTokenExpired.Error():
@@ -29,56 +60,53 @@ func (h *Handler) userIdentity(c *gin.Context) {
 			newResponse(c, http.StatusInternalServerError, "failed to parse jwt to id: "+err.Error())
 			return
 		}
+		claims = &manager.CustomClaims{}
 	}
 
-	c.Set(idCtx, id)
-	c.Set(roleCtx, roles)
-	c.Set(activatedCtx, activated)
+	c.Set(idCtx, claims.UserID)
+	c.Set(roleCtx, claims.Roles)
+	c.Set(activatedCtx, claims.Activated)
 	c.Next()
 }
-func (h *Handler) parseAuthHeader(c *gin.Context) (string, []string, bool, error) {
-	token, err := c.Cookie("jwt")
-	if err != nil {
-		return "", nil, false, err
-	}
-	id, roles, activated, err := h.TokenManager.Parse(token)
-	if err != nil {
-		return "", nil, false, err
-	}
-	return id, roles, activated, nil
-}
 
-func (h *Handler) isPermitted(permittedRoles []string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userRoles, exists := c.Get(roleCtx)
-
-		if !exists {
-			newResponse(c, http.StatusUnauthorized, "unauthorized access: missing roles")
+// apiKeyIdentity authenticates partner systems. The key acts with the integration
+// role only, so policy rules have to permit it explicitly and check its scopes.
+func (h *Handler) apiKeyIdentity(c *gin.Context) {
+	key, err := h.authenticateAPIKey(c.Request.Context(), c.GetHeader(apiKeyHeader))
+	if err != nil {
+		if errors.Is(err, domain.ErrAPIKeyInvalid) {
+			newResponse(c, http.StatusUnauthorized, "unauthorized access: "+err.Error())
 			return
 		}
-
-		if !hasAnyPermittedRole(userRoles.([]string), permittedRoles) {
-			newResponse(c, http.StatusUnauthorized, "unauthorized access: access denied due to RBAC missing")
-		}
-		c.Next()
+		newResponse(c, http.StatusInternalServerError, "failed to authenticate api key: "+err.Error())
+		return
 	}
-}
 
-func (h *Handler) isActivated() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		activated, exists := c.Get(activatedCtx)
+	c.Set(idCtx, key.ID)
+	c.Set(roleCtx, []string{domain.IntegrationRole})
+	c.Set(activatedCtx, true)
+	c.Set(apiKeyCtx, key)
+	c.Next()
+}
 
-		if !exists {
-			newResponse(c, http.StatusUnauthorized, "unauthorized access: missing activated field")
-			return
-		}
+// userOrAPIKeyIdentity uses the API key when the request carries one and falls
+// back to the jwt cookie otherwise.
+func (h *Handler) userOrAPIKeyIdentity(c *gin.Context) {
+	if c.GetHeader(apiKeyHeader) != "" {
+		h.apiKeyIdentity(c)
+		return
+	}
+	h.userIdentity(c)
+}
 
-		if !activated.(bool) {
-			newResponse(c, http.StatusPartialContent, "activate your account first")
-			return
-		}
-		c.Next()
+// parseAuthHeader returns the claims of the jwt cookie. The claims of an expired
+// token are returned along with the error.
+func (h *Handler) parseAuthHeader(c *gin.Context) (*manager.CustomClaims, error) {
+	token, err := h.cookie(c, jwtCookie)
+	if err != nil {
+		return nil, err
 	}
+	return h.TokenManager.ParseClaims(token)
 }
 
 // hasAnyPermittedRole checks if there's any intersection between userRoles and permittedRoles.
@@ -96,17 +124,3 @@ func hasAnyPermittedRole(userRoles []string, permittedRoles []string) bool {
 
 	return false
 }
-
-func corsMiddleware(c *gin.Context) {
-	c.Header("Access-Control-Allow-Origin", "http://localhost:3000")
-	c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, UPDATE, OPTIONS")
-	c.Header("Access-Control-Allow-Headers", "X-PINGOTHER, Content-Type")
-	c.Header("Content-Type", "application/json")
-	c.Header("Access-Control-Allow-Credentials", "true")
-
-	if c.Request.Method != "OPTIONS" {
-		c.Next()
-	} else {
-		c.AbortWithStatus(http.StatusOK)
-	}
-}
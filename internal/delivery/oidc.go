@@ -0,0 +1,329 @@
+package delivery
+
+import (
+	"crypto/subtle"
+	"errors"
+	proto_auth "github.com/aidostt/protos/gen/go/reservista/authentication"
+	proto_user "github.com/aidostt/protos/gen/go/reservista/user"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"reservista.kz/internal/domain"
+	"reservista.kz/pkg/oidc"
+	"strings"
+	"time"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStatePath   = "/api/auth/oidc"
+)
+
+func (h *Handler) oidcLogin(c *gin.Context) {
+	h.startOIDC(c, "")
+}
+
+func (h *Handler) oidcLink(c *gin.Context) {
+	userID, exists := c.Get(idCtx)
+	if !exists {
+		newResponse(c, http.StatusUnauthorized, "missing id in context")
+		return
+	}
+	h.startOIDC(c, userID.(string))
+}
+
+// startOIDC redirects the user agent to the provider. When linkUserID is set the
+// callback attaches the external account to that user instead of signing in.
+func (h *Handler) startOIDC(c *gin.Context, linkUserID string) {
+	provider, ok := h.OIDC[c.Param("provider")]
+	if !ok {
+		newResponse(c, http.StatusNotFound, domain.ErrProviderNotFound.Error())
+		return
+	}
+	state, err := oidc.RandomString(32)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return
+	}
+	nonce, err := oidc.RandomString(32)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return
+	}
+	verifier, err := oidc.RandomString(32)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return
+	}
+	authURL := provider.AuthCodeURL(state, nonce, oidc.CodeChallenge(verifier))
+	if authURL == "" {
+		newResponse(c, http.StatusBadGateway, "identity provider is unavailable")
+		return
+	}
+	err = h.Repos.OIDCStates.Save(c.Request.Context(), domain.OIDCState{
+		State:        state,
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().Add(h.OIDCStateTTL),
+	})
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to save oidc state: "+err.Error())
+		return
+	}
+	h.setOIDCStateCookie(c, state, seconds(h.OIDCStateTTL))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+func (h *Handler) oidcCallback(c *gin.Context) {
+	provider, ok := h.OIDC[c.Param("provider")]
+	if !ok {
+		newResponse(c, http.StatusNotFound, domain.ErrProviderNotFound.Error())
+		return
+	}
+	// Apple posts the response as a form, everyone else redirects with a query.
+	param := c.Query
+	if c.Request.Method == http.MethodPost {
+		param = c.PostForm
+	}
+	if providerErr := param("error"); providerErr != "" {
+		newResponse(c, http.StatusUnauthorized, "identity provider denied access: "+providerErr)
+		return
+	}
+	code, stateParam := param("code"), param("state")
+	if code == "" || stateParam == "" {
+		newResponse(c, http.StatusBadRequest, "missing code or state")
+		return
+	}
+	// the state cookie binds the flow to the browser that started it
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie), []byte(stateParam)) != 1 {
+		newResponse(c, http.StatusBadRequest, domain.ErrOIDCStateInvalid.Error())
+		return
+	}
+	h.setOIDCStateCookie(c, "", -1)
+
+	state, err := h.Repos.OIDCStates.Pop(c.Request.Context(), stateParam)
+	if err != nil || state.Provider != provider.Name() {
+		newResponse(c, http.StatusBadRequest, domain.ErrOIDCStateInvalid.Error())
+		return
+	}
+
+	identity, err := provider.Exchange(c.Request.Context(), code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrInvalidIDToken), errors.Is(err, oidc.ErrNonceMismatch):
+			newResponse(c, http.StatusUnauthorized, err.Error())
+		default:
+			newResponse(c, http.StatusBadGateway, "failed to exchange authorization code: "+err.Error())
+		}
+		return
+	}
+
+	if state.LinkUserID != "" {
+		h.linkIdentity(c, state.LinkUserID, identity)
+		return
+	}
+
+	linked, err := h.Repos.Identities.Get(c.Request.Context(), identity.Provider, identity.Subject)
+	switch {
+	case err == nil:
+		h.signInByID(c, linked.UserID)
+	case errors.Is(err, domain.ErrNotFound):
+		h.signUpWithIdentity(c, identity)
+	default:
+		newResponse(c, http.StatusInternalServerError, "failed to get identity: "+err.Error())
+	}
+}
+
+// linkIdentity attaches the external account to a signed in user. The provider has
+// to vouch for the same email the user has registered with.
+func (h *Handler) linkIdentity(c *gin.Context, userID string, identity *oidc.Identity) {
+	if !identity.EmailVerified {
+		newResponse(c, http.StatusForbidden, domain.ErrEmailNotVerified.Error())
+		return
+	}
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Users)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return
+	}
+	defer conn.Close()
+	user, err := proto_user.NewUserClient(conn).GetByID(c.Request.Context(), &proto_user.GetRequest{
+		UserId: userID,
+		Email:  domain.Plug,
+	})
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get user: "+err.Error())
+		return
+	}
+	if !strings.EqualFold(user.GetEmail(), identity.Email) {
+		newResponse(c, http.StatusForbidden, "provider email doesn't match the account email")
+		return
+	}
+	err = h.Repos.Identities.Create(c.Request.Context(), domain.Identity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		UserID:   userID,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrAlreadyExists) {
+			newResponse(c, http.StatusConflict, domain.ErrIdentityLinked.Error())
+			return
+		}
+		newResponse(c, http.StatusInternalServerError, "failed to link identity: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, StatusResponse{Status: true})
+}
+
+// signUpWithIdentity registers a new user for an unknown external account. Existing
+// accounts are never taken over implicitly, their owners have to link the provider.
+func (h *Handler) signUpWithIdentity(c *gin.Context, identity *oidc.Identity) {
+	if !identity.EmailVerified || identity.Email == "" {
+		newResponse(c, http.StatusForbidden, domain.ErrEmailNotVerified.Error())
+		return
+	}
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Users)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return
+	}
+	defer conn.Close()
+	userClient := proto_user.NewUserClient(conn)
+
+	_, err = userClient.GetByEmail(c.Request.Context(), &proto_user.GetRequest{
+		UserId: domain.Plug,
+		Email:  identity.Email,
+	})
+	if err == nil {
+		newResponse(c, http.StatusConflict, domain.ErrAccountNeedsLink.Error())
+		return
+	}
+	if st, ok := status.FromError(err); !ok || (st.Code() != codes.NotFound && st.Code() != codes.InvalidArgument) {
+		newResponse(c, http.StatusInternalServerError, "failed to look up user by email: "+err.Error())
+		return
+	}
+
+	// The account is only ever used through the provider, so the password is
+	// random and never shown to anyone.
+	password, err := oidc.RandomString(32)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return
+	}
+	resp, err := proto_auth.NewAuthClient(conn).SignUp(c.Request.Context(), &proto_auth.SignUpRequest{
+		Name:     valueOrPlug(identity.GivenName),
+		Surname:  valueOrPlug(identity.FamilyName),
+		Phone:    domain.Plug,
+		Email:    identity.Email,
+		Password: password,
+	})
+	if err != nil {
+		st, ok := status.FromError(err)
+		if !ok {
+			newResponse(c, http.StatusInternalServerError, "unknown error when calling sign up:"+err.Error())
+			return
+		}
+		switch st.Code() {
+		case codes.AlreadyExists:
+			newResponse(c, http.StatusConflict, domain.ErrAccountNeedsLink.Error())
+		case codes.Internal:
+			newResponse(c, http.StatusInternalServerError, "microservice failed to execute functionality:"+err.Error())
+		default:
+			newResponse(c, http.StatusInternalServerError, "unknown error when calling sign up:"+err.Error())
+		}
+		return
+	}
+	userID, _, _, err := h.TokenManager.Parse(resp.GetTokens().GetJwt())
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to parse jwt to id: "+err.Error())
+		return
+	}
+	// the provider has already verified the email, no activation code is needed
+	_, err = userClient.Activate(c.Request.Context(), &proto_user.ActivateRequest{
+		UserID:   userID,
+		Activate: true,
+	})
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to activate user: "+err.Error())
+		return
+	}
+	err = h.Repos.Identities.Create(c.Request.Context(), domain.Identity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		UserID:   userID,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to link identity: "+err.Error())
+		return
+	}
+	h.signInByID(c, userID)
+}
+
+// signInByID opens a new session for the user and sets the usual jwt and RT cookies.
+func (h *Handler) signInByID(c *gin.Context, userID string) {
+	if !h.checkSuspension(c, userID) {
+		return
+	}
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Users)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return
+	}
+	defer conn.Close()
+	user, err := proto_user.NewUserClient(conn).GetByID(c.Request.Context(), &proto_user.GetRequest{
+		UserId: userID,
+		Email:  domain.Plug,
+	})
+	if err != nil {
+		st, ok := status.FromError(err)
+		if !ok {
+			newResponse(c, http.StatusInternalServerError, "unknown error when getting user:"+err.Error())
+			return
+		}
+		switch st.Code() {
+		case codes.NotFound, codes.InvalidArgument:
+			newResponse(c, http.StatusUnauthorized, domain.ErrUserNotFound.Error())
+		default:
+			newResponse(c, http.StatusInternalServerError, "unknown error when getting user:"+err.Error())
+		}
+		return
+	}
+	tokens, err := proto_auth.NewAuthClient(conn).CreateSession(c.Request.Context(), &proto_auth.CreateRequest{
+		Id:        userID,
+		Roles:     user.GetRoles(),
+		Activated: user.GetActivated(),
+	})
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to create session: "+err.Error())
+		return
+	}
+	h.recordProfile(c.Request.Context(), userID, user)
+	h.setCookies(c, tokenResponse{
+		AccessToken:  tokens.Jwt,
+		RefreshToken: tokens.Rt,
+	})
+	c.JSON(http.StatusOK, tokens)
+}
+
+func valueOrPlug(value string) string {
+	if value == "" {
+		return domain.Plug
+	}
+	return value
+}
+
+// setOIDCStateCookie follows the cookie policy except for the path, SameSite and
+// Secure. The state is only needed by the callback, so the cookie can't have the
+// __Host- prefix, and it has to come along with the provider's cross-site form
+// post, which only SameSite=None cookies do. Browsers require those to be secure,
+// localhost counts as a secure origin for that.
+func (h *Handler) setOIDCStateCookie(c *gin.Context, state string, maxAge int) {
+	c.SetSameSite(http.SameSiteNoneMode)
+	c.SetCookie(oidcStateCookie, state, maxAge, oidcStatePath, h.Cookies.Domain, true, true)
+}
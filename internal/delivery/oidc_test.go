@@ -0,0 +1,96 @@
+package delivery
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reservista.kz/internal/repository"
+	"reservista.kz/pkg/oidc"
+	"strings"
+	"testing"
+	"time"
+)
+
+// formPostProvider answers like Apple, which posts the callback as a form.
+type formPostProvider struct {
+	exchanged bool
+}
+
+func (p *formPostProvider) Name() string { return "apple" }
+
+func (p *formPostProvider) AuthCodeURL(state, _, _ string) string {
+	return "https://provider.example/authorize?state=" + state
+}
+
+func (p *formPostProvider) Exchange(context.Context, string, string, string) (*oidc.Identity, error) {
+	p.exchanged = true
+	return nil, oidc.ErrInvalidIDToken
+}
+
+func newOIDCTestRouter(provider oidc.Provider) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := &Handler{
+		Repos:        repository.NewRepositories(10),
+		OIDC:         map[string]oidc.Provider{provider.Name(): provider},
+		OIDCStateTTL: time.Minute,
+	}
+	router := gin.New()
+	router.GET("/api/auth/oidc/:provider/login", h.oidcLogin)
+	router.POST("/api/auth/oidc/:provider/callback", h.oidcCallback)
+	return router
+}
+
+func TestOIDCFormPostCallbackIsBoundToBrowser(t *testing.T) {
+	provider := &formPostProvider{}
+	router := newOIDCTestRouter(provider)
+
+	login := httptest.NewRecorder()
+	router.ServeHTTP(login, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/apple/login", nil))
+	if login.Code != http.StatusFound {
+		t.Fatalf("login status = %d, want %d", login.Code, http.StatusFound)
+	}
+	var stateCookie *http.Cookie
+	for _, cookie := range login.Result().Cookies() {
+		if cookie.Name == oidcStateCookie {
+			stateCookie = cookie
+		}
+	}
+	if stateCookie == nil {
+		t.Fatal("login didn't set the state cookie")
+	}
+	if stateCookie.SameSite != http.SameSiteNoneMode || !stateCookie.Secure {
+		t.Errorf("state cookie SameSite = %v, Secure = %v, want None and secure so form posts carry it", stateCookie.SameSite, stateCookie.Secure)
+	}
+
+	tests := []struct {
+		name     string
+		cookie   string
+		wantCode int
+	}{
+		{name: "no cookie", wantCode: http.StatusBadRequest},
+		{name: "cookie of another flow", cookie: "another-state", wantCode: http.StatusBadRequest},
+		// the exchange fails on purpose, reaching it means the state was accepted
+		{name: "cookie of this flow", cookie: stateCookie.Value, wantCode: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider.exchanged = false
+			form := url.Values{"code": {"code"}, "state": {stateCookie.Value}}
+			req := httptest.NewRequest(http.MethodPost, "/api/auth/oidc/apple/callback", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Errorf("callback status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if provider.exchanged != (tt.wantCode == http.StatusUnauthorized) {
+				t.Errorf("code exchanged = %v", provider.exchanged)
+			}
+		})
+	}
+}
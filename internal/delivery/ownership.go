@@ -0,0 +1,71 @@
+package delivery
+
+import (
+	"context"
+	proto_reservation "github.com/aidostt/protos/gen/go/reservista/reservation"
+	proto_table "github.com/aidostt/protos/gen/go/reservista/table"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// restaurantOfTable resolves the restaurant of a table for ownership rules.
+func (h *Handler) restaurantOfTable(ctx context.Context, id string) (string, error) {
+	table, err := h.fetchTable(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return table.GetRestaurant().GetId(), nil
+}
+
+func (h *Handler) fetchTable(ctx context.Context, id string) (*proto_table.TableObject, error) {
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return proto_table.NewTableClient(conn).GetTable(ctx, &proto_table.IDRequest{Id: id})
+}
+
+// restaurantOfReservation resolves the restaurant of a reservation for ownership rules.
+func (h *Handler) restaurantOfReservation(ctx context.Context, id string) (string, error) {
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	restaurant, err := proto_reservation.NewReservationClient(conn).GetRestaurantByReservationId(ctx, &proto_reservation.IDRequest{Id: id})
+	if err != nil {
+		return "", err
+	}
+	return restaurant.GetId(), nil
+}
+
+// guestOfReservation resolves the user who made a reservation for ownership rules.
+func (h *Handler) guestOfReservation(ctx context.Context, id string) (string, error) {
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	reservation, err := proto_reservation.NewReservationClient(conn).GetReservation(ctx, &proto_reservation.IDRequest{Id: id})
+	if err != nil {
+		return "", err
+	}
+	return reservation.GetUserID(), nil
+}
+
+// authorizeRestaurant checks that the caller is staff of the restaurant, for
+// handlers that only learn the restaurant from the request body. It writes the
+// error response itself and reports whether the handler may proceed.
+func (h *Handler) authorizeRestaurant(c *gin.Context, restaurantID string, staffRoles ...string) bool {
+	violation, err := h.Policy.CheckRestaurant(c.Request.Context(), h.policySubject(c), restaurantID, staffRoles...)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get staff membership: "+err.Error())
+		return false
+	}
+	if violation != nil {
+		newResponse(c, violation.Status, violation.Reason)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,180 @@
+package delivery
+
+import (
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"reservista.kz/internal/domain"
+	"reservista.kz/internal/policy"
+	"strings"
+)
+
+const policyDecisionCtx = "policyDecision"
+
+// authorize evaluates the policy rules of the matched route. It has to run after
+// the identity middleware of the group.
+func (h *Handler) authorize(c *gin.Context) {
+	decision, err := h.Policy.Evaluate(c.Request.Context(), c.Request.Method, c.FullPath(), h.policySubject(c))
+	if err != nil {
+		st, ok := status.FromError(err)
+		if ok && (st.Code() == codes.NotFound || st.Code() == codes.InvalidArgument) {
+			newResponse(c, http.StatusNotFound, "target not found: "+err.Error())
+			return
+		}
+		newResponse(c, http.StatusInternalServerError, "failed to evaluate policy: "+err.Error())
+		return
+	}
+	c.Set(policyDecisionCtx, decision)
+	if !decision.Allowed() {
+		newResponse(c, decision.Violations[0].Status, strings.Join(decision.Reasons(), "; "))
+	}
+}
+
+func (h *Handler) policySubject(c *gin.Context) policy.Subject {
+	subject := policy.Subject{Params: make(map[string]string, len(c.Params))}
+	for _, p := range c.Params {
+		subject.Params[p.Key] = p.Value
+	}
+	if id, exists := c.Get(idCtx); exists {
+		subject.UserID, _ = id.(string)
+	}
+	if roles, exists := c.Get(roleCtx); exists {
+		subject.Roles, _ = roles.([]string)
+		subject.Authenticated = true
+	}
+	if activated, exists := c.Get(activatedCtx); exists {
+		subject.Activated, _ = activated.(bool)
+	}
+	if key, exists := c.Get(apiKeyCtx); exists {
+		apiKey := key.(domain.APIKey)
+		subject.APIKey = &apiKey
+	}
+	return subject
+}
+
+// policyRules are the authorization rules of the gateway routes. Rules from the
+// config are registered on top of them.
+func (h *Handler) policyRules() []policy.Rule {
+	var (
+		restaurantAdmins = []string{domain.AdminRole, domain.RestaurantAdminRole}
+		staff            = []string{domain.AdminRole, domain.WaiterRole, domain.RestaurantAdminRole}
+		integrations     = []string{domain.AdminRole, domain.WaiterRole, domain.RestaurantAdminRole, domain.IntegrationRole}
+		ownsRestaurant   = h.Policy.Ownership(policy.ResolverRestaurant, "id", domain.RestaurantAdminRole)
+		// the guest of a reservation or the staff of its restaurant
+		reservationParty = h.Policy.GuestOrOwnership(policy.ResolverReservationGuest, policy.ResolverReservation, "id",
+			domain.RestaurantAdminRole, domain.WaiterRole)
+	)
+	rule := func(method, path string, conditions ...policy.Condition) policy.Rule {
+		return policy.Rule{Method: method, Path: path, Conditions: conditions}
+	}
+	// read is a GET rule whose route impersonation sessions may call as well. Only
+	// routes that don't change anything qualify, links like the confirmation of a
+	// reservation are GETs too.
+	read := func(path string, conditions ...policy.Condition) policy.Rule {
+		return policy.Rule{Method: http.MethodGet, Path: path, Conditions: conditions, AllowImpersonation: true}
+	}
+
+	return []policy.Rule{
+		// restaurants
+		rule(http.MethodPost, "/api/restaurants/add", policy.Activated(), policy.AnyRole(restaurantAdmins...)),
+		rule(http.MethodDelete, "/api/restaurants/delete/:id", policy.Activated(), policy.AnyRole(restaurantAdmins...), ownsRestaurant),
+		rule(http.MethodPatch, "/api/restaurants/update/:id", policy.Activated(), policy.AnyRole(restaurantAdmins...), ownsRestaurant),
+		rule(http.MethodPost, "/api/restaurants/photos/upload/:id", policy.Activated(), policy.AnyRole(restaurantAdmins...), ownsRestaurant),
+		rule(http.MethodDelete, "/api/restaurants/photos/delete/:id", policy.Activated(), policy.AnyRole(restaurantAdmins...), ownsRestaurant),
+		rule(http.MethodPost, "/api/restaurants/staff/add/:id", policy.Activated(), policy.AnyRole(domain.AdminRole)),
+		rule(http.MethodPut, "/api/restaurants/settings/:id", policy.Activated(), policy.AnyRole(restaurantAdmins...), ownsRestaurant),
+		rule(http.MethodPost, "/api/restaurants/combinations/add/:id", policy.Activated(), policy.AnyRole(restaurantAdmins...), ownsRestaurant),
+		rule(http.MethodDelete, "/api/restaurants/combinations/delete/:id/:combinationID", policy.Activated(), policy.AnyRole(restaurantAdmins...), ownsRestaurant),
+		read("/api/restaurants/penalties/:id", policy.Activated(), policy.AnyRole(staff...),
+			h.Policy.Ownership(policy.ResolverRestaurant, "id", domain.RestaurantAdminRole, domain.WaiterRole)),
+
+		// tables, the restaurant of a new table is checked by the handler
+		rule(http.MethodPost, "/api/tables/add", policy.Activated(), policy.AnyRole(integrations...), policy.Scope(domain.ScopeTablesWrite)),
+		rule(http.MethodDelete, "/api/tables/delete/:id", policy.Activated(), policy.AnyRole(integrations...), policy.Scope(domain.ScopeTablesWrite),
+			h.Policy.Ownership(policy.ResolverTable, "id", domain.RestaurantAdminRole, domain.WaiterRole)),
+		rule(http.MethodPatch, "/api/tables/update/:id", policy.Activated(), policy.AnyRole(integrations...), policy.Scope(domain.ScopeTablesWrite),
+			h.Policy.Ownership(policy.ResolverTable, "id", domain.RestaurantAdminRole, domain.WaiterRole)),
+
+		// reservations
+		read("/api/reservations/all/restaurant/:id", policy.Authenticated(), policy.Scope(domain.ScopeReservationsRead),
+			h.Policy.Ownership(policy.ResolverRestaurant, "id", domain.RestaurantAdminRole, domain.WaiterRole)),
+		rule(http.MethodGet, "/api/reservations/confirm/:id", policy.Activated(), policy.AnyRole(integrations...), policy.Scope(domain.ScopeReservationsWrite),
+			h.Policy.Ownership(policy.ResolverReservation, "id", domain.RestaurantAdminRole, domain.WaiterRole)),
+		rule(http.MethodPost, "/api/reservations/seat/:id", policy.Activated(), policy.AnyRole(integrations...), policy.Scope(domain.ScopeReservationsWrite),
+			h.Policy.Ownership(policy.ResolverReservation, "id", domain.RestaurantAdminRole, domain.WaiterRole)),
+		rule(http.MethodPost, "/api/reservations/complete/:id", policy.Activated(), policy.AnyRole(integrations...), policy.Scope(domain.ScopeReservationsWrite),
+			h.Policy.Ownership(policy.ResolverReservation, "id", domain.RestaurantAdminRole, domain.WaiterRole)),
+		rule(http.MethodPost, "/api/reservations/decline/:id", policy.Activated(), policy.AnyRole(integrations...), policy.Scope(domain.ScopeReservationsWrite),
+			h.Policy.Ownership(policy.ResolverReservation, "id", domain.RestaurantAdminRole, domain.WaiterRole)),
+		rule(http.MethodPost, "/api/reservations/no-show/:id", policy.Activated(), policy.AnyRole(integrations...), policy.Scope(domain.ScopeReservationsWrite),
+			h.Policy.Ownership(policy.ResolverReservation, "id", domain.RestaurantAdminRole, domain.WaiterRole)),
+		rule(http.MethodPost, "/api/reservations/make", policy.Activated()),
+		rule(http.MethodPost, "/api/reservations/make/combination", policy.Activated()),
+		rule(http.MethodPost, "/api/reservations/make/series", policy.Activated()),
+		read("/api/reservations/series/view/:id", policy.Activated()),
+		read("/api/reservations/series/all/user", policy.Activated()),
+		rule(http.MethodPost, "/api/reservations/series/skip/:id", policy.Activated()),
+		rule(http.MethodPost, "/api/reservations/series/cancel/:id", policy.Activated()),
+		read("/api/reservations/view/:id", policy.Activated(), reservationParty),
+		rule(http.MethodPatch, "/api/reservations/update", policy.Activated()),
+		rule(http.MethodDelete, "/api/reservations/cancel/:id", policy.Activated()),
+		rule(http.MethodPost, "/api/reservations/cancel/:id", policy.Activated()),
+		read("/api/reservations/all/user", policy.Activated()),
+		read("/api/reservations/view/restaurant/:id", policy.Activated(), reservationParty),
+		read("/api/reservations/view/table/:id", policy.Activated(), reservationParty),
+
+		// waitlist, entries are the caller's own, checked in the handlers
+		rule(http.MethodPost, "/api/waitlist/join/:id", policy.Activated()),
+		read("/api/waitlist/view/:id", policy.Activated()),
+		read("/api/waitlist/all/user", policy.Activated()),
+		rule(http.MethodDelete, "/api/waitlist/leave/:id", policy.Activated()),
+
+		// users, the account routes work before activation so a user can still
+		// fix, export or erase their account
+		read("/api/users/me", policy.Authenticated()),
+		rule(http.MethodPatch, "/api/users/update", policy.Authenticated()),
+		rule(http.MethodDelete, "/api/users/delete", policy.Authenticated()),
+		read("/api/users/view/id/:id", policy.SelfOrRole("id", domain.AdminRole)),
+		// others than admins get their own record only, checked in the handler
+		read("/api/users/view/email/:email", policy.Authenticated()),
+		rule(http.MethodGet, "/api/users/me/export", policy.Authenticated()),
+		read("/api/users/me/erasure", policy.Authenticated()),
+		rule(http.MethodPost, "/api/users/me/erasure", policy.Authenticated()),
+		rule(http.MethodPost, "/api/users/me/erasure/confirm", policy.Authenticated()),
+		rule(http.MethodDelete, "/api/users/me/erasure", policy.Authenticated()),
+		rule(http.MethodPost, "/api/users/me/avatar", policy.Authenticated()),
+		rule(http.MethodDelete, "/api/users/me/avatar", policy.Authenticated()),
+
+		// qr
+		rule(http.MethodPost, "/api/qr/generate", policy.Activated()),
+		rule(http.MethodGet, "/api/qr/scan/:reservationID", policy.AnyRole(staff...),
+			h.Policy.Ownership(policy.ResolverReservation, "reservationID", domain.RestaurantAdminRole, domain.WaiterRole)),
+
+		// api keys, rotate and revoke check the restaurant of the key in the handler
+		rule(http.MethodPost, "/api/api-keys/create", policy.Activated(), policy.AnyRole(restaurantAdmins...)),
+		rule(http.MethodGet, "/api/api-keys/all/restaurant/:id", policy.Activated(), policy.AnyRole(restaurantAdmins...), ownsRestaurant),
+		rule(http.MethodPost, "/api/api-keys/rotate/:id", policy.Activated(), policy.AnyRole(restaurantAdmins...)),
+		rule(http.MethodDelete, "/api/api-keys/revoke/:id", policy.Activated(), policy.AnyRole(restaurantAdmins...)),
+
+		// roles and staff, the restaurant of an invite is checked by the handler
+		rule(http.MethodPost, "/api/admin/roles/assign", policy.Activated(), policy.AnyRole(domain.AdminRole)),
+		rule(http.MethodPost, "/api/admin/roles/revoke", policy.Activated(), policy.AnyRole(domain.AdminRole)),
+		rule(http.MethodGet, "/api/admin/audit", policy.Activated(), policy.AnyRole(domain.AdminRole)),
+		rule(http.MethodGet, "/api/admin/users", policy.Activated(), policy.AnyRole(domain.AdminRole)),
+		rule(http.MethodPost, "/api/admin/users/bulk", policy.Activated(), policy.AnyRole(domain.AdminRole)),
+		rule(http.MethodPost, "/api/admin/suspensions/suspend", policy.Activated(), policy.AnyRole(domain.AdminRole)),
+		rule(http.MethodPost, "/api/admin/suspensions/lift", policy.Activated(), policy.AnyRole(domain.AdminRole)),
+		rule(http.MethodGet, "/api/admin/suspensions/appeals", policy.Activated(), policy.AnyRole(domain.AdminRole)),
+		rule(http.MethodPost, "/api/admin/suspensions/appeals/resolve", policy.Activated(), policy.AnyRole(domain.AdminRole)),
+		rule(http.MethodPost, "/api/staff/invite", policy.Activated(), policy.AnyRole(restaurantAdmins...)),
+		rule(http.MethodGet, "/api/staff/invite/accept/:token", policy.Activated()),
+		rule(http.MethodPost, "/api/staff/invite/accept/:token", policy.Activated()),
+		read("/api/staff/all/restaurant/:id", policy.Activated(), policy.AnyRole(restaurantAdmins...), ownsRestaurant),
+		rule(http.MethodDelete, "/api/staff/remove/:id/:userID", policy.Activated(), policy.AnyRole(restaurantAdmins...), ownsRestaurant),
+
+		// impersonation sessions may call the read routes above and end themselves
+		rule(http.MethodPost, "/api/impersonation/start", policy.Activated(), policy.AnyRole(domain.AdminRole)),
+		{Method: http.MethodPost, Path: "/api/impersonation/end", Conditions: []policy.Condition{policy.Authenticated()}, AllowImpersonation: true},
+	}
+}
@@ -0,0 +1,532 @@
+package delivery
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	proto_reservation "github.com/aidostt/protos/gen/go/reservista/reservation"
+	proto_user "github.com/aidostt/protos/gen/go/reservista/user"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math/big"
+	"net/http"
+	"reservista.kz/internal/domain"
+	"reservista.kz/pkg/logger"
+	"time"
+)
+
+const erasedEmailDomain = "erased.invalid"
+
+// ErasurePolicy sets how long an erasure waits for confirmation and how many
+// codes may be tried, how long it can still be cancelled and how often due
+// erasures are looked for.
+type ErasurePolicy struct {
+	ConfirmTTL  time.Duration
+	MaxAttempts int
+	GracePeriod time.Duration
+	Interval    time.Duration
+}
+
+// dataExport is everything the gateway and the services behind it keep about a user.
+// Impersonations are the sessions in which an admin acted as the user,
+// ImpersonationsByUser the ones in which the user acted as someone else.
+type dataExport struct {
+	ExportedAt           time.Time                              `json:"exportedAt"`
+	Profile              userExport                             `json:"profile"`
+	Reservations         []*proto_reservation.ReservationObject `json:"reservations"`
+	Identities           []domain.Identity                      `json:"identities"`
+	StaffMemberships     []domain.StaffMember                   `json:"staffMemberships"`
+	Impersonations       []domain.Impersonation                 `json:"impersonations"`
+	ImpersonationsByUser []domain.Impersonation                 `json:"impersonationsByUser"`
+	OIDCSessions         []oidcSessionExport                    `json:"oidcSessions"`
+	Activity             []domain.AuditEntry                    `json:"activity"`
+}
+
+// oidcSessionExport is a link to an OpenID Connect provider the user started and
+// hasn't finished. The nonce and code verifier only serve the provider's callback
+// and are left out.
+type oidcSessionExport struct {
+	Provider  string    `json:"provider"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type userExport struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Surname   string   `json:"surname"`
+	Phone     string   `json:"phone"`
+	Email     string   `json:"email"`
+	Roles     []string `json:"roles"`
+	Activated bool     `json:"activated"`
+}
+
+// exportUserData returns the data of the signed in user as JSON, or as a ZIP with
+// a file per section when format=zip.
+func (h *Handler) exportUserData(c *gin.Context) {
+	if c.GetString(impersonatorCtx) != "" {
+		newResponse(c, http.StatusForbidden, "personal data can't be exported while impersonating")
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		newResponse(c, http.StatusBadRequest, "invalid format parameter, expected json or zip")
+		return
+	}
+	userID := c.GetString(idCtx)
+	h.audit(c, "user.export", map[string]string{"user_id": userID})
+
+	export, err := h.collectUserData(c.Request.Context(), userID)
+	if err != nil {
+		h.userServiceError(c, err)
+		return
+	}
+	if format == "json" {
+		c.Header("Content-Disposition", `attachment; filename="reservista-export.json"`)
+		c.JSON(http.StatusOK, export)
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="reservista-export.zip"`)
+	c.Status(http.StatusOK)
+	c.Writer.Header().Set("Content-Type", "application/zip")
+	archive := zip.NewWriter(c.Writer)
+	sections := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", export.Profile},
+		{"reservations.json", export.Reservations},
+		{"identities.json", export.Identities},
+		{"staff_memberships.json", export.StaffMemberships},
+		{"impersonations.json", export.Impersonations},
+		{"impersonations_by_user.json", export.ImpersonationsByUser},
+		{"oidc_sessions.json", export.OIDCSessions},
+		{"activity.json", export.Activity},
+	}
+	for _, section := range sections {
+		file, err := archive.Create(section.name)
+		if err == nil {
+			encoder := json.NewEncoder(file)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(section.data)
+		}
+		if err != nil {
+			// the headers are gone already, all that is left is to cut the archive short
+			logger.Errorf("failed to write data export of %s: %v", userID, err)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		logger.Errorf("failed to write data export of %s: %v", userID, err)
+	}
+}
+
+func (h *Handler) collectUserData(ctx context.Context, userID string) (dataExport, error) {
+	export := dataExport{ExportedAt: time.Now()}
+
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Users)
+	if err != nil {
+		return export, err
+	}
+	defer conn.Close()
+	user, err := proto_user.NewUserClient(conn).GetByID(ctx, &proto_user.GetRequest{
+		UserId: userID,
+		Email:  domain.Plug,
+	})
+	if err != nil {
+		return export, err
+	}
+	export.Profile = userExport{
+		ID:        userID,
+		Name:      user.GetName(),
+		Surname:   user.GetSurname(),
+		Phone:     user.GetPhone(),
+		Email:     user.GetEmail(),
+		Roles:     user.GetRoles(),
+		Activated: user.GetActivated(),
+	}
+
+	if export.Reservations, err = h.userReservations(ctx, userID); err != nil {
+		return export, err
+	}
+	if export.Identities, err = h.Repos.Identities.GetByUser(ctx, userID); err != nil {
+		return export, err
+	}
+	if export.StaffMemberships, err = h.Repos.Staff.GetByUser(ctx, userID); err != nil {
+		return export, err
+	}
+	if export.Impersonations, err = h.Repos.Impersonations.GetByUser(ctx, userID); err != nil {
+		return export, err
+	}
+	if export.ImpersonationsByUser, err = h.Repos.Impersonations.GetByActor(ctx, userID); err != nil {
+		return export, err
+	}
+	states, err := h.Repos.OIDCStates.GetByLinkUser(ctx, userID)
+	if err != nil {
+		return export, err
+	}
+	export.OIDCSessions = make([]oidcSessionExport, 0, len(states))
+	for _, state := range states {
+		export.OIDCSessions = append(export.OIDCSessions, oidcSessionExport{Provider: state.Provider, ExpiresAt: state.ExpiresAt})
+	}
+	if export.Activity, err = h.Repos.Audit.Find(ctx, domain.AuditFilter{ActorID: userID}); err != nil {
+		return export, err
+	}
+	return export, nil
+}
+
+func (h *Handler) userReservations(ctx context.Context, userID string) ([]*proto_reservation.ReservationObject, error) {
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	reservations, err := proto_reservation.NewReservationClient(conn).GetAllReservationByUserId(ctx, &proto_reservation.IDRequest{Id: userID})
+	if err != nil {
+		return nil, err
+	}
+	return reservations.GetReservations(), nil
+}
+
+func (h *Handler) getErasure(c *gin.Context) {
+	request, err := h.Repos.Erasures.GetByUser(c.Request.Context(), c.GetString(idCtx))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			newResponse(c, http.StatusNotFound, "no erasure requested")
+			return
+		}
+		newResponse(c, http.StatusInternalServerError, "failed to get erasure: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, request)
+}
+
+// requestErasure starts the erasure of the signed in user. It has to be
+// confirmed with the code sent by email.
+func (h *Handler) requestErasure(c *gin.Context) {
+	userID := c.GetString(idCtx)
+	ctx := c.Request.Context()
+	current, err := h.Repos.Erasures.GetByUser(ctx, userID)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		newResponse(c, http.StatusInternalServerError, "failed to get erasure: "+err.Error())
+		return
+	}
+	if err == nil && current.Status == domain.ErasureScheduled {
+		newResponse(c, http.StatusConflict, "erasure is already scheduled")
+		return
+	}
+
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Users)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return
+	}
+	defer conn.Close()
+	user, err := proto_user.NewUserClient(conn).GetByID(ctx, &proto_user.GetRequest{
+		UserId: userID,
+		Email:  domain.Plug,
+	})
+	if err != nil {
+		h.userServiceError(c, err)
+		return
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to generate code: "+err.Error())
+		return
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+	codeHash, err := h.SecretHasher.Hash(code)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to generate code: "+err.Error())
+		return
+	}
+	now := time.Now()
+	request := domain.ErasureRequest{
+		ID:          primitive.NewObjectID().Hex(),
+		UserID:      userID,
+		CodeHash:    codeHash,
+		Status:      domain.ErasurePending,
+		RequestedAt: now,
+		ConfirmBy:   now.Add(h.Erasure.ConfirmTTL),
+	}
+	if err := h.Repos.Erasures.Save(ctx, request); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to save erasure: "+err.Error())
+		return
+	}
+	if err := h.sendVerificationCodeMail(ctx, user.GetEmail(), code); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to send confirmation code: "+err.Error())
+		return
+	}
+	h.audit(c, "user.erasure.request", map[string]string{"user_id": userID, "erasure_id": request.ID})
+	c.JSON(http.StatusAccepted, request)
+}
+
+// confirmErasure schedules the erasure after the grace period, during which it
+// can still be cancelled.
+func (h *Handler) confirmErasure(c *gin.Context) {
+	var input codeInput
+	if err := c.BindJSON(&input); err != nil || input.Code == "" {
+		newResponse(c, http.StatusBadRequest, "invalid input body")
+		return
+	}
+	ctx := c.Request.Context()
+	request, err := h.Repos.Erasures.GetByUser(ctx, c.GetString(idCtx))
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		newResponse(c, http.StatusInternalServerError, "failed to get erasure: "+err.Error())
+		return
+	}
+	if err != nil || request.Status != domain.ErasurePending || !request.Open() {
+		newResponse(c, http.StatusBadRequest, "no erasure waiting for confirmation")
+		return
+	}
+	// attempts are counted before the code is checked, so concurrent guesses
+	// can't get past the limit
+	attempts, err := h.Repos.Erasures.AddAttempt(ctx, request.ID, request.ConfirmBy)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to count attempt: "+err.Error())
+		return
+	}
+	if attempts > h.Erasure.MaxAttempts {
+		request.Status = domain.ErasureCancelled
+		request.CodeHash = ""
+		if err := h.Repos.Erasures.Save(ctx, request); err != nil {
+			newResponse(c, http.StatusInternalServerError, "failed to save erasure: "+err.Error())
+			return
+		}
+		newResponse(c, http.StatusTooManyRequests, "too many wrong codes, request the erasure again")
+		return
+	}
+	codeHash, err := h.SecretHasher.Hash(input.Code)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(codeHash), []byte(request.CodeHash)) != 1 {
+		newResponse(c, http.StatusBadRequest, "wrong confirmation code")
+		return
+	}
+
+	scheduledFor := time.Now().Add(h.Erasure.GracePeriod)
+	request.Status = domain.ErasureScheduled
+	request.ScheduledFor = &scheduledFor
+	request.CodeHash = ""
+	if err := h.Repos.Erasures.Save(ctx, request); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to save erasure: "+err.Error())
+		return
+	}
+	h.audit(c, "user.erasure.confirm", map[string]string{"erasure_id": request.ID})
+	h.auditChange(c, nil, map[string]interface{}{"scheduledFor": scheduledFor})
+	c.JSON(http.StatusOK, request)
+}
+
+func (h *Handler) cancelErasure(c *gin.Context) {
+	ctx := c.Request.Context()
+	request, err := h.Repos.Erasures.GetByUser(ctx, c.GetString(idCtx))
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		newResponse(c, http.StatusInternalServerError, "failed to get erasure: "+err.Error())
+		return
+	}
+	if err != nil || !request.Open() {
+		newResponse(c, http.StatusNotFound, "no erasure to cancel")
+		return
+	}
+	request.Status = domain.ErasureCancelled
+	if err := h.Repos.Erasures.Save(ctx, request); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to save erasure: "+err.Error())
+		return
+	}
+	h.audit(c, "user.erasure.cancel", map[string]string{"erasure_id": request.ID})
+	c.JSON(http.StatusOK, request)
+}
+
+// RunErasures carries out the erasures whose grace period is over until ctx is
+// done. Failed erasures are retried on the next tick.
+func (h *Handler) RunErasures(ctx context.Context) {
+	ticker := time.NewTicker(h.Erasure.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			due, err := h.Repos.Erasures.GetDue(ctx, now)
+			if err != nil {
+				logger.Errorf("failed to get due erasures: %v", err)
+				continue
+			}
+			for _, request := range due {
+				if err := h.eraseUser(ctx, request); err != nil {
+					logger.Errorf("failed to erase user %s: %v", request.UserID, err)
+					continue
+				}
+				logger.Infof("erased user %s", request.UserID)
+			}
+		}
+	}
+}
+
+// eraseUser anonymizes the profile instead of deleting it, so the history of
+// past reservations stays consistent but no longer points at a person.
+func (h *Handler) eraseUser(ctx context.Context, request domain.ErasureRequest) error {
+	if err := h.cancelFutureReservations(ctx, request.UserID); err != nil {
+		return err
+	}
+
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Users)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	statusResponse, err := proto_user.NewUserClient(conn).Update(ctx, &proto_user.UpdateRequest{
+		Id:       request.UserID,
+		Name:     "Deleted",
+		Surname:  "User",
+		Phone:    "",
+		Email:    request.UserID + "@" + erasedEmailDomain,
+		Password: hex.EncodeToString(b),
+	})
+	if err != nil {
+		return err
+	}
+	if !statusResponse.GetStatus() {
+		return errors.New("user service failed to anonymize the user")
+	}
+
+	return h.releaseUser(ctx, request)
+}
+
+// releaseUser drops what the gateway keeps about an erased or deleted user, down
+// to the API keys and invites the user made, and takes the user's id and IP out
+// of the audit trail. The completed erasure makes
+// userIdentity reject the sessions the user still has.
+func (h *Handler) releaseUser(ctx context.Context, request domain.ErasureRequest) error {
+	if err := h.Auditor.Anonymize(ctx, request.UserID, request.Alias()); err != nil {
+		return err
+	}
+	if err := h.Repos.Identities.DeleteByUser(ctx, request.UserID); err != nil {
+		return err
+	}
+	if avatar, err := h.Repos.Avatars.Get(ctx, request.UserID); err == nil {
+		if err := h.Repos.Avatars.Delete(ctx, request.UserID); err != nil {
+			return err
+		}
+		h.deleteAvatarObjects(ctx, avatar.Keys)
+	}
+	if err := h.Repos.Directory.Delete(ctx, request.UserID); err != nil {
+		return err
+	}
+	for _, deleteByUser := range []func(context.Context, string) error{
+		h.Repos.Penalties.DeleteByUser,
+		h.Repos.Waitlist.DeleteByUser,
+		h.Repos.Series.DeleteByUser,
+		h.Repos.Reservations.DeleteByUser,
+		h.Repos.Reminders.DeleteByUser,
+		h.Repos.Idempotency.DeleteByUser,
+		h.Repos.APIKeys.DeleteByUser,
+		h.Repos.Invites.DeleteByUser,
+		h.Repos.Suspensions.DeleteByUser,
+	} {
+		if err := deleteByUser(ctx, request.UserID); err != nil {
+			return err
+		}
+	}
+	memberships, err := h.Repos.Staff.GetByUser(ctx, request.UserID)
+	if err != nil {
+		return err
+	}
+	for _, m := range memberships {
+		if err := h.Repos.Staff.Remove(ctx, m.RestaurantID, m.UserID); err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	request.Status = domain.ErasureCompleted
+	request.CompletedAt = &now
+	request.CodeHash = ""
+	return h.Repos.Erasures.Save(ctx, request)
+}
+
+// cancelFutureReservations cancels the upcoming reservations of a user like the
+// guest would, through saveCancellation, so the tables go to the waitlist. The
+// cancellation policy doesn't hold an erasure back, and no penalty is recorded
+// for a user whose penalties are dropped right after.
+func (h *Handler) cancelFutureReservations(ctx context.Context, userID string) error {
+	reservations, err := h.userReservations(ctx, userID)
+	if err != nil {
+		return err
+	}
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	client := proto_reservation.NewReservationClient(conn)
+	now := time.Now()
+	cancelled := make(map[string]bool)
+	for _, reservation := range reservations {
+		start := h.reservationStart(ctx, reservation)
+		if !start.After(now) {
+			continue
+		}
+		details, err := h.reservationDetails(ctx, reservation)
+		if err != nil {
+			return err
+		}
+		to, err := domain.Transition(details.Status, "cancel", domain.ActorGuest, start, now)
+		if err != nil {
+			// finished already
+			continue
+		}
+		if details.RestaurantID == "" {
+			if details.RestaurantID, err = h.restaurantOfReservation(ctx, details.ReservationID); err != nil {
+				return err
+			}
+		}
+		details.History = append(details.History, domain.ReservationEvent{Action: "cancel", From: details.Status, To: to, By: userID, At: now, Reason: "account erased"})
+		details.Status = to
+		if err := h.saveCancellation(ctx, client, details, start, ""); err != nil {
+			return err
+		}
+		cancelled[details.ReservationID] = true
+	}
+
+	series, err := h.Repos.Series.GetByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, s := range series {
+		for i, occurrence := range s.Occurrences {
+			if cancelled[occurrence.ReservationID] {
+				s.Occurrences[i].Status = domain.OccurrenceCancelled
+			}
+		}
+		s.Status = domain.SeriesCancelled
+		if err := h.Repos.Series.Save(ctx, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isErased reports whether the user's data was erased, their sessions are revoked then.
+func (h *Handler) isErased(ctx context.Context, userID string) (bool, error) {
+	request, err := h.Repos.Erasures.GetByUser(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return request.Status == domain.ErasureCompleted, nil
+}
@@ -6,14 +6,13 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"net/http"
-	"reservista.kz/internal/domain"
 )
 
 func (h *Handler) qr(api *gin.RouterGroup) {
-	qr := api.Group("/qr", h.userIdentity)
+	qr := api.Group("/qr", h.userIdentity, h.authorize, h.idempotency)
 	{
 		qr.POST("/generate", h.generateQR)
-		qr.GET("/scan/:reservationID", h.isPermitted([]string{domain.AdminRole, domain.WaiterRole, domain.RestaurantAdminRole}), h.scanQR)
+		qr.GET("/scan/:reservationID", h.scanQR)
 
 	}
 }
@@ -32,7 +31,7 @@ func (h *Handler) generateQR(c *gin.Context) {
 	}
 	qr := proto_qr.NewQRClient(conn)
 	resp, err := qr.Generate(c.Request.Context(), &proto_qr.GenerateRequest{
-		Content: "http://" + h.HttpAddress + "/api/reservations/confirm/" + inp.ReservationID,
+		Content: h.link("/api/reservations/confirm/" + inp.ReservationID),
 	})
 	if err != nil {
 		st, ok := status.FromError(err)
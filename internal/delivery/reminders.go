@@ -0,0 +1,249 @@
+package delivery
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	proto_reservation "github.com/aidostt/protos/gen/go/reservista/reservation"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"reservista.kz/internal/domain"
+	"reservista.kz/pkg/logger"
+	"time"
+)
+
+// reminderBatch is how many reminders the scheduler claims per tick.
+const reminderBatch = 100
+
+// ReminderPolicy is how long before a reservation its reminders go out, and how
+// the scheduler retries them: a reminder that wasn't sent within Lease is sent
+// again, up to MaxAttempts times.
+type ReminderPolicy struct {
+	Offsets     []time.Duration
+	Interval    time.Duration
+	Lease       time.Duration
+	MaxAttempts int
+}
+
+func (h *Handler) reminders(api *gin.RouterGroup) {
+	// the reminder mail links here, the token stands in for the session. The GETs
+	// only show the reservation, so previews of the links change nothing
+	reminders := api.Group("/reminders")
+	{
+		reminders.GET("/confirm/:token", h.getReminderReservation)
+		reminders.POST("/confirm/:token", h.confirmFromReminder)
+		reminders.GET("/cancel/:token", h.getReminderReservation)
+		reminders.POST("/cancel/:token", h.cancelFromReminder)
+	}
+}
+
+// scheduleReminders schedules the reminders of a reservation starting at start.
+// Moving a reservation schedules them again for the new time. Failures are only
+// logged, the reservation is made either way.
+func (h *Handler) scheduleReminders(ctx context.Context, reservationID, userID string, start time.Time) {
+	now := time.Now()
+	for _, offset := range h.Reminders.Offsets {
+		sendAt := start.Add(-offset)
+		if sendAt.Before(now) {
+			continue
+		}
+		err := h.Repos.Reminders.Schedule(ctx, domain.ReminderJob{
+			ID:            reservationID + "|" + offset.String(),
+			ReservationID: reservationID,
+			UserID:        userID,
+			Start:         start,
+			SendAt:        sendAt,
+			Status:        domain.ReminderPending,
+		})
+		if err != nil {
+			logger.Errorf("failed to schedule %s reminder of reservation %s: %v", offset, reservationID, err)
+		}
+	}
+}
+
+// RunReminders sends the reminders that are due until ctx is done.
+func (h *Handler) RunReminders(ctx context.Context) {
+	ticker := time.NewTicker(h.Reminders.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			h.sendReminders(ctx, now)
+		}
+	}
+}
+
+func (h *Handler) sendReminders(ctx context.Context, now time.Time) {
+	jobs, err := h.Repos.Reminders.Due(ctx, now, h.Reminders.Lease, reminderBatch)
+	if err != nil {
+		logger.Errorf("failed to get due reminders: %v", err)
+	}
+	for _, job := range jobs {
+		finished, err := h.sendReminder(ctx, job, now)
+		if err != nil {
+			logger.Errorf("failed to send reminder %s (attempt %d): %v", job.ID, job.Attempts, err)
+			if job.Attempts < h.Reminders.MaxAttempts {
+				// the lease runs out and the reminder is sent again
+				continue
+			}
+			finished = domain.ReminderFailed
+		}
+		if err := h.Repos.Reminders.Finish(ctx, job.ID, finished); err != nil {
+			logger.Errorf("failed to finish reminder %s: %v", job.ID, err)
+		}
+	}
+}
+
+// sendReminder mails the reminder of a job with links that confirm or cancel the
+// reservation. Reminders of reservations that were cancelled, moved or that have
+// started are dropped. It returns the status the job finished with.
+func (h *Handler) sendReminder(ctx context.Context, job domain.ReminderJob, now time.Time) (string, error) {
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	reservation, err := proto_reservation.NewReservationClient(conn).GetReservation(ctx, &proto_reservation.IDRequest{Id: job.ReservationID})
+	if status.Code(err) == codes.NotFound {
+		return domain.ReminderDropped, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	details, err := h.reservationDetails(ctx, reservation)
+	if err != nil {
+		return "", err
+	}
+	start := h.reservationStart(ctx, reservation)
+	if details.Final() || !start.Equal(job.Start) || !start.After(now) {
+		return domain.ReminderDropped, nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	tokenHash, err := h.SecretHasher.Hash(token)
+	if err != nil {
+		return "", err
+	}
+	if err := h.Repos.Reminders.AddToken(ctx, job.ID, tokenHash); err != nil {
+		return "", err
+	}
+	loc, err := h.restaurantLocation(ctx, details.RestaurantID)
+	if err != nil {
+		return "", err
+	}
+	email, err := h.guestEmail(ctx, reservation.GetUserID())
+	if err != nil {
+		return "", err
+	}
+	err = h.sendMail(ctx, email, "reminder", map[string]interface{}{
+		"Restaurant": reservation.GetTable().GetRestaurant().GetName(),
+		"Start":      start.In(loc),
+		"ConfirmURL": h.link("/api/reminders/confirm/" + token),
+		"CancelURL":  h.link("/api/reminders/cancel/" + token),
+	})
+	if err != nil {
+		return "", err
+	}
+	return domain.ReminderSent, nil
+}
+
+// getReminderReservation is where the links of a reminder land, it shows the
+// reservation and the actions the guest can take on it.
+func (h *Handler) getReminderReservation(c *gin.Context) {
+	job, ok := h.reminderJob(c)
+	if !ok {
+		return
+	}
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return
+	}
+	defer conn.Close()
+	reservation, err := proto_reservation.NewReservationClient(conn).GetReservation(c.Request.Context(), &proto_reservation.IDRequest{Id: job.ReservationID})
+	if err != nil {
+		h.reservationServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, h.withDetails(c.Request.Context(), reservation, domain.ActorGuest))
+}
+
+// confirmFromReminder records that the guest confirmed they are coming.
+func (h *Handler) confirmFromReminder(c *gin.Context) {
+	job, ok := h.reminderJob(c)
+	if !ok {
+		return
+	}
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
+	defer conn.Close()
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return
+	}
+	reservation, err := proto_reservation.NewReservationClient(conn).GetReservation(c.Request.Context(), &proto_reservation.IDRequest{Id: job.ReservationID})
+	if err != nil {
+		h.reservationServiceError(c, err)
+		return
+	}
+	details, err := h.reservationDetails(c.Request.Context(), reservation)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get reservation details: "+err.Error())
+		return
+	}
+	now := time.Now()
+	if details.Final() {
+		newResponse(c, http.StatusConflict, "the reservation is "+details.Status)
+		return
+	}
+	if !h.reservationStart(c.Request.Context(), reservation).After(now) {
+		newResponse(c, http.StatusGone, "the reservation has already started")
+		return
+	}
+	details.GuestConfirmedAt = &now
+	if err := h.Repos.Reservations.Save(c.Request.Context(), details); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to save reservation details: "+err.Error())
+		return
+	}
+	h.audit(c, "reservation.guest-confirm", map[string]string{"reservationID": job.ReservationID})
+	c.JSON(http.StatusOK, gin.H{"ok": true, "reservation_id": job.ReservationID, "status": details.Status})
+}
+
+// cancelFromReminder is the guest's cancellation, as if they cancelled the
+// reservation themselves.
+func (h *Handler) cancelFromReminder(c *gin.Context) {
+	job, ok := h.reminderJob(c)
+	if !ok {
+		return
+	}
+	c.Params = append(c.Params, gin.Param{Key: "id", Value: job.ReservationID})
+	h.changeStatus(c, "cancel", domain.ActorGuest, "")
+}
+
+// reminderJob returns the job of the token of the URL and acts as its guest.
+func (h *Handler) reminderJob(c *gin.Context) (domain.ReminderJob, bool) {
+	tokenHash, err := h.SecretHasher.Hash(c.Param("token"))
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to hash token: "+err.Error())
+		return domain.ReminderJob{}, false
+	}
+	job, err := h.Repos.Reminders.GetByTokenHash(c.Request.Context(), tokenHash)
+	if errors.Is(err, domain.ErrNotFound) {
+		newResponse(c, http.StatusNotFound, "reminder not found")
+		return domain.ReminderJob{}, false
+	}
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get reminder: "+err.Error())
+		return domain.ReminderJob{}, false
+	}
+	c.Set(idCtx, job.UserID)
+	return job, true
+}
@@ -1,6 +1,8 @@
 package delivery
 
 import (
+	"context"
+	"errors"
 	proto_mailer "github.com/aidostt/protos/gen/go/reservista/mailer"
 	proto_reservation "github.com/aidostt/protos/gen/go/reservista/reservation"
 	"github.com/gin-gonic/gin"
@@ -8,23 +10,36 @@ import (
 	"google.golang.org/grpc/status"
 	"net/http"
 	"reservista.kz/internal/domain"
+	"reservista.kz/pkg/logger"
+	"time"
 )
 
 func (h *Handler) reservation(api *gin.RouterGroup) {
-	reservations := api.Group("/reservations", h.userIdentity)
+	reservations := api.Group("/reservations")
 	{
-		reservations.GET("all/restaurant/:id", h.getAllReservationsByRestaurantId)
+		reservations.GET("all/restaurant/:id", h.userOrAPIKeyIdentity, h.authorize, h.getAllReservationsByRestaurantId)
+		reservations.GET("/confirm/:id", h.userOrAPIKeyIdentity, h.authorize, h.confirmReservation)
+		reservations.POST("/seat/:id", h.userOrAPIKeyIdentity, h.authorize, h.idempotency, h.seatReservation)
+		reservations.POST("/complete/:id", h.userOrAPIKeyIdentity, h.authorize, h.idempotency, h.completeReservation)
+		reservations.POST("/decline/:id", h.userOrAPIKeyIdentity, h.authorize, h.idempotency, h.declineReservation)
+		reservations.POST("/no-show/:id", h.userOrAPIKeyIdentity, h.authorize, h.idempotency, h.markNoShow)
 
-		activated := reservations.Group("/", h.isActivated())
+		activated := reservations.Group("/", h.userIdentity, h.authorize, h.idempotency)
 		{
 			activated.POST("/make", h.makeReservation)
+			activated.POST("/make/combination", h.makeCombinationReservation)
+			activated.POST("/make/series", h.makeSeriesReservation)
+			activated.GET("/series/view/:id", h.getSeries)
+			activated.GET("/series/all/user", h.getUserSeries)
+			activated.POST("/series/skip/:id", h.skipOccurrence)
+			activated.POST("/series/cancel/:id", h.cancelSeries)
 			activated.GET("/view/:id", h.getReservation)
 			activated.PATCH("/update", h.updateReservation)
-			activated.DELETE("/cancel/:id", h.deleteReservationById)
+			activated.DELETE("/cancel/:id", h.cancelReservation)
+			activated.POST("/cancel/:id", h.cancelReservation)
 			activated.GET("all/user", h.getAllReservationsByUserId)
 			activated.GET("/view/restaurant/:id", h.getRestaurantByReservationId)
 			activated.GET("/view/table/:id", h.getTableByReservationId)
-			activated.GET("/confirm/:id", h.isPermitted([]string{domain.AdminRole, domain.RestaurantAdminRole, domain.WaiterRole}), h.confirmReservation)
 		}
 	}
 }
@@ -36,8 +51,11 @@ func (h *Handler) makeReservation(c *gin.Context) {
 		newResponse(c, http.StatusUnauthorized, "missing id in context")
 	}
 	if err := c.BindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		c.Abort()
+		h.bindingError(c, err)
+		return
+	}
+	start, table, ok := h.reservationSlot(c, input.TableID, input.ReservationTime)
+	if !ok || !h.checkPenalties(c, table.GetRestaurant().GetId(), userID.(string)) || !h.seatParty(c, table, start, input.PartySize, "") {
 		return
 	}
 
@@ -52,7 +70,7 @@ func (h *Handler) makeReservation(c *gin.Context) {
 	resp, err := client.MakeReservation(c.Request.Context(), &proto_reservation.ReservationSQLRequest{
 		UserID:          userID.(string),
 		TableID:         input.TableID,
-		ReservationTime: input.ReservationTime,
+		ReservationTime: start.Format(time.RFC3339),
 	})
 	if err != nil {
 		st, ok := status.FromError(err)
@@ -71,31 +89,20 @@ func (h *Handler) makeReservation(c *gin.Context) {
 		}
 		return
 	}
-	// Sending email to user
-	conn, err = h.Dialog.NewConnection(h.Dialog.Addresses.Notifications)
-	defer conn.Close()
-	if err != nil {
-		newResponse(c, http.StatusInternalServerError, err.Error())
-	}
-	mailerClient := proto_mailer.NewMailerClient(conn)
-	_, err = mailerClient.SendQR(c.Request.Context(), &proto_mailer.QRInput{
-		UserID:        userID.(string),
+	err = h.Repos.Reservations.Save(c.Request.Context(), domain.ReservationDetails{
 		ReservationID: resp.GetId(),
-		QRUrlBase:     "http://" + h.HttpAddress + "/api/reservations/confirm/",
+		UserID:        userID.(string),
+		RestaurantID:  table.GetRestaurant().GetId(),
+		TableID:       input.TableID,
+		PartySize:     input.PartySize,
+		Status:        domain.ReservationPending,
+		CreatedAt:     time.Now(),
 	})
 	if err != nil {
-		st, ok := status.FromError(err)
-		if !ok {
-			// Error was not a gRPC status error
-			newResponse(c, http.StatusCreated, "unknown error when calling sending notification: "+err.Error())
-			return
-		}
-		switch st.Code() {
-		case codes.Internal:
-			newResponse(c, http.StatusCreated, "failed to send reservation message: "+err.Error())
-		default:
-			newResponse(c, http.StatusCreated, "unknown error when sending notification: "+err.Error())
-		}
+		logger.Errorf("failed to save details of reservation %s: %v", resp.GetId(), err)
+	}
+	h.scheduleReminders(c.Request.Context(), resp.GetId(), userID.(string), start)
+	if !h.sendQR(c, userID.(string), resp.GetId()) {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"ok": true})
@@ -133,103 +140,90 @@ func (h *Handler) getReservation(c *gin.Context) {
 		}
 		return
 	}
-	c.JSON(http.StatusOK, reservation)
+	// the policy lets the guest and the staff of the restaurant through
+	actor := domain.ActorGuest
+	if reservation.GetUserID() != c.GetString(idCtx) {
+		actor = domain.ActorStaff
+	}
+	c.JSON(http.StatusOK, h.withDetails(c.Request.Context(), reservation, actor))
 }
 
 func (h *Handler) updateReservation(c *gin.Context) {
 	var input reservationUpdateInput
 	if err := c.BindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		c.Abort()
+		h.bindingError(c, err)
+		return
+	}
+	if _, err := h.TokenManager.HexToObjectID(input.ReservationID); err != nil {
+		newValidationResponse(c, map[string]string{"reservation_id": "must be a valid id"})
 		return
 	}
 
 	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
-	defer conn.Close()
 	if err != nil {
 		newResponse(c, http.StatusInternalServerError, "something went wrong...")
 		return
 	}
+	defer conn.Close()
 	client := proto_reservation.NewReservationClient(conn)
 
-	statusResponse, err := client.UpdateReservation(c.Request.Context(), &proto_reservation.UpdateReservationRequest{
-		ReservationID:   input.ReservationID,
-		TableID:         input.TableID,
-		ReservationTime: input.ReservationTime,
-	})
+	reservation, err := client.GetReservation(c.Request.Context(), &proto_reservation.IDRequest{Id: input.ReservationID})
 	if err != nil {
-		st, ok := status.FromError(err)
-		if !ok {
-			// Error was not a gRPC status error
-			newResponse(c, http.StatusInternalServerError, "unknown error when calling sign up:"+err.Error())
+		h.reservationServiceError(c, err)
+		return
+	}
+	// guests move their own reservations, staff those of their restaurant
+	restaurantID := ""
+	if reservation.GetUserID() != c.GetString(idCtx) {
+		if restaurantID, err = h.restaurantOfReservation(c.Request.Context(), input.ReservationID); err != nil {
+			h.reservationServiceError(c, err)
 			return
 		}
-		switch st.Code() {
-		case codes.Internal:
-			newResponse(c, http.StatusInternalServerError, "microservice failed to execute functionality:"+err.Error())
-		default:
-			newResponse(c, http.StatusInternalServerError, "unknown error when calling sign up:"+err.Error())
+		if !h.authorizeRestaurant(c, restaurantID, domain.RestaurantAdminRole, domain.WaiterRole) {
+			return
 		}
+	}
+	details, err := h.Repos.Reservations.Get(c.Request.Context(), input.ReservationID)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		newResponse(c, http.StatusInternalServerError, "failed to get reservation details: "+err.Error())
 		return
 	}
-	if !statusResponse.GetStatus() {
-		newResponse(c, http.StatusInternalServerError, "unknown error when calling sign up:"+err.Error())
+	if details.GroupID != "" {
+		newResponse(c, http.StatusConflict, "reservations of a table combination can't be moved, cancel and book again")
 		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{"ok": statusResponse.Status})
-}
-
-func (h *Handler) deleteReservationById(c *gin.Context) {
-	id := c.Param("id")
-	if id == "" {
-		newResponse(c, http.StatusBadRequest, "missing ID in the URL")
+	if details.SeriesID != "" {
+		newResponse(c, http.StatusConflict, "occurrences of a series can't be moved, skip the occurrence and book again")
 		return
 	}
-	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
-	defer conn.Close()
-	if err != nil {
-		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+	if details.Status != "" && details.Status != domain.ReservationPending && details.Status != domain.ReservationConfirmed {
+		newResponse(c, http.StatusConflict, "can't move a reservation that is "+details.Status)
 		return
 	}
-	client := proto_reservation.NewReservationClient(conn)
-
-	reservation, err := client.DeleteReservationById(c.Request.Context(), &proto_reservation.IDRequest{Id: id})
-	if err != nil {
-		st, ok := status.FromError(err)
-		if !ok {
-			// Error was not a gRPC status error
-			newResponse(c, http.StatusInternalServerError, "unknown error when calling sign up:"+err.Error())
+	if input.PartySize == 0 {
+		if details.PartySize == 0 {
+			newValidationResponse(c, map[string]string{"party_size": "is required"})
 			return
 		}
-		switch st.Code() {
-		case codes.InvalidArgument:
-			newResponse(c, http.StatusBadRequest, "invalid argument: "+err.Error())
-		case codes.Internal:
-			newResponse(c, http.StatusInternalServerError, "microservice failed to execute functionality:"+err.Error())
-		default:
-			newResponse(c, http.StatusInternalServerError, "unknown error when calling sign up:"+err.Error())
-		}
+		input.PartySize = details.PartySize
+	}
+	start, table, ok := h.reservationSlot(c, input.TableID, input.ReservationTime)
+	if !ok {
 		return
 	}
-	c.JSON(http.StatusOK, reservation)
-}
-
-func (h *Handler) confirmReservation(c *gin.Context) {
-	id := c.Param("id")
-	if id == "" {
-		newResponse(c, http.StatusBadRequest, "missing ID in the URL")
+	if restaurantID != "" && table.GetRestaurant().GetId() != restaurantID {
+		newValidationResponse(c, map[string]string{"table_id": "must be a table of the same restaurant"})
 		return
 	}
-	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
-	defer conn.Close()
-	if err != nil {
-		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+	if !h.seatParty(c, table, start, input.PartySize, input.ReservationID) {
 		return
 	}
-	client := proto_reservation.NewReservationClient(conn)
 
-	ok, err := client.ConfirmReservation(c.Request.Context(), &proto_reservation.IDRequest{Id: id})
+	statusResponse, err := client.UpdateReservation(c.Request.Context(), &proto_reservation.UpdateReservationRequest{
+		ReservationID:   input.ReservationID,
+		TableID:         input.TableID,
+		ReservationTime: start.Format(time.RFC3339),
+	})
 	if err != nil {
 		st, ok := status.FromError(err)
 		if !ok {
@@ -238,18 +232,34 @@ func (h *Handler) confirmReservation(c *gin.Context) {
 			return
 		}
 		switch st.Code() {
-		case codes.NotFound:
-			newResponse(c, http.StatusBadRequest, err.Error())
-		case codes.InvalidArgument:
-			newResponse(c, http.StatusBadRequest, err.Error())
 		case codes.Internal:
-			newResponse(c, http.StatusInternalServerError, err.Error())
+			newResponse(c, http.StatusInternalServerError, "microservice failed to execute functionality:"+err.Error())
 		default:
-			newResponse(c, http.StatusInternalServerError, err.Error())
+			newResponse(c, http.StatusInternalServerError, "unknown error when calling sign up:"+err.Error())
 		}
 		return
 	}
-	c.JSON(http.StatusOK, ok)
+	if !statusResponse.GetStatus() {
+		newResponse(c, http.StatusInternalServerError, "unknown error when calling sign up:"+err.Error())
+		return
+	}
+	details.ReservationID = input.ReservationID
+	details.RestaurantID = table.GetRestaurant().GetId()
+	details.TableID = input.TableID
+	details.PartySize = input.PartySize
+	if details.CreatedAt.IsZero() {
+		details.CreatedAt = time.Now()
+	}
+	if err := h.Repos.Reservations.Save(c.Request.Context(), details); err != nil {
+		logger.Errorf("failed to save details of reservation %s: %v", input.ReservationID, err)
+	}
+	h.scheduleReminders(c.Request.Context(), input.ReservationID, reservation.GetUserID(), start)
+
+	c.JSON(http.StatusOK, gin.H{"ok": statusResponse.Status})
+}
+
+func (h *Handler) confirmReservation(c *gin.Context) {
+	h.changeStatus(c, "confirm", domain.ActorStaff, "")
 }
 
 func (h *Handler) getAllReservationsByUserId(c *gin.Context) {
@@ -284,7 +294,7 @@ func (h *Handler) getAllReservationsByUserId(c *gin.Context) {
 		}
 		return
 	}
-	c.JSON(http.StatusOK, reservations)
+	c.JSON(http.StatusOK, gin.H{"reservations": h.reservationResponses(c.Request.Context(), reservations.GetReservations(), domain.ActorGuest)})
 }
 
 func (h *Handler) getAllReservationsByRestaurantId(c *gin.Context) {
@@ -319,7 +329,7 @@ func (h *Handler) getAllReservationsByRestaurantId(c *gin.Context) {
 		}
 		return
 	}
-	c.JSON(http.StatusOK, reservations)
+	c.JSON(http.StatusOK, gin.H{"reservations": h.reservationResponses(c.Request.Context(), reservations.GetReservations(), domain.ActorStaff)})
 }
 
 func (h *Handler) getRestaurantByReservationId(c *gin.Context) {
@@ -396,3 +406,79 @@ func (h *Handler) getTableByReservationId(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, table)
 }
+
+// reservationServiceError maps an error of the reservation service to a response.
+func (h *Handler) reservationServiceError(c *gin.Context, err error) {
+	st, ok := status.FromError(err)
+	if !ok {
+		newResponse(c, http.StatusInternalServerError, "unknown error when calling reservation service:"+err.Error())
+		return
+	}
+	switch st.Code() {
+	case codes.NotFound:
+		newResponse(c, http.StatusNotFound, "not found: "+st.Message())
+	case codes.InvalidArgument:
+		newResponse(c, http.StatusBadRequest, "invalid argument: "+err.Error())
+	case codes.Internal:
+		newResponse(c, http.StatusInternalServerError, "microservice failed to execute functionality:"+err.Error())
+	default:
+		newResponse(c, http.StatusInternalServerError, "unknown error when calling reservation service:"+err.Error())
+	}
+}
+
+// withDetails adds the details kept by the gateway to a reservation, along with
+// the actions the actor may take on it.
+func (h *Handler) withDetails(ctx context.Context, reservation *proto_reservation.ReservationObject, actor string) reservationResponse {
+	resp := reservationResponse{ReservationObject: reservation}
+	details, err := h.reservationDetails(ctx, reservation)
+	if err != nil {
+		logger.Errorf("failed to get details of reservation %s: %v", reservation.GetId(), err)
+		return resp
+	}
+	resp.PartySize = details.PartySize
+	resp.Status = details.Status
+	resp.GuestConfirmedAt = details.GuestConfirmedAt
+	resp.Actions = domain.NextActions(details.Status, actor, h.reservationStart(ctx, reservation), time.Now())
+	return resp
+}
+
+func (h *Handler) reservationResponses(ctx context.Context, reservations []*proto_reservation.ReservationObject, actor string) []reservationResponse {
+	responses := make([]reservationResponse, 0, len(reservations))
+	for _, reservation := range reservations {
+		responses = append(responses, h.withDetails(ctx, reservation, actor))
+	}
+	return responses
+}
+
+// sendQR emails the user the QR code that confirms the reservation on arrival. It
+// writes the error response itself and reports whether the email was sent.
+func (h *Handler) sendQR(c *gin.Context, userID, reservationID string) bool {
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Notifications)
+	defer conn.Close()
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	mailerClient := proto_mailer.NewMailerClient(conn)
+	_, err = mailerClient.SendQR(c.Request.Context(), &proto_mailer.QRInput{
+		UserID:        userID,
+		ReservationID: reservationID,
+		QRUrlBase:     h.link("/api/reservations/confirm/"),
+	})
+	if err != nil {
+		st, ok := status.FromError(err)
+		if !ok {
+			// Error was not a gRPC status error
+			newResponse(c, http.StatusCreated, "unknown error when calling sending notification: "+err.Error())
+			return false
+		}
+		switch st.Code() {
+		case codes.Internal:
+			newResponse(c, http.StatusCreated, "failed to send reservation message: "+err.Error())
+		default:
+			newResponse(c, http.StatusCreated, "unknown error when sending notification: "+err.Error())
+		}
+		return false
+	}
+	return true
+}
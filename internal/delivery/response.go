@@ -2,6 +2,7 @@ package delivery
 
 import (
 	"github.com/gin-gonic/gin"
+	"net/http"
 	"reservista.kz/pkg/logger"
 )
 
@@ -11,5 +12,28 @@ type response struct {
 
 func newResponse(c *gin.Context, statusCode int, message string) {
 	logger.Error(message)
+	c.Set(errorCtx, message)
 	c.AbortWithStatusJSON(statusCode, response{message})
 }
+
+type validationResponse struct {
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields"`
+}
+
+// newValidationResponse reports what is wrong with each field of the input, keyed
+// by the JSON name of the field.
+func newValidationResponse(c *gin.Context, fields map[string]string) {
+	message := "invalid input"
+	logger.Errorf("%s: %v", message, fields)
+	c.Set(errorCtx, message)
+	c.AbortWithStatusJSON(http.StatusBadRequest, validationResponse{message, fields})
+}
+
+// seatingResponse is a rejected booking along with the tables that are free for
+// the party at the same time.
+type seatingResponse struct {
+	Message      string            `json:"message"`
+	Fields       map[string]string `json:"fields,omitempty"`
+	Alternatives []availableTable  `json:"alternatives"`
+}
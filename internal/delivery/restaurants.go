@@ -1,15 +1,17 @@
 package delivery
 
 import (
+	"context"
 	"fmt"
 	proto_restaurant "github.com/aidostt/protos/gen/go/reservista/restaurant"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"net/http"
 	"reservista.kz/internal/domain"
-	"strconv"
 	"strings"
+	"time"
 )
 
 func (h *Handler) restaurant(api *gin.RouterGroup) {
@@ -18,31 +20,31 @@ func (h *Handler) restaurant(api *gin.RouterGroup) {
 		restaurants.GET("/view/:id", h.getRestaurant)
 		restaurants.GET("/all", h.searchRestaurants)
 		restaurants.GET("/suggestions", h.getSuggestions)
+		restaurants.GET("/settings/:id", h.getRestaurantSettings)
+		restaurants.GET("/:id/availability", h.getAvailability)
+		restaurants.GET("/combinations/:id", h.getTableCombinations)
 		//admin, restaurant authorities
-		authenticated := restaurants.Group("/", h.userIdentity, h.isActivated(), h.isPermitted([]string{domain.AdminRole, domain.RestaurantAdminRole}))
+		authenticated := restaurants.Group("/", h.userIdentity, h.authorize, h.idempotency)
 		{
 			authenticated.POST("/add", h.addRestaurant)
 			authenticated.DELETE("/delete/:id", h.deleteRestaurantById)
 			authenticated.PATCH("/update/:id", h.updateRestById)
 			authenticated.POST("/photos/upload/:id", h.uploadRestaurantPhotos)
 			authenticated.DELETE("/photos/delete/:id", h.deleteRestaurantPhoto)
+			authenticated.POST("/staff/add/:id", h.addRestaurantStaff)
+			authenticated.PUT("/settings/:id", h.updateRestaurantSettings)
+			authenticated.POST("/combinations/add/:id", h.addTableCombination)
+			authenticated.DELETE("/combinations/delete/:id/:combinationID", h.deleteTableCombination)
+			authenticated.GET("/penalties/:id", h.getGuestPenalties)
 		}
 	}
 }
 func (h *Handler) searchRestaurants(c *gin.Context) {
 	query := c.Query("q")
-	page, err := strconv.Atoi(c.DefaultQuery("page", h.PageDefault))
-	if err != nil || page < 1 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page parameter"})
+	limit, offset, ok := h.pagination(c)
+	if !ok {
 		return
 	}
-	limit, err := strconv.Atoi(c.DefaultQuery("limit", h.LimitDefault))
-	if err != nil || limit < 1 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
-		return
-	}
-
-	offset := (page - 1) * limit
 	searchQuery := fmt.Sprintf("%%%s%%", strings.ToLower(query))
 
 	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
@@ -160,7 +162,9 @@ func (h *Handler) addRestaurant(c *gin.Context) {
 	}
 	client := proto_restaurant.NewRestaurantClient(conn)
 
+	proposedID := primitive.NewObjectID().Hex()
 	statusResponse, err := client.AddRestaurant(c.Request.Context(), &proto_restaurant.RestaurantObject{
+		Id:      proposedID,
 		Name:    input.Name,
 		Address: input.Address,
 		Contact: input.Contact,
@@ -187,7 +191,44 @@ func (h *Handler) addRestaurant(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"ok": statusResponse.Status})
+	restaurantID, err := h.createdRestaurantID(c.Request.Context(), client, proposedID, input)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "restaurant was created, but its id is unknown, so it has no staff yet: "+err.Error())
+		return
+	}
+	// the restaurant admin who creates a restaurant runs it, global admins don't
+	// need a membership
+	roles := c.GetStringSlice(roleCtx)
+	if !hasAnyPermittedRole(roles, []string{domain.AdminRole}) && hasAnyPermittedRole(roles, []string{domain.RestaurantAdminRole}) {
+		err = h.Repos.Staff.Add(c.Request.Context(), domain.StaffMember{
+			RestaurantID: restaurantID,
+			UserID:       c.GetString(idCtx),
+			Role:         domain.RestaurantAdminRole,
+			AddedBy:      c.GetString(idCtx),
+			CreatedAt:    time.Now(),
+		})
+		if err != nil {
+			newResponse(c, http.StatusInternalServerError, "restaurant was created, but adding you as its staff failed: "+err.Error())
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": statusResponse.Status, "id": restaurantID})
+}
+
+// createdRestaurantID checks that AddRestaurant kept the id the gateway proposed.
+// The service doesn't return the id, and looking the restaurant up by its details
+// would race with other restaurants created under the same name, so a restaurant
+// stored under another id is reported instead of guessed.
+func (h *Handler) createdRestaurantID(ctx context.Context, client proto_restaurant.RestaurantClient, proposedID string, input restaurantInput) (string, error) {
+	restaurant, err := client.GetRestaurant(ctx, &proto_restaurant.IDRequest{Id: proposedID})
+	if err != nil {
+		return "", fmt.Errorf("the restaurant service didn't keep the proposed id %s: %w", proposedID, err)
+	}
+	if restaurant.GetName() != input.Name {
+		return "", fmt.Errorf("the proposed id %s belongs to another restaurant", proposedID)
+	}
+	return proposedID, nil
 }
 
 func (h *Handler) updateRestById(c *gin.Context) {
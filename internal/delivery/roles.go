@@ -0,0 +1,141 @@
+package delivery
+
+import (
+	"context"
+	proto_user "github.com/aidostt/protos/gen/go/reservista/user"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"reservista.kz/internal/domain"
+)
+
+func (h *Handler) admin(api *gin.RouterGroup) {
+	admin := api.Group("/admin", h.userIdentity, h.authorize, h.idempotency)
+	{
+		admin.POST("/roles/assign", h.assignRole)
+		admin.POST("/roles/revoke", h.revokeRole)
+		admin.GET("/audit", h.getAuditLog)
+		admin.GET("/users", h.getUserDirectory)
+		admin.POST("/users/bulk", h.bulkUpdateUsers)
+		admin.POST("/suspensions/suspend", h.suspendUser)
+		admin.POST("/suspensions/lift", h.liftSuspension)
+		admin.GET("/suspensions/appeals", h.getPendingAppeals)
+		admin.POST("/suspensions/appeals/resolve", h.resolveAppeal)
+	}
+}
+
+func (h *Handler) assignRole(c *gin.Context) {
+	var input roleInput
+	if err := c.BindJSON(&input); err != nil {
+		newResponse(c, http.StatusBadRequest, "invalid input body: "+err.Error())
+		return
+	}
+	h.audit(c, "role.assign", map[string]string{"user_id": input.UserID})
+	before, after, err := h.updateUserRoles(c.Request.Context(), input.UserID, func(roles []string) []string {
+		return addRole(roles, input.Role)
+	})
+	if err != nil {
+		h.userServiceError(c, err)
+		return
+	}
+	h.auditChange(c, map[string]interface{}{"roles": before}, map[string]interface{}{"roles": after})
+	c.JSON(http.StatusOK, gin.H{"roles": after})
+}
+
+func (h *Handler) revokeRole(c *gin.Context) {
+	var input roleInput
+	if err := c.BindJSON(&input); err != nil {
+		newResponse(c, http.StatusBadRequest, "invalid input body: "+err.Error())
+		return
+	}
+	h.audit(c, "role.revoke", map[string]string{"user_id": input.UserID})
+	before, after, err := h.updateUserRoles(c.Request.Context(), input.UserID, func(roles []string) []string {
+		return removeRole(roles, input.Role)
+	})
+	if err != nil {
+		h.userServiceError(c, err)
+		return
+	}
+	h.auditChange(c, map[string]interface{}{"roles": before}, map[string]interface{}{"roles": after})
+	c.JSON(http.StatusOK, gin.H{"roles": after})
+}
+
+// updateUserRoles reads the user, applies change to its roles and writes the user
+// back, returning the roles before and after. The user service has no dedicated call
+// for roles, so the rest of the profile is sent unchanged without a password. This
+// relies on the user service keeping the stored password when Update gets an empty
+// one, the gateway can't send it back since it only ever sees the hash.
+func (h *Handler) updateUserRoles(ctx context.Context, userID string, change func([]string) []string) ([]string, []string, error) {
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Users)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+	client := proto_user.NewUserClient(conn)
+	user, err := client.GetByID(ctx, &proto_user.GetRequest{
+		UserId: userID,
+		Email:  domain.Plug,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	before := append([]string(nil), user.GetRoles()...)
+	roles := change(user.GetRoles())
+	statusResponse, err := client.Update(ctx, &proto_user.UpdateRequest{
+		Id:        userID,
+		Name:      user.GetName(),
+		Surname:   user.GetSurname(),
+		Phone:     user.GetPhone(),
+		Email:     user.GetEmail(),
+		Roles:     roles,
+		Activated: user.GetActivated(),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if !statusResponse.GetStatus() {
+		return nil, nil, status.Error(codes.Internal, "user service failed to update roles")
+	}
+	user.Roles = roles
+	h.recordProfile(ctx, userID, user)
+	return before, roles, nil
+}
+
+// userServiceError maps an error of the user service to a response.
+func (h *Handler) userServiceError(c *gin.Context, err error) {
+	st, ok := status.FromError(err)
+	if !ok {
+		newResponse(c, http.StatusInternalServerError, "unknown error when calling user service:"+err.Error())
+		return
+	}
+	switch st.Code() {
+	case codes.NotFound:
+		newResponse(c, http.StatusNotFound, "user not found")
+	case codes.InvalidArgument:
+		newResponse(c, http.StatusBadRequest, "invalid argument: "+err.Error())
+	case codes.Internal:
+		newResponse(c, http.StatusInternalServerError, "microservice failed to execute functionality:"+err.Error())
+	default:
+		newResponse(c, http.StatusInternalServerError, "unknown error when calling user service:"+err.Error())
+	}
+}
+
+func addRole(roles []string, role string) []string {
+	for _, r := range roles {
+		if r == role {
+			return roles
+		}
+	}
+	return append(roles, role)
+}
+
+func removeRole(roles []string, role string) []string {
+	result := make([]string, 0, len(roles))
+	for _, r := range roles {
+		if r != role {
+			result = append(result, r)
+		}
+	}
+	return result
+}
@@ -0,0 +1,216 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	proto_reservation "github.com/aidostt/protos/gen/go/reservista/reservation"
+	proto_table "github.com/aidostt/protos/gen/go/reservista/table"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"reservista.kz/internal/domain"
+	"reservista.kz/pkg/logger"
+	"strconv"
+	"time"
+)
+
+// ReservationPolicy limits when reservations may start and how long they hold a
+// table. Location is the timezone of restaurants that have none of their own.
+type ReservationPolicy struct {
+	Location     *time.Location
+	SlotInterval time.Duration
+	LeadTime     time.Duration
+	MaxAdvance   time.Duration
+	Duration     time.Duration
+	Turnover     time.Duration
+}
+
+func (h *Handler) getRestaurantSettings(c *gin.Context) {
+	settings, err := h.restaurantSettings(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get restaurant settings: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+func (h *Handler) updateRestaurantSettings(c *gin.Context) {
+	var input restaurantSettingsInput
+	if err := c.BindJSON(&input); err != nil {
+		h.bindingError(c, err)
+		return
+	}
+	if input.Timezone != nil {
+		if _, err := time.LoadLocation(*input.Timezone); err != nil || *input.Timezone == "" {
+			newValidationResponse(c, map[string]string{"timezone": "must be an IANA timezone, e.g. Asia/Almaty"})
+			return
+		}
+	}
+	settings, err := h.restaurantSettings(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get restaurant settings: "+err.Error())
+		return
+	}
+	before := map[string]interface{}{"timezone": settings.Timezone, "minOccupancy": settings.MinOccupancy, "cancellation": settings.Cancellation}
+	if input.Timezone != nil {
+		settings.Timezone = *input.Timezone
+	}
+	if input.MinOccupancy != nil {
+		settings.MinOccupancy = *input.MinOccupancy
+	}
+	if input.FreeCancelMinutes != nil {
+		settings.Cancellation.FreeCancelMinutes = *input.FreeCancelMinutes
+	}
+	if input.CancelCutoff != nil {
+		settings.Cancellation.CutoffMinutes = *input.CancelCutoff
+	}
+	if input.MaxPenalties != nil {
+		settings.Cancellation.MaxPenalties = *input.MaxPenalties
+	}
+	settings.UpdatedBy = c.GetString(idCtx)
+	settings.UpdatedAt = time.Now()
+	if err := h.Repos.Restaurants.Save(c.Request.Context(), settings); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to save restaurant settings: "+err.Error())
+		return
+	}
+	h.audit(c, "restaurant.settings.update", nil)
+	h.auditChange(c, before, map[string]interface{}{"timezone": settings.Timezone, "minOccupancy": settings.MinOccupancy, "cancellation": settings.Cancellation})
+	c.JSON(http.StatusOK, settings)
+}
+
+// restaurantSettings returns the stored settings, or empty ones for restaurants
+// that were never configured.
+func (h *Handler) restaurantSettings(ctx context.Context, restaurantID string) (domain.RestaurantSettings, error) {
+	settings, err := h.Repos.Restaurants.Get(ctx, restaurantID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return domain.RestaurantSettings{RestaurantID: restaurantID}, nil
+	}
+	return settings, err
+}
+
+func (h *Handler) restaurantLocation(ctx context.Context, restaurantID string) (*time.Location, error) {
+	settings, err := h.restaurantSettings(ctx, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	return h.location(settings)
+}
+
+func (h *Handler) location(settings domain.RestaurantSettings) (*time.Location, error) {
+	if settings.Timezone == "" {
+		return h.Reservation.Location, nil
+	}
+	return time.LoadLocation(settings.Timezone)
+}
+
+// reservationSlot validates the table and start time of a reservation. The time
+// is returned in the timezone of the restaurant, along with the table.
+// It writes the error response itself and reports whether the input was valid.
+func (h *Handler) reservationSlot(c *gin.Context, tableID, reservationTime string) (time.Time, *proto_table.TableObject, bool) {
+	fields := make(map[string]string)
+	if _, err := h.TokenManager.HexToObjectID(tableID); err != nil {
+		fields["table_id"] = "must be a valid id"
+	}
+	start, err := time.Parse(time.RFC3339, reservationTime)
+	if err != nil {
+		fields["reservation_time"] = "must be an RFC 3339 time, e.g. 2024-05-01T19:30:00+05:00"
+	}
+	if len(fields) > 0 {
+		newValidationResponse(c, fields)
+		return time.Time{}, nil, false
+	}
+
+	table, err := h.fetchTable(c.Request.Context(), tableID)
+	if err != nil {
+		if code := status.Code(err); code == codes.NotFound || code == codes.InvalidArgument {
+			newValidationResponse(c, map[string]string{"table_id": "table not found"})
+			return time.Time{}, nil, false
+		}
+		newResponse(c, http.StatusInternalServerError, "failed to get table: "+err.Error())
+		return time.Time{}, nil, false
+	}
+	start, ok := h.restaurantSlot(c, table.GetRestaurant().GetId(), start)
+	if !ok {
+		return time.Time{}, nil, false
+	}
+	return start, table, true
+}
+
+// restaurantSlot converts start to the timezone of the restaurant and checks that
+// it can be booked. It writes the error response itself.
+func (h *Handler) restaurantSlot(c *gin.Context, restaurantID string, start time.Time) (time.Time, bool) {
+	loc, err := h.restaurantLocation(c.Request.Context(), restaurantID)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get restaurant timezone: "+err.Error())
+		return time.Time{}, false
+	}
+	start = start.In(loc)
+	if message := h.checkSlot(start, time.Now()); message != "" {
+		newValidationResponse(c, map[string]string{"reservation_time": message})
+		return time.Time{}, false
+	}
+	return start, true
+}
+
+// checkSlot returns why start can't be booked at now, or an empty string.
+func (h *Handler) checkSlot(start, now time.Time) string {
+	rules := h.Reservation
+	if start.Before(now.Add(rules.LeadTime)) {
+		if rules.LeadTime == 0 {
+			return "must be in the future"
+		}
+		return "must be at least " + rules.LeadTime.String() + " from now"
+	}
+	if rules.MaxAdvance > 0 && start.After(now.Add(rules.MaxAdvance)) {
+		return "must be within " + strconv.Itoa(int(rules.MaxAdvance.Hours()/24)) + " days from now"
+	}
+	midnight := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	if rules.SlotInterval > 0 && start.Sub(midnight)%rules.SlotInterval != 0 {
+		return "must start on a " + rules.SlotInterval.String() + " slot"
+	}
+	return ""
+}
+
+// reservationStart is the start of a reservation. The gateway sends RFC 3339
+// times, which carry their offset. Reservations booked before that combine their
+// date with a "15:04" wall clock time without one, which was meant in the
+// timezone of the restaurant.
+func (h *Handler) reservationStart(ctx context.Context, reservation *proto_reservation.ReservationObject) time.Time {
+	if start, err := time.Parse(time.RFC3339, reservation.GetReservationTime()); err == nil {
+		return start
+	}
+	date := reservation.GetReservationDate().AsTime()
+	t, err := time.Parse("15:04", reservation.GetReservationTime())
+	if err != nil {
+		return date
+	}
+	location := h.legacyLocation(ctx, reservation)
+	return time.Date(date.Year(), date.Month(), date.Day(), t.Hour(), t.Minute(), 0, 0, location)
+}
+
+// legacyLocation is the timezone of the restaurant of a reservation with a legacy
+// time. When it can't be told, the default timezone of reservations is used.
+func (h *Handler) legacyLocation(ctx context.Context, reservation *proto_reservation.ReservationObject) *time.Location {
+	location := h.Reservation.Location
+	if location == nil {
+		location = time.UTC
+	}
+	restaurantID := reservation.GetTable().GetRestaurant().GetId()
+	if restaurantID == "" {
+		var err error
+		if restaurantID, err = h.restaurantOfReservation(ctx, reservation.GetId()); err != nil {
+			logger.Errorf("failed to get restaurant of reservation %s: %v", reservation.GetId(), err)
+			return location
+		}
+	}
+	loc, err := h.restaurantLocation(ctx, restaurantID)
+	if err != nil {
+		logger.Errorf("failed to get timezone of restaurant %s: %v", restaurantID, err)
+		return location
+	}
+	if loc == nil {
+		return location
+	}
+	return loc
+}
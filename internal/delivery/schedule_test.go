@@ -0,0 +1,56 @@
+package delivery
+
+import (
+	"context"
+	proto_reservation "github.com/aidostt/protos/gen/go/reservista/reservation"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"reservista.kz/internal/domain"
+	"reservista.kz/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestReservationStart(t *testing.T) {
+	almaty := time.FixedZone("Asia/Almaty", 5*60*60)
+	h := &Handler{Reservation: ReservationPolicy{Location: almaty}, Repos: repository.NewRepositories(10)}
+	if err := h.Repos.Restaurants.Save(context.Background(), domain.RestaurantSettings{RestaurantID: "restaurant-1", Timezone: "UTC"}); err != nil {
+		t.Fatal(err)
+	}
+	date := timestamppb.New(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+	table := func(restaurantID string) *proto_reservation.TableObject {
+		return &proto_reservation.TableObject{Restaurant: &proto_reservation.RestaurantObject{Id: restaurantID}}
+	}
+	tests := []struct {
+		name        string
+		reservation *proto_reservation.ReservationObject
+		want        time.Time
+	}{
+		{
+			name:        "rfc 3339 keeps its offset",
+			reservation: &proto_reservation.ReservationObject{ReservationTime: "2024-05-01T19:30:00+03:00", ReservationDate: date},
+			want:        time.Date(2024, 5, 1, 16, 30, 0, 0, time.UTC),
+		},
+		{
+			name:        "legacy time is read in the timezone of the restaurant",
+			reservation: &proto_reservation.ReservationObject{ReservationTime: "19:30", ReservationDate: date, Table: table("restaurant-1")},
+			want:        time.Date(2024, 5, 1, 19, 30, 0, 0, time.UTC),
+		},
+		{
+			name:        "legacy time of a restaurant without one is read in the default timezone",
+			reservation: &proto_reservation.ReservationObject{ReservationTime: "19:30", ReservationDate: date, Table: table("restaurant-2")},
+			want:        time.Date(2024, 5, 1, 19, 30, 0, 0, almaty),
+		},
+		{
+			name:        "unknown time falls back to the date",
+			reservation: &proto_reservation.ReservationObject{ReservationTime: "evening", ReservationDate: date},
+			want:        date.AsTime(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.reservationStart(context.Background(), tt.reservation); !got.Equal(tt.want) {
+				t.Errorf("reservationStart = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	proto_reservation "github.com/aidostt/protos/gen/go/reservista/reservation"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"reservista.kz/internal/domain"
+	"reservista.kz/pkg/logger"
+	"strconv"
+	"time"
+)
+
+// makeSeriesReservation books a table for every occurrence of a recurrence rule.
+// Occurrences whose table is taken fail the whole series, unless skip_conflicts
+// leaves them out. Like table combinations, the reservations already made are
+// cancelled again when the reservation service fails halfway.
+func (h *Handler) makeSeriesReservation(c *gin.Context) {
+	var input seriesReservationInput
+	if err := c.BindJSON(&input); err != nil {
+		h.bindingError(c, err)
+		return
+	}
+	userID := c.GetString(idCtx)
+	start, table, ok := h.reservationSlot(c, input.TableID, input.ReservationTime)
+	if !ok {
+		return
+	}
+	restaurantID := table.GetRestaurant().GetId()
+	rule, err := domain.ParseRecurrence(input.RRule, start.Location())
+	if err != nil {
+		newValidationResponse(c, map[string]string{"rrule": err.Error()})
+		return
+	}
+	starts := rule.Occurrences(start, domain.MaxSeriesOccurrences+1)
+	if len(starts) > domain.MaxSeriesOccurrences {
+		newValidationResponse(c, map[string]string{"rrule": "must have at most " + strconv.Itoa(domain.MaxSeriesOccurrences) + " occurrences"})
+		return
+	}
+	now := time.Now()
+	for _, occurrence := range starts {
+		if message := h.checkSlot(occurrence, now); message != "" {
+			newValidationResponse(c, map[string]string{"rrule": "the occurrence on " + occurrence.Format("2006-01-02") + " " + message})
+			return
+		}
+	}
+	if !h.checkPenalties(c, restaurantID, userID) {
+		return
+	}
+
+	settings, err := h.restaurantSettings(c.Request.Context(), restaurantID)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get restaurant settings: "+err.Error())
+		return
+	}
+	if !fits(table, input.PartySize, settings.MinOccupancy) {
+		newValidationResponse(c, map[string]string{"party_size": "the table doesn't fit the party"})
+		return
+	}
+	_, booked, err := h.restaurantBookings(c.Request.Context(), restaurantID)
+	if err != nil {
+		h.reservationServiceError(c, err)
+		return
+	}
+	occurrences := make([]domain.SeriesOccurrence, 0, len(starts))
+	conflicts := make([]time.Time, 0)
+	for _, occurrence := range starts {
+		status := domain.OccurrenceBooked
+		if !booked.free(table.GetId(), occurrence, h.blockedFor(), "") {
+			status = domain.OccurrenceConflict
+			conflicts = append(conflicts, occurrence)
+		}
+		occurrences = append(occurrences, domain.SeriesOccurrence{Start: occurrence, Status: status})
+	}
+	if len(conflicts) == len(starts) || (len(conflicts) > 0 && !input.SkipConflicts) {
+		c.Set(errorCtx, "the table is already reserved at some occurrences")
+		c.AbortWithStatusJSON(http.StatusConflict, seriesConflictResponse{
+			Message:   "the table is already reserved at some occurrences",
+			Conflicts: conflicts,
+		})
+		return
+	}
+
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
+	defer conn.Close()
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return
+	}
+	client := proto_reservation.NewReservationClient(conn)
+
+	series := domain.ReservationSeries{
+		ID:           primitive.NewObjectID().Hex(),
+		UserID:       userID,
+		RestaurantID: restaurantID,
+		TableID:      table.GetId(),
+		PartySize:    input.PartySize,
+		Rule:         input.RRule,
+		Recurrence:   rule,
+		Status:       domain.SeriesActive,
+		Occurrences:  occurrences,
+		CreatedAt:    now,
+	}
+	var reservationIDs []string
+	for i, occurrence := range series.Occurrences {
+		if occurrence.Status != domain.OccurrenceBooked {
+			continue
+		}
+		resp, err := client.MakeReservation(c.Request.Context(), &proto_reservation.ReservationSQLRequest{
+			UserID:          userID,
+			TableID:         table.GetId(),
+			ReservationTime: occurrence.Start.Format(time.RFC3339),
+		})
+		if err != nil {
+			h.cancelReservations(context.Background(), reservationIDs)
+			h.reservationServiceError(c, err)
+			return
+		}
+		series.Occurrences[i].ReservationID = resp.GetId()
+		reservationIDs = append(reservationIDs, resp.GetId())
+	}
+	for _, reservationID := range reservationIDs {
+		err := h.Repos.Reservations.Save(c.Request.Context(), domain.ReservationDetails{
+			ReservationID: reservationID,
+			UserID:        userID,
+			RestaurantID:  restaurantID,
+			TableID:       table.GetId(),
+			PartySize:     input.PartySize,
+			SeriesID:      series.ID,
+			Status:        domain.ReservationPending,
+			CreatedAt:     now,
+		})
+		if err != nil {
+			logger.Errorf("failed to save details of reservation %s: %v", reservationID, err)
+		}
+	}
+	for _, occurrence := range series.Occurrences {
+		if occurrence.ReservationID != "" {
+			h.scheduleReminders(c.Request.Context(), occurrence.ReservationID, userID, occurrence.Start)
+		}
+	}
+	if err := h.Repos.Series.Save(c.Request.Context(), series); err != nil {
+		h.cancelReservations(context.Background(), reservationIDs)
+		newResponse(c, http.StatusInternalServerError, "failed to save reservation series: "+err.Error())
+		return
+	}
+	h.audit(c, "reservation.series.make", map[string]string{"seriesID": series.ID, "reservations": strconv.Itoa(len(reservationIDs))})
+	// one mail per occurrence would flood the guest, the first one is what's next
+	if !h.sendQR(c, userID, reservationIDs[0]) {
+		return
+	}
+	c.JSON(http.StatusCreated, h.seriesResponse(c.Request.Context(), series))
+}
+
+func (h *Handler) getSeries(c *gin.Context) {
+	series, ok := h.ownSeries(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, h.seriesResponse(c.Request.Context(), series))
+}
+
+func (h *Handler) getUserSeries(c *gin.Context) {
+	list, err := h.Repos.Series.GetByUser(c.Request.Context(), c.GetString(idCtx))
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get reservation series: "+err.Error())
+		return
+	}
+	responses := make([]seriesResponse, 0, len(list))
+	for _, series := range list {
+		responses = append(responses, h.seriesResponse(c.Request.Context(), series))
+	}
+	c.JSON(http.StatusOK, responses)
+}
+
+// skipOccurrence cancels the occurrence of a series on a date and keeps the rest.
+func (h *Handler) skipOccurrence(c *gin.Context) {
+	var input skipOccurrenceInput
+	if err := c.BindJSON(&input); err != nil {
+		h.bindingError(c, err)
+		return
+	}
+	series, ok := h.ownSeries(c)
+	if !ok {
+		return
+	}
+	i := -1
+	for j, occurrence := range series.Occurrences {
+		if occurrence.Start.Format("2006-01-02") == input.Date {
+			i = j
+		}
+	}
+	if i == -1 {
+		newValidationResponse(c, map[string]string{"date": "the series has no occurrence on this date"})
+		return
+	}
+	occurrence := series.Occurrences[i]
+	if occurrence.Status == domain.OccurrenceSkipped || occurrence.Status == domain.OccurrenceCancelled {
+		newResponse(c, http.StatusConflict, "the occurrence is already "+occurrence.Status)
+		return
+	}
+
+	var penalty string
+	if occurrence.ReservationID != "" {
+		settings, err := h.restaurantSettings(c.Request.Context(), series.RestaurantID)
+		if err != nil {
+			newResponse(c, http.StatusInternalServerError, "failed to get restaurant settings: "+err.Error())
+			return
+		}
+		details, err := h.Repos.Reservations.Get(c.Request.Context(), occurrence.ReservationID)
+		if err != nil {
+			newResponse(c, http.StatusInternalServerError, "failed to get reservation details: "+err.Error())
+			return
+		}
+		// a reservation cancelled on its own only needs the series to catch up
+		if !details.Final() {
+			details, penalty, err = guestCancel(details, occurrence.Start, settings, c.GetString(idCtx), time.Now())
+			if err != nil {
+				newResponse(c, http.StatusConflict, err.Error())
+				return
+			}
+			conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
+			if err != nil {
+				newResponse(c, http.StatusInternalServerError, "something went wrong...")
+				return
+			}
+			defer conn.Close()
+			err = h.saveCancellation(c.Request.Context(), proto_reservation.NewReservationClient(conn), details, occurrence.Start, penalty)
+			if err != nil {
+				if _, fromService := status.FromError(err); fromService {
+					h.reservationServiceError(c, err)
+					return
+				}
+				newResponse(c, http.StatusInternalServerError, "failed to save reservation status: "+err.Error())
+				return
+			}
+		}
+	}
+	series.Occurrences[i].Status = domain.OccurrenceSkipped
+	if err := h.Repos.Series.Save(c.Request.Context(), series); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to save reservation series: "+err.Error())
+		return
+	}
+	h.audit(c, "reservation.series.skip", map[string]string{"seriesID": series.ID, "date": input.Date})
+	c.JSON(http.StatusOK, seriesChangeResponse{Series: h.seriesResponse(c.Request.Context(), series), Penalties: penaltyCount(penalty)})
+}
+
+// cancelSeries cancels every upcoming occurrence of a series. Occurrences the
+// cancellation policy holds on to stay booked and are listed with the reason.
+func (h *Handler) cancelSeries(c *gin.Context) {
+	series, ok := h.ownSeries(c)
+	if !ok {
+		return
+	}
+	if series.Status == domain.SeriesCancelled {
+		newResponse(c, http.StatusConflict, "the series is already cancelled")
+		return
+	}
+	settings, err := h.restaurantSettings(c.Request.Context(), series.RestaurantID)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get restaurant settings: "+err.Error())
+		return
+	}
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return
+	}
+	defer conn.Close()
+	client := proto_reservation.NewReservationClient(conn)
+	now := time.Now()
+	var resp seriesChangeResponse
+	for i, occurrence := range series.Occurrences {
+		if occurrence.Status != domain.OccurrenceBooked || !occurrence.Start.After(now) {
+			continue
+		}
+		details, err := h.Repos.Reservations.Get(c.Request.Context(), occurrence.ReservationID)
+		if err != nil {
+			newResponse(c, http.StatusInternalServerError, "failed to get reservation details: "+err.Error())
+			return
+		}
+		if details.Final() {
+			continue
+		}
+		details, penalty, err := guestCancel(details, occurrence.Start, settings, c.GetString(idCtx), now)
+		if err != nil {
+			resp.Kept = append(resp.Kept, keptOccurrence{Start: occurrence.Start, ReservationID: occurrence.ReservationID, Reason: err.Error()})
+			continue
+		}
+		if err := h.saveCancellation(c.Request.Context(), client, details, occurrence.Start, penalty); err != nil {
+			resp.Kept = append(resp.Kept, keptOccurrence{Start: occurrence.Start, ReservationID: occurrence.ReservationID, Reason: "failed to cancel: " + err.Error()})
+			continue
+		}
+		series.Occurrences[i].Status = domain.OccurrenceCancelled
+		resp.Penalties += penaltyCount(penalty)
+	}
+	series.Status = domain.SeriesCancelled
+	if err := h.Repos.Series.Save(c.Request.Context(), series); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to save reservation series: "+err.Error())
+		return
+	}
+	h.audit(c, "reservation.series.cancel", map[string]string{"seriesID": series.ID, "kept": strconv.Itoa(len(resp.Kept))})
+	resp.Series = h.seriesResponse(c.Request.Context(), series)
+	c.JSON(http.StatusOK, resp)
+}
+
+// guestCancel cancels a reservation on behalf of the guest, within the
+// cancellation policy of the restaurant. It returns the cancelled details and the
+// penalty of a late cancellation.
+func guestCancel(details domain.ReservationDetails, start time.Time, settings domain.RestaurantSettings, by string, now time.Time) (domain.ReservationDetails, string, error) {
+	to, err := domain.Transition(details.Status, "cancel", domain.ActorGuest, start, now)
+	if err != nil {
+		return details, "", err
+	}
+	penalty, err := settings.Cancellation.CheckCancel(start, now)
+	if err != nil {
+		return details, "", err
+	}
+	details.History = append(details.History, domain.ReservationEvent{Action: "cancel", From: details.Status, To: to, By: by, At: now})
+	details.Status = to
+	return details, penalty, nil
+}
+
+// saveCancellation carries out a cancellation made by guestCancel: the reservation
+// is deleted in the reservation service first, like changeStatus does, and only
+// then stored as cancelled. It records the penalty and offers the freed table to
+// the waitlist.
+func (h *Handler) saveCancellation(ctx context.Context, client proto_reservation.ReservationClient, details domain.ReservationDetails, start time.Time, penalty string) error {
+	if err := deleteReservation(ctx, client, details.ReservationID); err != nil {
+		return err
+	}
+	if err := h.Repos.Reservations.Save(ctx, details); err != nil {
+		logger.Errorf("failed to save cancellation of reservation %s: %v", details.ReservationID, err)
+		return err
+	}
+	if penalty != "" {
+		h.addPenalty(ctx, details.UserID, details.RestaurantID, details.ReservationID, penalty, time.Now())
+	}
+	h.offerTables(ctx, details.RestaurantID, start)
+	return nil
+}
+
+func (h *Handler) ownSeries(c *gin.Context) (domain.ReservationSeries, bool) {
+	series, err := h.Repos.Series.Get(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, domain.ErrNotFound) || (err == nil && series.UserID != c.GetString(idCtx)) {
+		newResponse(c, http.StatusNotFound, "reservation series not found")
+		return domain.ReservationSeries{}, false
+	}
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get reservation series: "+err.Error())
+		return domain.ReservationSeries{}, false
+	}
+	return series, true
+}
+
+// seriesResponse adds the status of their reservation to the booked occurrences.
+func (h *Handler) seriesResponse(ctx context.Context, series domain.ReservationSeries) seriesResponse {
+	resp := seriesResponse{ReservationSeries: series, Occurrences: make([]occurrenceResponse, 0, len(series.Occurrences))}
+	for _, occurrence := range series.Occurrences {
+		occurrenceResp := occurrenceResponse{SeriesOccurrence: occurrence}
+		if occurrence.ReservationID != "" {
+			if details, err := h.Repos.Reservations.Get(ctx, occurrence.ReservationID); err == nil {
+				occurrenceResp.ReservationStatus = details.Status
+			}
+		}
+		resp.Occurrences = append(resp.Occurrences, occurrenceResp)
+	}
+	return resp
+}
+
+func penaltyCount(penalty string) int {
+	if penalty == "" {
+		return 0
+	}
+	return 1
+}
@@ -9,17 +9,15 @@ import (
 	"net/http"
 )
 
+// refresh issues new tokens. The jwt cookie expires together with the access
+// token, so it may already be gone, the refresh token alone identifies the session.
 func (h *Handler) refresh(c *gin.Context) {
-	jwt, err := c.Cookie("jwt")
-	if err != nil {
-		if errors.Is(err, http.ErrNoCookie) {
-			newResponse(c, http.StatusUnauthorized, "unauthorized access")
-			return
-		}
+	jwt, err := h.cookie(c, jwtCookie)
+	if err != nil && !errors.Is(err, http.ErrNoCookie) {
 		newResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
-	rt, err := c.Cookie("RT")
+	rt, err := h.cookie(c, refreshCookie)
 	if err != nil {
 		if errors.Is(err, http.ErrNoCookie) {
 			newResponse(c, http.StatusUnauthorized, "unauthorized access")
@@ -0,0 +1,288 @@
+package delivery
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	proto_restaurant "github.com/aidostt/protos/gen/go/reservista/restaurant"
+	proto_user "github.com/aidostt/protos/gen/go/reservista/user"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"reservista.kz/internal/domain"
+	"strings"
+	"time"
+)
+
+func (h *Handler) staff(api *gin.RouterGroup) {
+	staff := api.Group("/staff", h.userIdentity, h.authorize, h.idempotency)
+	{
+		staff.POST("/invite", h.inviteStaff)
+		staff.GET("/invite/accept/:token", h.getStaffInvite)
+		staff.POST("/invite/accept/:token", h.acceptStaffInvite)
+		staff.GET("/all/restaurant/:id", h.getStaffByRestaurantId)
+		staff.DELETE("/remove/:id/:userID", h.removeStaff)
+	}
+}
+
+// addRestaurantStaff lets a global admin attach any user to a restaurant directly.
+func (h *Handler) addRestaurantStaff(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		newResponse(c, http.StatusBadRequest, "missing ID in the URL")
+		return
+	}
+	var input staffInput
+	if err := c.BindJSON(&input); err != nil {
+		newResponse(c, http.StatusBadRequest, "invalid input body: "+err.Error())
+		return
+	}
+	adminID, exists := c.Get(idCtx)
+	if !exists {
+		newResponse(c, http.StatusUnauthorized, "missing id in context")
+		return
+	}
+	h.audit(c, "staff.add", map[string]string{"user_id": input.UserID})
+	member, err := h.addStaffMember(c.Request.Context(), id, input.UserID, input.Role, adminID.(string))
+	if err != nil {
+		h.userServiceError(c, err)
+		return
+	}
+	h.auditChange(c, nil, map[string]interface{}{"role": member.Role})
+	c.JSON(http.StatusOK, member)
+}
+
+func (h *Handler) inviteStaff(c *gin.Context) {
+	var input staffInviteInput
+	if err := c.BindJSON(&input); err != nil {
+		newResponse(c, http.StatusBadRequest, "invalid input body: "+err.Error())
+		return
+	}
+	if !h.authorizeRestaurant(c, input.RestaurantID, domain.RestaurantAdminRole) {
+		return
+	}
+	userID, exists := c.Get(idCtx)
+	if !exists {
+		newResponse(c, http.StatusUnauthorized, "missing id in context")
+		return
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to generate invite: "+err.Error())
+		return
+	}
+	token := hex.EncodeToString(b)
+	tokenHash, err := h.SecretHasher.Hash(token)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to generate invite: "+err.Error())
+		return
+	}
+	now := time.Now()
+	invite := domain.StaffInvite{
+		ID:           primitive.NewObjectID().Hex(),
+		TokenHash:    tokenHash,
+		RestaurantID: input.RestaurantID,
+		Email:        strings.ToLower(input.Email),
+		Role:         domain.WaiterRole,
+		InvitedBy:    userID.(string),
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(h.InviteTTL),
+	}
+	if err := h.Repos.Invites.Create(c.Request.Context(), invite); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to save invite: "+err.Error())
+		return
+	}
+
+	restaurant := invite.RestaurantID
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return
+	}
+	defer conn.Close()
+	if r, err := proto_restaurant.NewRestaurantClient(conn).GetRestaurant(c.Request.Context(), &proto_restaurant.IDRequest{Id: invite.RestaurantID}); err == nil {
+		restaurant = r.GetName()
+	}
+	err = h.sendMail(c.Request.Context(), invite.Email, "staffInvite", map[string]interface{}{
+		"Restaurant": restaurant,
+		"Role":       invite.Role,
+		"Email":      invite.Email,
+		"Link":       h.link("/api/staff/invite/accept/" + token),
+		"ExpiresAt":  invite.ExpiresAt,
+	})
+	if err != nil {
+		newResponse(c, http.StatusCreated, "invite is created, but failed to send invite email: "+err.Error())
+		return
+	}
+	h.audit(c, "staff.invite", map[string]string{"restaurant_id": invite.RestaurantID, "invite_id": invite.ID})
+	c.JSON(http.StatusCreated, invite)
+}
+
+// getStaffInvite shows the invite the link of the mail points to, accepting it
+// takes a POST to the same URL.
+func (h *Handler) getStaffInvite(c *gin.Context) {
+	invite, ok := h.staffInviteByToken(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, invite)
+}
+
+// acceptStaffInvite makes the signed in user a staff member of the inviting
+// restaurant. The invite is bound to the email it was sent to.
+func (h *Handler) acceptStaffInvite(c *gin.Context) {
+	userID, exists := c.Get(idCtx)
+	if !exists {
+		newResponse(c, http.StatusUnauthorized, "missing id in context")
+		return
+	}
+	invite, ok := h.staffInviteByToken(c)
+	if !ok {
+		return
+	}
+
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Users)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return
+	}
+	defer conn.Close()
+	user, err := proto_user.NewUserClient(conn).GetByID(c.Request.Context(), &proto_user.GetRequest{
+		UserId: userID.(string),
+		Email:  domain.Plug,
+	})
+	if err != nil {
+		h.userServiceError(c, err)
+		return
+	}
+	if !strings.EqualFold(user.GetEmail(), invite.Email) {
+		newResponse(c, http.StatusForbidden, "invite was sent to another email")
+		return
+	}
+
+	if _, err := h.addStaffMember(c.Request.Context(), invite.RestaurantID, userID.(string), invite.Role, invite.InvitedBy); err != nil {
+		h.userServiceError(c, err)
+		return
+	}
+	now := time.Now()
+	invite.AcceptedAt = &now
+	if err := h.Repos.Invites.Update(c.Request.Context(), invite); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to update invite: "+err.Error())
+		return
+	}
+	h.audit(c, "staff.invite.accept", map[string]string{"restaurant_id": invite.RestaurantID, "invite_id": invite.ID})
+	h.auditChange(c, nil, map[string]interface{}{"role": invite.Role})
+	// the new role has to be in the jwt before it can be used
+	h.signInByID(c, userID.(string))
+}
+
+// staffInviteByToken finds the pending invite of the token in the URL. It writes
+// the error response itself and reports whether the invite was found.
+func (h *Handler) staffInviteByToken(c *gin.Context) (domain.StaffInvite, bool) {
+	token := c.Param("token")
+	if token == "" {
+		newResponse(c, http.StatusBadRequest, "missing token in the URL")
+		return domain.StaffInvite{}, false
+	}
+	tokenHash, err := h.SecretHasher.Hash(token)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return domain.StaffInvite{}, false
+	}
+	invite, err := h.Repos.Invites.GetByTokenHash(c.Request.Context(), tokenHash)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			newResponse(c, http.StatusBadRequest, domain.ErrInviteInvalid.Error())
+			return domain.StaffInvite{}, false
+		}
+		newResponse(c, http.StatusInternalServerError, "failed to get invite: "+err.Error())
+		return domain.StaffInvite{}, false
+	}
+	if invite.AcceptedAt != nil || time.Now().After(invite.ExpiresAt) {
+		newResponse(c, http.StatusBadRequest, domain.ErrInviteInvalid.Error())
+		return domain.StaffInvite{}, false
+	}
+	return invite, true
+}
+
+func (h *Handler) getStaffByRestaurantId(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		newResponse(c, http.StatusBadRequest, "missing ID in the URL")
+		return
+	}
+	members, err := h.Repos.Staff.GetByRestaurant(c.Request.Context(), id)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get staff: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, members)
+}
+
+// removeStaff ends the membership and takes the staff role away once the user
+// doesn't hold it at any other restaurant.
+func (h *Handler) removeStaff(c *gin.Context) {
+	restaurantID, userID := c.Param("id"), c.Param("userID")
+	if restaurantID == "" || userID == "" {
+		newResponse(c, http.StatusBadRequest, "missing ID in the URL")
+		return
+	}
+	member, err := h.Repos.Staff.Get(c.Request.Context(), restaurantID, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			newResponse(c, http.StatusNotFound, "staff member not found")
+			return
+		}
+		newResponse(c, http.StatusInternalServerError, "failed to get staff member: "+err.Error())
+		return
+	}
+	if err := h.Repos.Staff.Remove(c.Request.Context(), restaurantID, userID); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to remove staff member: "+err.Error())
+		return
+	}
+
+	memberships, err := h.Repos.Staff.GetByUser(c.Request.Context(), userID)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get memberships: "+err.Error())
+		return
+	}
+	stillHeld := false
+	for _, m := range memberships {
+		if m.Role == member.Role {
+			stillHeld = true
+			break
+		}
+	}
+	if !stillHeld {
+		_, _, err = h.updateUserRoles(c.Request.Context(), userID, func(roles []string) []string {
+			return removeRole(roles, member.Role)
+		})
+		if err != nil {
+			h.userServiceError(c, err)
+			return
+		}
+	}
+	h.audit(c, "staff.remove", nil)
+	h.auditChange(c, map[string]interface{}{"role": member.Role}, nil)
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// addStaffMember grants the global role and records the membership.
+func (h *Handler) addStaffMember(ctx context.Context, restaurantID, userID, role, addedBy string) (domain.StaffMember, error) {
+	_, _, err := h.updateUserRoles(ctx, userID, func(roles []string) []string {
+		return addRole(roles, role)
+	})
+	if err != nil {
+		return domain.StaffMember{}, err
+	}
+	member := domain.StaffMember{
+		RestaurantID: restaurantID,
+		UserID:       userID,
+		Role:         role,
+		AddedBy:      addedBy,
+		CreatedAt:    time.Now(),
+	}
+	return member, h.Repos.Staff.Add(ctx, member)
+}
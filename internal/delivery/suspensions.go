@@ -0,0 +1,418 @@
+package delivery
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	proto_user "github.com/aidostt/protos/gen/go/reservista/user"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"reservista.kz/internal/domain"
+	"reservista.kz/pkg/logger"
+	"time"
+)
+
+// suspension holds the appeal routes. Suspended users can't sign in, so they are
+// authenticated by the token of the suspension notice instead.
+func (h *Handler) suspension(api *gin.RouterGroup) {
+	suspensions := api.Group("/suspensions")
+	{
+		suspensions.GET("/appeal/:token", h.getSuspensionByToken)
+		suspensions.POST("/appeal/:token", h.appealSuspension)
+	}
+}
+
+// SuspensionPolicy sets how often the accounts of ended suspensions are looked for
+// to be activated again.
+type SuspensionPolicy struct {
+	Interval time.Duration
+}
+
+// suspendUser suspends a user until the given time, or for good without one, and
+// deactivates the account in the user service. A new suspension replaces the
+// current one.
+func (h *Handler) suspendUser(c *gin.Context) {
+	var input suspendInput
+	if err := c.BindJSON(&input); err != nil {
+		newResponse(c, http.StatusBadRequest, "invalid input body: "+err.Error())
+		return
+	}
+	actorID := c.GetString(idCtx)
+	if input.UserID == actorID {
+		newResponse(c, http.StatusBadRequest, "can't suspend yourself")
+		return
+	}
+	now := time.Now()
+	if input.Until != nil && !input.Until.After(now) {
+		newResponse(c, http.StatusBadRequest, "until has to be in the future")
+		return
+	}
+	id := primitive.NewObjectID().Hex()
+
+	user, ok := h.suspensionTarget(c, input.UserID)
+	if !ok {
+		return
+	}
+	if hasAnyPermittedRole(user.GetRoles(), []string{domain.AdminRole}) {
+		newResponse(c, http.StatusForbidden, "admins can't be suspended, revoke the admin role first")
+		return
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to generate appeal token: "+err.Error())
+		return
+	}
+	token := hex.EncodeToString(b)
+	tokenHash, err := h.SecretHasher.Hash(token)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to generate appeal token: "+err.Error())
+		return
+	}
+	suspension := domain.Suspension{
+		ID:              id,
+		UserID:          input.UserID,
+		Reason:          input.Reason,
+		SuspendedBy:     actorID,
+		StartedAt:       now,
+		Until:           input.Until,
+		Deactivated:     user.GetActivated(),
+		AppealTokenHash: tokenHash,
+	}
+
+	ctx := c.Request.Context()
+	previous, err := h.Repos.Suspensions.GetByUser(ctx, input.UserID)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		newResponse(c, http.StatusInternalServerError, "failed to get suspension: "+err.Error())
+		return
+	}
+	replaced := err == nil && (previous.Active(now) || previous.Deactivated && previous.RestoredAt == nil)
+	if replaced {
+		// the account may still be deactivated by the previous suspension, the new
+		// one takes over activating it again
+		suspension.Deactivated = suspension.Deactivated || previous.Deactivated && previous.RestoredAt == nil
+		previous.Deactivated = false
+		if previous.Active(now) {
+			previous.LiftedAt = &now
+			previous.LiftedBy = actorID
+		}
+	}
+
+	if user.GetActivated() {
+		if err := h.activateAccount(ctx, input.UserID, false); err != nil {
+			h.userServiceError(c, err)
+			return
+		}
+	}
+	if err := h.Repos.Suspensions.Save(ctx, suspension); err != nil {
+		if user.GetActivated() {
+			if err := h.activateAccount(ctx, input.UserID, true); err != nil {
+				logger.Errorf("failed to activate user %s again after a failed suspension: %v", input.UserID, err)
+			}
+		}
+		newResponse(c, http.StatusInternalServerError, "failed to save suspension: "+err.Error())
+		return
+	}
+	if replaced {
+		if err := h.Repos.Suspensions.Save(ctx, previous); err != nil {
+			logger.Errorf("failed to save replaced suspension %s: %v", previous.ID, err)
+		}
+	}
+	logger.Infof("user %s suspended by %s %s: %s", suspension.UserID, actorID, suspensionEnd(suspension), suspension.Reason)
+	h.audit(c, "user.suspend", map[string]string{"user_id": input.UserID, "suspension_id": id})
+	h.auditChange(c, nil, map[string]interface{}{"reason": suspension.Reason, "until": suspension.Until})
+
+	err = h.sendMail(ctx, user.GetEmail(), "suspended", map[string]interface{}{
+		"End":    suspensionEnd(suspension),
+		"Reason": suspension.Reason,
+		"Link":   h.link("/api/suspensions/appeal/" + token),
+	})
+	if err != nil {
+		newResponse(c, http.StatusCreated, "user is suspended, but failed to send notification: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, suspension)
+}
+
+func (h *Handler) liftSuspension(c *gin.Context) {
+	var input liftSuspensionInput
+	if err := c.BindJSON(&input); err != nil {
+		newResponse(c, http.StatusBadRequest, "invalid input body: "+err.Error())
+		return
+	}
+	suspension, ok := h.activeSuspensionOf(c, input.UserID)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	suspension.LiftedAt = &now
+	suspension.LiftedBy = c.GetString(idCtx)
+	if suspension.Appeal != nil && suspension.Appeal.Status == domain.AppealPending {
+		suspension.Appeal.Status = domain.AppealAccepted
+		suspension.Appeal.ResolvedBy = suspension.LiftedBy
+		suspension.Appeal.ResolvedAt = &now
+	}
+	h.restoreAccount(c.Request.Context(), &suspension)
+	if err := h.Repos.Suspensions.Save(c.Request.Context(), suspension); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to save suspension: "+err.Error())
+		return
+	}
+	h.audit(c, "user.unsuspend", map[string]string{"user_id": input.UserID, "suspension_id": suspension.ID})
+	h.notifySuspended(c, suspension, "suspensionLifted", nil)
+}
+
+func (h *Handler) getPendingAppeals(c *gin.Context) {
+	suspensions, err := h.Repos.Suspensions.GetPendingAppeals(c.Request.Context())
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get appeals: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, suspensions)
+}
+
+// resolveAppeal answers the appeal of a user, accepting it lifts the suspension.
+func (h *Handler) resolveAppeal(c *gin.Context) {
+	var input appealResolutionInput
+	if err := c.BindJSON(&input); err != nil {
+		newResponse(c, http.StatusBadRequest, "invalid input body: "+err.Error())
+		return
+	}
+	suspension, ok := h.activeSuspensionOf(c, input.UserID)
+	if !ok {
+		return
+	}
+	if suspension.Appeal == nil || suspension.Appeal.Status != domain.AppealPending {
+		newResponse(c, http.StatusBadRequest, "there is no pending appeal")
+		return
+	}
+	now := time.Now()
+	suspension.Appeal.Status = domain.AppealRejected
+	suspension.Appeal.Response = input.Response
+	suspension.Appeal.ResolvedBy = c.GetString(idCtx)
+	suspension.Appeal.ResolvedAt = &now
+	if input.Accept {
+		suspension.Appeal.Status = domain.AppealAccepted
+		suspension.LiftedAt = &now
+		suspension.LiftedBy = suspension.Appeal.ResolvedBy
+		h.restoreAccount(c.Request.Context(), &suspension)
+	}
+	if err := h.Repos.Suspensions.Save(c.Request.Context(), suspension); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to save suspension: "+err.Error())
+		return
+	}
+	h.audit(c, "user.appeal.resolve", map[string]string{"user_id": input.UserID, "suspension_id": suspension.ID})
+	h.auditChange(c, nil, map[string]interface{}{"status": suspension.Appeal.Status, "response": input.Response})
+	h.notifySuspended(c, suspension, "appealResolved", map[string]interface{}{
+		"Accepted": input.Accept,
+		"Response": input.Response,
+	})
+}
+
+func (h *Handler) getSuspensionByToken(c *gin.Context) {
+	suspension, ok := h.suspensionByToken(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, suspension)
+}
+
+// appealSuspension lets the suspended user ask for the suspension to be lifted, once.
+func (h *Handler) appealSuspension(c *gin.Context) {
+	var input appealInput
+	if err := c.BindJSON(&input); err != nil {
+		newResponse(c, http.StatusBadRequest, "invalid input body: "+err.Error())
+		return
+	}
+	suspension, ok := h.suspensionByToken(c)
+	if !ok {
+		return
+	}
+	if suspension.Appeal != nil {
+		newResponse(c, http.StatusConflict, "the suspension has already been appealed")
+		return
+	}
+	suspension.Appeal = &domain.Appeal{
+		Message:     input.Message,
+		SubmittedAt: time.Now(),
+		Status:      domain.AppealPending,
+	}
+	if err := h.Repos.Suspensions.Save(c.Request.Context(), suspension); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to save appeal: "+err.Error())
+		return
+	}
+	c.Set(idCtx, suspension.UserID)
+	h.audit(c, "user.appeal", map[string]string{"user_id": suspension.UserID, "suspension_id": suspension.ID})
+	c.JSON(http.StatusCreated, suspension)
+}
+
+func (h *Handler) suspensionByToken(c *gin.Context) (domain.Suspension, bool) {
+	token := c.Param("token")
+	if token == "" {
+		newResponse(c, http.StatusBadRequest, "missing token in the URL")
+		return domain.Suspension{}, false
+	}
+	tokenHash, err := h.SecretHasher.Hash(token)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return domain.Suspension{}, false
+	}
+	suspension, err := h.Repos.Suspensions.GetByAppealTokenHash(c.Request.Context(), tokenHash)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			newResponse(c, http.StatusBadRequest, domain.ErrAppealInvalid.Error())
+			return domain.Suspension{}, false
+		}
+		newResponse(c, http.StatusInternalServerError, "failed to get suspension: "+err.Error())
+		return domain.Suspension{}, false
+	}
+	if !suspension.Active(time.Now()) {
+		newResponse(c, http.StatusBadRequest, domain.ErrAppealInvalid.Error())
+		return domain.Suspension{}, false
+	}
+	return suspension, true
+}
+
+// activeSuspensionOf writes the error response itself when the user isn't suspended.
+func (h *Handler) activeSuspensionOf(c *gin.Context, userID string) (domain.Suspension, bool) {
+	suspension, err := h.activeSuspension(c.Request.Context(), userID)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get suspension: "+err.Error())
+		return domain.Suspension{}, false
+	}
+	if suspension == nil {
+		newResponse(c, http.StatusBadRequest, "user isn't suspended")
+		return domain.Suspension{}, false
+	}
+	return *suspension, true
+}
+
+// activeSuspension returns the suspension blocking the user, or nil.
+func (h *Handler) activeSuspension(ctx context.Context, userID string) (*domain.Suspension, error) {
+	suspension, err := h.Repos.Suspensions.GetByUser(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !suspension.Active(time.Now()) {
+		return nil, nil
+	}
+	return &suspension, nil
+}
+
+// checkSuspension lets suspended users through nowhere. The auth service can't
+// revoke sessions, so their cookies are dropped and every token they still hold is
+// refused here. It writes the error response itself and reports whether the user
+// may go on.
+func (h *Handler) checkSuspension(c *gin.Context, userID string) bool {
+	suspension, err := h.activeSuspension(c.Request.Context(), userID)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to check suspension: "+err.Error())
+		return false
+	}
+	if suspension == nil {
+		return true
+	}
+	h.deleteCookie(c, jwtCookie)
+	h.deleteCookie(c, refreshCookie)
+	newResponse(c, http.StatusForbidden, domain.ErrUserSuspended.Error()+" "+suspensionEnd(*suspension)+": "+suspension.Reason)
+	return false
+}
+
+func (h *Handler) suspensionTarget(c *gin.Context, userID string) (*proto_user.UserResponse, bool) {
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Users)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return nil, false
+	}
+	defer conn.Close()
+	user, err := proto_user.NewUserClient(conn).GetByID(c.Request.Context(), &proto_user.GetRequest{
+		UserId: userID,
+		Email:  domain.Plug,
+	})
+	if err != nil {
+		h.userServiceError(c, err)
+		return nil, false
+	}
+	return user, true
+}
+
+// notifySuspended mails the template name to the suspended user and answers with
+// the suspension.
+func (h *Handler) notifySuspended(c *gin.Context, suspension domain.Suspension, name string, data interface{}) {
+	user, ok := h.suspensionTarget(c, suspension.UserID)
+	if !ok {
+		return
+	}
+	if err := h.sendMail(c.Request.Context(), user.GetEmail(), name, data); err != nil {
+		newResponse(c, http.StatusOK, "suspension is updated, but failed to send notification: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, suspension)
+}
+
+// RunSuspensions activates the accounts of ended suspensions again until ctx is
+// done. Failures are retried on the next tick.
+func (h *Handler) RunSuspensions(ctx context.Context) {
+	ticker := time.NewTicker(h.Suspension.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			ended, err := h.Repos.Suspensions.GetAwaitingRestore(ctx, now)
+			if err != nil {
+				logger.Errorf("failed to get ended suspensions: %v", err)
+				continue
+			}
+			for _, suspension := range ended {
+				if !h.restoreAccount(ctx, &suspension) {
+					continue
+				}
+				if err := h.Repos.Suspensions.Save(ctx, suspension); err != nil {
+					logger.Errorf("failed to save suspension %s: %v", suspension.ID, err)
+				}
+			}
+		}
+	}
+}
+
+// restoreAccount activates the account a suspension deactivated and marks it
+// restored, the caller saves the suspension. Failures are logged and left to
+// RunSuspensions, it reports whether the suspension changed.
+func (h *Handler) restoreAccount(ctx context.Context, suspension *domain.Suspension) bool {
+	if !suspension.Deactivated || suspension.RestoredAt != nil {
+		return false
+	}
+	err := h.activateAccount(ctx, suspension.UserID, true)
+	if err != nil && status.Code(err) != codes.NotFound {
+		logger.Errorf("failed to activate user %s after suspension %s: %v", suspension.UserID, suspension.ID, err)
+		return false
+	}
+	// an account deleted in the meantime has nothing left to activate
+	now := time.Now()
+	suspension.RestoredAt = &now
+	return true
+}
+
+func (h *Handler) activateAccount(ctx context.Context, userID string, activate bool) error {
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Users)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return h.setActivated(ctx, proto_user.NewUserClient(conn), userID, activate)
+}
+
+func suspensionEnd(suspension domain.Suspension) string {
+	if suspension.Until == nil {
+		return "permanently"
+	}
+	return "until " + suspension.Until.Format(time.RFC3339)
+}
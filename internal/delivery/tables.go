@@ -18,8 +18,8 @@ func (h *Handler) table(api *gin.RouterGroup) {
 		tables.GET("/view/:id", h.getTable)
 		tables.GET("/all/restaurant/:id", h.getTablesByRestId)
 
-		//admin, restaurant authorities
-		authenticated := tables.Group("/", h.userIdentity, h.isActivated(), h.isPermitted([]string{domain.AdminRole, domain.WaiterRole, domain.RestaurantAdminRole}))
+		//admin, restaurant authorities, partner integrations
+		authenticated := tables.Group("/", h.userOrAPIKeyIdentity, h.authorize, h.idempotency)
 		{
 			authenticated.POST("/add", h.addTable)
 			authenticated.DELETE("/delete/:id", h.deleteTableById)
@@ -105,6 +105,9 @@ func (h *Handler) addTable(c *gin.Context) {
 		c.Abort()
 		return
 	}
+	if !h.authorizeRestaurant(c, input.RestaurantID, domain.RestaurantAdminRole, domain.WaiterRole) {
+		return
+	}
 
 	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
 	defer conn.Close()
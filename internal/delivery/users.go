@@ -1,22 +1,35 @@
 package delivery
 
 import (
+	"context"
 	proto_user "github.com/aidostt/protos/gen/go/reservista/user"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"net/http"
 	"reservista.kz/internal/domain"
+	"strings"
+	"time"
 )
 
 func (h *Handler) user(api *gin.RouterGroup) {
-	users := api.Group("/users", h.userIdentity)
+	users := api.Group("/users", h.userIdentity, h.authorize, h.idempotency)
 	{
+		users.GET("/me", h.getMe)
 		users.DELETE("/delete", h.deleteUser)
 		users.PATCH("/update", h.updateUser)
 
 		users.GET("/view/id/:id", h.getByID)
 		users.GET("/view/email/:email", h.getByEmail)
+
+		users.GET("/me/export", h.exportUserData)
+		users.GET("/me/erasure", h.getErasure)
+		users.POST("/me/erasure", h.requestErasure)
+		users.POST("/me/erasure/confirm", h.confirmErasure)
+		users.DELETE("/me/erasure", h.cancelErasure)
+		users.POST("/me/avatar", h.uploadAvatar)
+		users.DELETE("/me/avatar", h.deleteAvatar)
 	}
 }
 
@@ -38,14 +51,13 @@ func (h *Handler) updateUser(c *gin.Context) {
 		newResponse(c, http.StatusBadRequest, "unauthorized access")
 		return
 	}
-	roles, ok := c.Get(roleCtx)
-	if !ok {
-		newResponse(c, http.StatusBadRequest, "unauthorized access")
-		return
-	}
-	activated, ok := c.Get(activatedCtx)
-	if !ok {
-		newResponse(c, http.StatusBadRequest, "unauthorized access")
+	// roles and activation are managed elsewhere, the ones in the token may be stale
+	current, err := client.GetByID(c.Request.Context(), &proto_user.GetRequest{
+		UserId: userID.(string),
+		Email:  domain.Plug,
+	})
+	if err != nil {
+		h.userServiceError(c, err)
 		return
 	}
 
@@ -56,8 +68,8 @@ func (h *Handler) updateUser(c *gin.Context) {
 		Phone:     inp.Phone,
 		Email:     inp.Email,
 		Password:  inp.Password,
-		Roles:     roles.([]string),
-		Activated: activated.(bool),
+		Roles:     current.GetRoles(),
+		Activated: current.GetActivated(),
 	})
 	if err != nil {
 		st, ok := status.FromError(err)
@@ -80,6 +92,7 @@ func (h *Handler) updateUser(c *gin.Context) {
 		newResponse(c, http.StatusInternalServerError, "unknown error when calling sign up:"+err.Error())
 		return
 	}
+	h.recordUser(c.Request.Context(), userID.(string))
 	c.Status(http.StatusOK)
 }
 
@@ -126,6 +139,22 @@ func (h *Handler) deleteUser(c *gin.Context) {
 		newResponse(c, http.StatusInternalServerError, "unknown error when calling sign up:"+err.Error())
 		return
 	}
+	// the user is gone, what is left behind elsewhere goes too
+	if err := h.cancelFutureReservations(c.Request.Context(), userID.(string)); err != nil {
+		newResponse(c, http.StatusInternalServerError, "user is deleted, but failed to cancel reservations: "+err.Error())
+		return
+	}
+	erasure := domain.ErasureRequest{
+		ID:          primitive.NewObjectID().Hex(),
+		UserID:      userID.(string),
+		RequestedAt: time.Now(),
+	}
+	if err := h.releaseUser(c.Request.Context(), erasure); err != nil {
+		newResponse(c, http.StatusInternalServerError, "user is deleted, but failed to clean up: "+err.Error())
+		return
+	}
+	// the entry of this request is written after the trail was anonymized
+	c.Set(erasureCtx, erasure)
 	c.Status(http.StatusOK)
 }
 
@@ -164,20 +193,36 @@ func (h *Handler) getByID(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, userSignUpInput{
-		Name:    user.GetName(),
-		Surname: user.GetSurname(),
-		Phone:   user.GetPhone(),
-		Email:   user.GetEmail(),
-	})
+	h.recordProfile(c.Request.Context(), id, user)
+	self := id == c.GetString(idCtx)
+	resp, err := h.newUserResponse(c.Request.Context(), id, user, self, h.isAdmin(c))
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get user details: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
+// getByEmail is for admins, other users may only look up their own email, which
+// is answered by getMe.
 func (h *Handler) getByEmail(c *gin.Context) {
 	email := c.Param("email")
 	if email == "" {
 		newResponse(c, http.StatusBadRequest, "missing ID in the URL")
 		return
 	}
+	if !h.isAdmin(c) {
+		me, ok := h.ownProfile(c)
+		if !ok {
+			return
+		}
+		if !strings.EqualFold(me.Email, email) {
+			newResponse(c, http.StatusForbidden, "access denied: only your own record is available")
+			return
+		}
+		c.JSON(http.StatusOK, me)
+		return
+	}
 	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Users)
 	defer conn.Close()
 	if err != nil {
@@ -207,10 +252,89 @@ func (h *Handler) getByEmail(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, userSignUpInput{
+	resp, err := h.newUserResponse(c.Request.Context(), "", user, false, true)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get user details: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) getMe(c *gin.Context) {
+	me, ok := h.ownProfile(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, me)
+}
+
+// ownProfile fetches the signed in user. It writes the error response itself and
+// reports whether the profile was found.
+func (h *Handler) ownProfile(c *gin.Context) (userResponse, bool) {
+	id := c.GetString(idCtx)
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Users)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return userResponse{}, false
+	}
+	defer conn.Close()
+	user, err := proto_user.NewUserClient(conn).GetByID(c.Request.Context(), &proto_user.GetRequest{
+		UserId: id,
+		Email:  domain.Plug,
+	})
+	if err != nil {
+		h.userServiceError(c, err)
+		return userResponse{}, false
+	}
+	h.recordProfile(c.Request.Context(), id, user)
+	me, err := h.newUserResponse(c.Request.Context(), id, user, true, h.isAdmin(c))
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get user details: "+err.Error())
+		return userResponse{}, false
+	}
+	return me, true
+}
+
+// newUserResponse shows contact and account details only to the user themselves
+// and to admins, anyone else gets the name. id may be empty when it isn't known.
+func (h *Handler) newUserResponse(ctx context.Context, id string, user *proto_user.UserResponse, self, admin bool) (userResponse, error) {
+	resp := userResponse{
 		Name:    user.GetName(),
 		Surname: user.GetSurname(),
-		Phone:   user.GetPhone(),
-		Email:   user.GetEmail(),
-	})
+	}
+	if id != "" {
+		avatar, err := h.avatarURLs(ctx, id)
+		if err != nil {
+			return resp, err
+		}
+		resp.Avatar = avatar
+	}
+	if !self && !admin {
+		return resp, nil
+	}
+	activated := user.GetActivated()
+	resp.ID = id
+	resp.Phone = user.GetPhone()
+	resp.Email = user.GetEmail()
+	resp.Roles = user.GetRoles()
+	resp.Activated = &activated
+	if id == "" {
+		return resp, nil
+	}
+
+	identities, err := h.Repos.Identities.GetByUser(ctx, id)
+	if err != nil {
+		return resp, err
+	}
+	for _, identity := range identities {
+		resp.Identities = append(resp.Identities, identity.Provider)
+	}
+	if resp.Staff, err = h.Repos.Staff.GetByUser(ctx, id); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+func (h *Handler) isAdmin(c *gin.Context) bool {
+	return hasAnyPermittedRole(c.GetStringSlice(roleCtx), []string{domain.AdminRole})
 }
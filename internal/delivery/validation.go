@@ -0,0 +1,64 @@
+package delivery
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+func init() {
+	// name fields in validation errors the way clients send them
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// fieldErrors turns the errors of the binding tags into messages per field. It
+// returns nil for errors that aren't about a field, e.g. malformed JSON.
+func fieldErrors(err error) map[string]string {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return nil
+	}
+	fields := make(map[string]string, len(validationErrors))
+	for _, fe := range validationErrors {
+		fields[fe.Field()] = fieldMessage(fe)
+	}
+	return fields
+}
+
+// bindingError answers an input that failed to bind, per field when possible.
+func (h *Handler) bindingError(c *gin.Context, err error) {
+	if fields := fieldErrors(err); fields != nil {
+		newValidationResponse(c, fields)
+		return
+	}
+	newResponse(c, http.StatusBadRequest, "invalid input body: "+err.Error())
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		return "must be at least " + fe.Param()
+	case "max":
+		return "must be at most " + fe.Param()
+	case "oneof":
+		return "must be one of " + fe.Param()
+	case "email":
+		return "must be an email address"
+	default:
+		return "failed the " + fe.Tag() + " check"
+	}
+}
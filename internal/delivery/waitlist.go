@@ -0,0 +1,460 @@
+package delivery
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	proto_reservation "github.com/aidostt/protos/gen/go/reservista/reservation"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"reservista.kz/internal/domain"
+	"reservista.kz/pkg/logger"
+	"strconv"
+	"time"
+)
+
+// WaitlistPolicy is how long an offered table is held for a waiting guest, and how
+// often expired offers are passed on.
+type WaitlistPolicy struct {
+	OfferTTL time.Duration
+	Interval time.Duration
+}
+
+func (h *Handler) waitlist(api *gin.RouterGroup) {
+	waitlist := api.Group("/waitlist")
+	{
+		// the offer mail links here, the token stands in for the session. The GET
+		// only shows the offer, so previews of the link don't book the table
+		waitlist.GET("/claim/:token", h.getWaitlistOffer)
+		waitlist.POST("/claim/:token", h.claimWaitlistOffer)
+
+		activated := waitlist.Group("/", h.userIdentity, h.authorize, h.idempotency)
+		{
+			activated.POST("/join/:id", h.joinWaitlist)
+			activated.GET("/view/:id", h.getWaitlistEntry)
+			activated.GET("/all/user", h.getUserWaitlist)
+			activated.DELETE("/leave/:id", h.leaveWaitlist)
+		}
+	}
+}
+
+func (h *Handler) joinWaitlist(c *gin.Context) {
+	var input waitlistInput
+	if err := c.BindJSON(&input); err != nil {
+		h.bindingError(c, err)
+		return
+	}
+	restaurantID, userID := c.Param("id"), c.GetString(idCtx)
+	fields := make(map[string]string)
+	from, err := time.Parse(time.RFC3339, input.From)
+	if err != nil {
+		fields["from"] = "must be an RFC 3339 time, e.g. 2024-05-01T18:00:00+05:00"
+	}
+	to, err := time.Parse(time.RFC3339, input.To)
+	if err != nil {
+		fields["to"] = "must be an RFC 3339 time, e.g. 2024-05-01T22:00:00+05:00"
+	}
+	now := time.Now()
+	switch {
+	case len(fields) > 0:
+	case !to.After(from):
+		fields["to"] = "must be after from"
+	case !to.After(now):
+		fields["to"] = "must be in the future"
+	case h.Reservation.MaxAdvance > 0 && from.After(now.Add(h.Reservation.MaxAdvance)):
+		fields["from"] = "must be within " + strconv.Itoa(int(h.Reservation.MaxAdvance.Hours()/24)) + " days from now"
+	}
+	if len(fields) > 0 {
+		newValidationResponse(c, fields)
+		return
+	}
+	if !h.checkPenalties(c, restaurantID, userID) {
+		return
+	}
+	loc, err := h.restaurantLocation(c.Request.Context(), restaurantID)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get restaurant timezone: "+err.Error())
+		return
+	}
+
+	entries, err := h.Repos.Waitlist.GetByUser(c.Request.Context(), userID)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get waitlist: "+err.Error())
+		return
+	}
+	for _, entry := range entries {
+		if entry.RestaurantID == restaurantID && (entry.Status == domain.WaitlistWaiting || entry.Status == domain.WaitlistOffered) {
+			newResponse(c, http.StatusConflict, "already on the waitlist of this restaurant")
+			return
+		}
+	}
+	entry := domain.WaitlistEntry{
+		ID:           primitive.NewObjectID().Hex(),
+		UserID:       userID,
+		RestaurantID: restaurantID,
+		PartySize:    input.PartySize,
+		From:         from.In(loc),
+		To:           to.In(loc),
+		Status:       domain.WaitlistWaiting,
+		CreatedAt:    now,
+	}
+	if err := h.Repos.Waitlist.Save(c.Request.Context(), entry); err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to join waitlist: "+err.Error())
+		return
+	}
+	h.audit(c, "waitlist.join", map[string]string{"entryID": entry.ID})
+	c.JSON(http.StatusCreated, h.waitlistResponse(c.Request.Context(), entry))
+}
+
+func (h *Handler) getWaitlistEntry(c *gin.Context) {
+	entry, ok := h.ownWaitlistEntry(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, h.waitlistResponse(c.Request.Context(), entry))
+}
+
+func (h *Handler) getUserWaitlist(c *gin.Context) {
+	entries, err := h.Repos.Waitlist.GetByUser(c.Request.Context(), c.GetString(idCtx))
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get waitlist: "+err.Error())
+		return
+	}
+	responses := make([]waitlistResponse, 0, len(entries))
+	for _, entry := range entries {
+		responses = append(responses, h.waitlistResponse(c.Request.Context(), entry))
+	}
+	c.JSON(http.StatusOK, responses)
+}
+
+// leaveWaitlist takes the guest off the waitlist. A table offered to them goes to
+// the next guest.
+func (h *Handler) leaveWaitlist(c *gin.Context) {
+	entry, ok := h.ownWaitlistEntry(c)
+	if !ok {
+		return
+	}
+	if entry.Status != domain.WaitlistWaiting && entry.Status != domain.WaitlistOffered {
+		newResponse(c, http.StatusConflict, "can't leave the waitlist, the entry is "+entry.Status)
+		return
+	}
+	from := entry.Status
+	entry.Status = domain.WaitlistLeft
+	saved, err := h.Repos.Waitlist.CompareAndSave(c.Request.Context(), entry, from)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to leave waitlist: "+err.Error())
+		return
+	}
+	if !saved {
+		newResponse(c, http.StatusConflict, "can't leave the waitlist, the entry has just changed")
+		return
+	}
+	h.audit(c, "waitlist.leave", map[string]string{"entryID": entry.ID})
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+	if from == domain.WaitlistOffered {
+		h.offerTables(c.Request.Context(), entry.RestaurantID, entry.Offer.Start)
+	}
+}
+
+func (h *Handler) getWaitlistOffer(c *gin.Context) {
+	entry, ok := h.waitlistOfferByToken(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// claimWaitlistOffer books the offered table for the guest. The entry is claimed
+// before the table is booked, so an offer is booked once even when the link is
+// followed twice or the offer expires meanwhile.
+func (h *Handler) claimWaitlistOffer(c *gin.Context) {
+	entry, ok := h.waitlistOfferByToken(c)
+	if !ok {
+		return
+	}
+	c.Set(idCtx, entry.UserID)
+	h.audit(c, "waitlist.claim", map[string]string{"entryID": entry.ID})
+
+	table, err := h.fetchTable(c.Request.Context(), entry.Offer.TableID)
+	if err != nil {
+		h.reservationServiceError(c, err)
+		return
+	}
+	if !h.seatParty(c, table, entry.Offer.Start, entry.PartySize, offerBooking(entry.ID)) {
+		return
+	}
+	offered := entry
+	entry.Status = domain.WaitlistClaimed
+	claimed, err := h.Repos.Waitlist.CompareAndSave(c.Request.Context(), entry, domain.WaitlistOffered)
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to claim offer: "+err.Error())
+		return
+	}
+	if !claimed {
+		newResponse(c, http.StatusConflict, "the offer is already claimed or has expired")
+		return
+	}
+	// a failed booking hands the offer back while it still holds
+	release := func() {
+		if _, err := h.Repos.Waitlist.CompareAndSave(c.Request.Context(), offered, domain.WaitlistClaimed); err != nil {
+			logger.Errorf("failed to release waitlist offer %s: %v", entry.ID, err)
+		}
+	}
+
+	conn, err := h.Dialog.NewConnection(h.Dialog.Addresses.Reservations)
+	if err != nil {
+		release()
+		newResponse(c, http.StatusInternalServerError, "something went wrong...")
+		return
+	}
+	defer conn.Close()
+	resp, err := proto_reservation.NewReservationClient(conn).MakeReservation(c.Request.Context(), &proto_reservation.ReservationSQLRequest{
+		UserID:          entry.UserID,
+		TableID:         entry.Offer.TableID,
+		ReservationTime: entry.Offer.Start.Format(time.RFC3339),
+	})
+	if err != nil {
+		release()
+		h.reservationServiceError(c, err)
+		return
+	}
+	err = h.Repos.Reservations.Save(c.Request.Context(), domain.ReservationDetails{
+		ReservationID: resp.GetId(),
+		UserID:        entry.UserID,
+		RestaurantID:  entry.RestaurantID,
+		TableID:       entry.Offer.TableID,
+		PartySize:     entry.PartySize,
+		Status:        domain.ReservationPending,
+		CreatedAt:     time.Now(),
+	})
+	if err != nil {
+		logger.Errorf("failed to save details of reservation %s: %v", resp.GetId(), err)
+	}
+	entry.ReservationID = resp.GetId()
+	if err := h.Repos.Waitlist.Save(c.Request.Context(), entry); err != nil {
+		logger.Errorf("failed to save claimed waitlist entry %s: %v", entry.ID, err)
+	}
+	h.scheduleReminders(c.Request.Context(), resp.GetId(), entry.UserID, entry.Offer.Start)
+	if !h.sendQR(c, entry.UserID, resp.GetId()) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "reservation_id": resp.GetId()})
+}
+
+// waitlistOfferByToken returns the entry whose offer the token of the URL claims,
+// while the offer holds. It writes the error response itself otherwise.
+func (h *Handler) waitlistOfferByToken(c *gin.Context) (domain.WaitlistEntry, bool) {
+	tokenHash, err := h.SecretHasher.Hash(c.Param("token"))
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to hash token: "+err.Error())
+		return domain.WaitlistEntry{}, false
+	}
+	entry, err := h.Repos.Waitlist.GetByOfferTokenHash(c.Request.Context(), tokenHash)
+	if errors.Is(err, domain.ErrNotFound) {
+		newResponse(c, http.StatusNotFound, "offer not found")
+		return domain.WaitlistEntry{}, false
+	}
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get offer: "+err.Error())
+		return domain.WaitlistEntry{}, false
+	}
+	if entry.Status == domain.WaitlistClaimed {
+		newResponse(c, http.StatusConflict, "the offer is already claimed")
+		return domain.WaitlistEntry{}, false
+	}
+	if !entry.Holds(time.Now()) {
+		newResponse(c, http.StatusGone, "the offer has expired")
+		return domain.WaitlistEntry{}, false
+	}
+	return entry, true
+}
+
+// RunWaitlist passes expired offers on to the next guest and drops entries whose
+// window has passed, until ctx is done.
+func (h *Handler) RunWaitlist(ctx context.Context) {
+	ticker := time.NewTicker(h.Waitlist.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			h.expireWaitlist(ctx, now)
+		}
+	}
+}
+
+func (h *Handler) expireWaitlist(ctx context.Context, now time.Time) {
+	offered, err := h.Repos.Waitlist.GetByStatus(ctx, domain.WaitlistOffered)
+	if err != nil {
+		logger.Errorf("failed to get waitlist offers: %v", err)
+		return
+	}
+	for _, entry := range offered {
+		if entry.Holds(now) {
+			continue
+		}
+		entry.Status = domain.WaitlistExpired
+		expired, err := h.Repos.Waitlist.CompareAndSave(ctx, entry, domain.WaitlistOffered)
+		if err != nil {
+			logger.Errorf("failed to expire waitlist offer %s: %v", entry.ID, err)
+			continue
+		}
+		if !expired {
+			// claimed or left in the meantime
+			continue
+		}
+		h.offerTables(ctx, entry.RestaurantID, entry.Offer.Start)
+	}
+
+	waiting, err := h.Repos.Waitlist.GetByStatus(ctx, domain.WaitlistWaiting)
+	if err != nil {
+		logger.Errorf("failed to get waitlist: %v", err)
+		return
+	}
+	for _, entry := range waiting {
+		if entry.To.After(now) {
+			continue
+		}
+		entry.Status = domain.WaitlistExpired
+		if _, err := h.Repos.Waitlist.CompareAndSave(ctx, entry, domain.WaitlistWaiting); err != nil {
+			logger.Errorf("failed to expire waitlist entry %s: %v", entry.ID, err)
+		}
+	}
+}
+
+// offerTables offers the tables free at start to the guests waiting for them, in
+// the order they joined the waitlist. Failures are only logged, it runs after the
+// cancellation that freed the table has been answered.
+func (h *Handler) offerTables(ctx context.Context, restaurantID string, start time.Time) {
+	now := time.Now()
+	if !start.After(now) {
+		return
+	}
+	entries, err := h.Repos.Waitlist.GetByRestaurant(ctx, restaurantID)
+	if err != nil {
+		logger.Errorf("failed to get waitlist of restaurant %s: %v", restaurantID, err)
+		return
+	}
+	settings, err := h.restaurantSettings(ctx, restaurantID)
+	if err != nil {
+		logger.Errorf("failed to get settings of restaurant %s: %v", restaurantID, err)
+		return
+	}
+	tables, booked, err := h.restaurantBookings(ctx, restaurantID)
+	if err != nil {
+		logger.Errorf("failed to get bookings of restaurant %s: %v", restaurantID, err)
+		return
+	}
+	for _, entry := range entries {
+		if !entry.Wants(start) {
+			continue
+		}
+		free := h.freeTables(tables, booked, start, entry.PartySize, settings.MinOccupancy, "")
+		if len(free) == 0 {
+			continue
+		}
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			logger.Errorf("failed to generate offer token: %v", err)
+			return
+		}
+		token := hex.EncodeToString(b)
+		tokenHash, err := h.SecretHasher.Hash(token)
+		if err != nil {
+			logger.Errorf("failed to generate offer token: %v", err)
+			return
+		}
+		entry.Status = domain.WaitlistOffered
+		entry.Offer = &domain.WaitlistOffer{
+			TableID:   free[0].ID,
+			Start:     start,
+			TokenHash: tokenHash,
+			ExpiresAt: now.Add(h.Waitlist.OfferTTL),
+		}
+		offered, err := h.Repos.Waitlist.CompareAndSave(ctx, entry, domain.WaitlistWaiting)
+		if err != nil {
+			logger.Errorf("failed to save waitlist offer %s: %v", entry.ID, err)
+			continue
+		}
+		if !offered {
+			// the guest left in the meantime
+			continue
+		}
+		booked[free[0].ID] = append(booked[free[0].ID], booking{ReservationID: offerBooking(entry.ID), Start: start})
+
+		if err := h.mailWaitlistOffer(ctx, entry, token); err != nil {
+			logger.Errorf("failed to send waitlist offer %s: %v", entry.ID, err)
+		}
+	}
+}
+
+func (h *Handler) mailWaitlistOffer(ctx context.Context, entry domain.WaitlistEntry, token string) error {
+	email, err := h.guestEmail(ctx, entry.UserID)
+	if err != nil {
+		return err
+	}
+	return h.sendMail(ctx, email, "waitlistOffer", map[string]interface{}{
+		"PartySize": entry.PartySize,
+		"Start":     entry.Offer.Start,
+		"ExpiresAt": entry.Offer.ExpiresAt.In(entry.Offer.Start.Location()),
+		"Link":      h.link("/api/waitlist/claim/" + token),
+	})
+}
+
+// heldOffers adds the tables held by waitlist offers to the bookings of a restaurant.
+func (h *Handler) heldOffers(ctx context.Context, restaurantID string, booked bookings) error {
+	entries, err := h.Repos.Waitlist.GetByRestaurant(ctx, restaurantID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, entry := range entries {
+		if entry.Holds(now) {
+			booked[entry.Offer.TableID] = append(booked[entry.Offer.TableID], booking{ReservationID: offerBooking(entry.ID), Start: entry.Offer.Start})
+		}
+	}
+	return nil
+}
+
+// offerBooking is the booking of the table held by a waitlist offer.
+func offerBooking(entryID string) string {
+	return "offer:" + entryID
+}
+
+func (h *Handler) ownWaitlistEntry(c *gin.Context) (domain.WaitlistEntry, bool) {
+	entry, err := h.Repos.Waitlist.Get(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, domain.ErrNotFound) || (err == nil && entry.UserID != c.GetString(idCtx)) {
+		newResponse(c, http.StatusNotFound, "waitlist entry not found")
+		return domain.WaitlistEntry{}, false
+	}
+	if err != nil {
+		newResponse(c, http.StatusInternalServerError, "failed to get waitlist entry: "+err.Error())
+		return domain.WaitlistEntry{}, false
+	}
+	return entry, true
+}
+
+// waitlistResponse adds the position of a waiting guest.
+func (h *Handler) waitlistResponse(ctx context.Context, entry domain.WaitlistEntry) waitlistResponse {
+	resp := waitlistResponse{WaitlistEntry: entry}
+	if entry.Status != domain.WaitlistWaiting {
+		return resp
+	}
+	entries, err := h.Repos.Waitlist.GetByRestaurant(ctx, entry.RestaurantID)
+	if err != nil {
+		logger.Errorf("failed to get waitlist of restaurant %s: %v", entry.RestaurantID, err)
+		return resp
+	}
+	for _, other := range entries {
+		if other.Status == domain.WaitlistWaiting {
+			resp.Position++
+		}
+		if other.ID == entry.ID {
+			break
+		}
+	}
+	return resp
+}
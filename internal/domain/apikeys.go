@@ -0,0 +1,36 @@
+package domain
+
+import "time"
+
+// APIKey gives a partner system (POS, kiosk) machine access to a single restaurant.
+// Only the hash of the secret is stored, the key itself is shown once on creation.
+type APIKey struct {
+	ID           string     `json:"id"`
+	RestaurantID string     `json:"restaurantID"`
+	Name         string     `json:"name"`
+	Hash         string     `json:"-"`
+	Scopes       []string   `json:"scopes"`
+	CreatedBy    string     `json:"createdBy"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	RotatedAt    *time.Time `json:"rotatedAt,omitempty"`
+	LastUsedAt   *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt    *time.Time `json:"revokedAt,omitempty"`
+}
+
+const (
+	ScopeTablesRead        = "tables:read"
+	ScopeTablesWrite       = "tables:write"
+	ScopeReservationsRead  = "reservations:read"
+	ScopeReservationsWrite = "reservations:write"
+)
+
+var APIKeyScopes = []string{ScopeTablesRead, ScopeTablesWrite, ScopeReservationsRead, ScopeReservationsWrite}
+
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package domain
+
+import "time"
+
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeDenied  = "denied"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditEntry records a privileged or mutating request.
+type AuditEntry struct {
+	ID        string    `json:"id"`
+	RequestID string    `json:"requestID"`
+	Time      time.Time `json:"time"`
+	ActorID   string    `json:"actorID"`
+	// ImpersonatorID is the admin behind ActorID during an impersonation.
+	ImpersonatorID string                 `json:"impersonatorID,omitempty"`
+	Roles          []string               `json:"roles"`
+	IP             string                 `json:"ip"`
+	Method         string                 `json:"method"`
+	Route          string                 `json:"route"`
+	Action         string                 `json:"action,omitempty"`
+	Targets        map[string]string      `json:"targets,omitempty"`
+	Before         map[string]interface{} `json:"before,omitempty"`
+	After          map[string]interface{} `json:"after,omitempty"`
+	Status         int                    `json:"status"`
+	Outcome        string                 `json:"outcome"`
+	Reason         string                 `json:"reason,omitempty"`
+	// PolicyDryRunDenials are what dry-run policy rules would have denied.
+	PolicyDryRunDenials []string `json:"policyDryRunDenials,omitempty"`
+}
+
+// Anonymize replaces the id of an erased user with alias and drops the IP of the
+// requests they made. It reports whether the entry mentioned the user.
+func (e *AuditEntry) Anonymize(userID, alias string) bool {
+	changed := false
+	if e.ActorID == userID {
+		e.ActorID, e.IP = alias, ""
+		changed = true
+	}
+	if e.ImpersonatorID == userID {
+		e.ImpersonatorID = alias
+		changed = true
+	}
+	for key, id := range e.Targets {
+		if id == userID {
+			e.Targets[key] = alias
+			changed = true
+		}
+	}
+	return changed
+}
+
+// AuditFilter narrows down audit entries, zero values match everything.
+type AuditFilter struct {
+	ActorID  string
+	Action   string
+	Route    string
+	TargetID string
+	Outcome  string
+	From     time.Time
+	To       time.Time
+	Limit    int
+	Offset   int
+}
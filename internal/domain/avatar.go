@@ -0,0 +1,17 @@
+package domain
+
+import "time"
+
+const (
+	AvatarDetail = "detail"
+	AvatarList   = "list"
+)
+
+// Avatar is the profile picture of a user in every size variant. The user service
+// has no field for it, so the gateway keeps it.
+type Avatar struct {
+	UserID    string            `json:"-"`
+	URLs      map[string]string `json:"urls"`
+	Keys      []string          `json:"-"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+}
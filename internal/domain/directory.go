@@ -0,0 +1,46 @@
+package domain
+
+import "time"
+
+const (
+	DirectorySortCreated = "created"
+	DirectorySortName    = "name"
+	DirectorySortEmail   = "email"
+)
+
+// DirectoryUser is a user profile listed in the admin user directory. The user
+// service can't list or search users, so the gateway keeps the profiles of the
+// users it sees signing up, signing in or being changed, as it last saw them.
+// CreatedAt is taken from the id, which is a MongoDB ObjectID.
+type DirectoryUser struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Surname   string    `json:"surname"`
+	Phone     string    `json:"phone"`
+	Email     string    `json:"email"`
+	Roles     []string  `json:"roles"`
+	Activated bool      `json:"activated"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// DirectoryFilter narrows down and orders the directory, zero values match
+// everything. After is the cursor of the last user of the previous page and takes
+// precedence over Offset.
+type DirectoryFilter struct {
+	Query       string
+	Role        string
+	Activated   *bool
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Sort        string
+	Desc        bool
+	After       *DirectoryCursor
+	Limit       int
+	Offset      int
+}
+
+// DirectoryCursor points at a user in the sort order of a DirectoryFilter.
+type DirectoryCursor struct {
+	Key string `json:"k"`
+	ID  string `json:"id"`
+}
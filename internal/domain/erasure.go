@@ -0,0 +1,41 @@
+package domain
+
+import "time"
+
+const (
+	// ErasurePending waits for the confirmation code sent by email.
+	ErasurePending = "pending"
+	// ErasureScheduled is confirmed and runs once the grace period is over.
+	ErasureScheduled = "scheduled"
+	ErasureCancelled = "cancelled"
+	ErasureCompleted = "completed"
+)
+
+// ErasureRequest tracks the deletion of a user's personal data. A completed
+// erasure also revokes every session of the user.
+type ErasureRequest struct {
+	ID           string     `json:"id"`
+	UserID       string     `json:"userID"`
+	CodeHash     string     `json:"-"`
+	Status       string     `json:"status"`
+	RequestedAt  time.Time  `json:"requestedAt"`
+	ConfirmBy    time.Time  `json:"confirmBy"`
+	ScheduledFor *time.Time `json:"scheduledFor,omitempty"`
+	CompletedAt  *time.Time `json:"completedAt,omitempty"`
+}
+
+// Alias stands in for the user id in the audit trail once the user is erased.
+func (e ErasureRequest) Alias() string {
+	return "erased-" + e.ID
+}
+
+// Open reports whether the request still waits for confirmation or execution.
+func (e ErasureRequest) Open() bool {
+	switch e.Status {
+	case ErasurePending:
+		return time.Now().Before(e.ConfirmBy)
+	case ErasureScheduled:
+		return true
+	}
+	return false
+}
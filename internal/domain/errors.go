@@ -8,4 +8,19 @@ var (
 	ErrTokenExpired         = errors.New("token is expired")
 	ErrUnauthorized         = errors.New("unauthorized access")
 	ErrTokenInvalidElements = errors.New("token has xxx elements")
+	ErrNotFound             = errors.New("not found")
+	ErrAlreadyExists        = errors.New("already exists")
+	ErrOIDCStateInvalid     = errors.New("oidc state is invalid or expired")
+	ErrEmailNotVerified     = errors.New("email is not verified by the provider")
+	ErrIdentityLinked       = errors.New("identity is already linked to another user")
+	ErrAccountNeedsLink     = errors.New("account with this email already exists, sign in and link the provider")
+	ErrProviderNotFound     = errors.New("oidc provider is not configured")
+	ErrAPIKeyInvalid        = errors.New("api key is invalid or revoked")
+	ErrAPIKeyScope          = errors.New("api key is missing required scope")
+	ErrNotRestaurantStaff   = errors.New("access denied: not a staff member of this restaurant")
+	ErrInviteInvalid        = errors.New("invite is invalid, expired or already accepted")
+	ErrImpersonationEnded   = errors.New("impersonation has ended")
+	ErrImpersonationDenied  = errors.New("route is not allowed while impersonating")
+	ErrUserSuspended        = errors.New("account is suspended")
+	ErrAppealInvalid        = errors.New("appeal link is invalid or the suspension is over")
 )
@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// IdempotentRequest is the first request made with an Idempotency-Key and, once
+// it is Completed, the response that is replayed to its retries.
+type IdempotentRequest struct {
+	// Fingerprint tells a retry apart from another request reusing the key
+	Fingerprint string    `json:"fingerprint"`
+	Completed   bool      `json:"completed"`
+	Status      int       `json:"status,omitempty"`
+	ContentType string    `json:"contentType,omitempty"`
+	Body        []byte    `json:"body,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
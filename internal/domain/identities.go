@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// Identity links an account of an external OpenID Connect provider to a user.
+type Identity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	UserID    string    `json:"userID"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// OIDCState is kept between the redirect to a provider and its callback.
+// LinkUserID is set when an already signed in user links a new provider.
+type OIDCState struct {
+	State        string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	LinkUserID   string
+	ExpiresAt    time.Time
+}
@@ -0,0 +1,19 @@
+package domain
+
+import "time"
+
+// Impersonation is a time-limited session in which an admin acts as a user to
+// see what the user sees.
+type Impersonation struct {
+	ID        string     `json:"id"`
+	ActorID   string     `json:"actorID"`
+	UserID    string     `json:"userID"`
+	Reason    string     `json:"reason"`
+	StartedAt time.Time  `json:"startedAt"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+}
+
+func (i Impersonation) Active() bool {
+	return i.EndedAt == nil && time.Now().Before(i.ExpiresAt)
+}
@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+const (
+	PenaltyLateCancel = "late_cancel"
+	PenaltyNoShow     = "no_show"
+)
+
+// GuestPenalty flags a guest who cancelled late or didn't show up at a restaurant.
+type GuestPenalty struct {
+	ID            string    `json:"id"`
+	UserID        string    `json:"userID"`
+	RestaurantID  string    `json:"restaurantID"`
+	ReservationID string    `json:"reservationID"`
+	Kind          string    `json:"kind"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
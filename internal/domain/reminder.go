@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+const (
+	ReminderPending = "pending"
+	ReminderSent    = "sent"
+	ReminderDropped = "dropped"
+	ReminderFailed  = "failed"
+)
+
+// ReminderJob is the reminder of a reservation due at SendAt. A claimed job is
+// leased until LeaseUntil, a job whose lease runs out before it is finished is
+// sent again. TokenHashes are the hashes of the links mailed with it.
+type ReminderJob struct {
+	ID            string    `json:"id"`
+	ReservationID string    `json:"reservationID"`
+	UserID        string    `json:"userID"`
+	Start         time.Time `json:"start"`
+	SendAt        time.Time `json:"sendAt"`
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	LeaseUntil    time.Time `json:"leaseUntil"`
+	TokenHashes   []string  `json:"tokenHashes,omitempty"`
+}
@@ -0,0 +1,130 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	ReservationPending               = "pending"
+	ReservationConfirmed             = "confirmed"
+	ReservationSeated                = "seated"
+	ReservationCompleted             = "completed"
+	ReservationCancelledByGuest      = "cancelled_by_guest"
+	ReservationCancelledByRestaurant = "cancelled_by_restaurant"
+	ReservationNoShow                = "no_show"
+)
+
+// Who may take an action on a reservation: the guest who made it or the staff of
+// the restaurant.
+const (
+	ActorGuest = "guest"
+	ActorStaff = "staff"
+)
+
+// ReservationAction moves a reservation from one of From to To.
+type ReservationAction struct {
+	Name  string
+	From  []string
+	To    string
+	Actor string
+	// BeforeStart and AfterStart limit the action to one side of the reservation time
+	BeforeStart bool
+	AfterStart  bool
+}
+
+// ReservationActions is the lifecycle of a reservation. Cancelled, completed and
+// no-show reservations are final and free their table.
+var ReservationActions = []ReservationAction{
+	{Name: "confirm", From: []string{ReservationPending}, To: ReservationConfirmed, Actor: ActorStaff},
+	{Name: "seat", From: []string{ReservationPending, ReservationConfirmed}, To: ReservationSeated, Actor: ActorStaff},
+	{Name: "complete", From: []string{ReservationSeated}, To: ReservationCompleted, Actor: ActorStaff},
+	{Name: "cancel", From: []string{ReservationPending, ReservationConfirmed}, To: ReservationCancelledByGuest, Actor: ActorGuest, BeforeStart: true},
+	{Name: "decline", From: []string{ReservationPending, ReservationConfirmed}, To: ReservationCancelledByRestaurant, Actor: ActorStaff},
+	{Name: "no-show", From: []string{ReservationPending, ReservationConfirmed}, To: ReservationNoShow, Actor: ActorStaff, AfterStart: true},
+}
+
+// ReservationEvent is a change of the status of a reservation.
+type ReservationEvent struct {
+	Action string    `json:"action"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	By     string    `json:"by"`
+	At     time.Time `json:"at"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// ReservationDetails are the parts of a reservation the reservation service has no
+// fields for, so the gateway keeps them next to the reservation id.
+type ReservationDetails struct {
+	ReservationID string `json:"reservationID"`
+	UserID        string `json:"userID"`
+	RestaurantID  string `json:"restaurantID"`
+	TableID       string `json:"tableID"`
+	PartySize     int    `json:"partySize"`
+	// GroupID ties together the reservations of the tables of a combination
+	GroupID       string `json:"groupID,omitempty"`
+	CombinationID string `json:"combinationID,omitempty"`
+	// SeriesID ties together the occurrences of a recurring reservation
+	SeriesID string             `json:"seriesID,omitempty"`
+	Status   string             `json:"status"`
+	History  []ReservationEvent `json:"history,omitempty"`
+	// GuestConfirmedAt is when the guest confirmed they are coming, from a reminder
+	GuestConfirmedAt *time.Time `json:"guestConfirmedAt,omitempty"`
+	CreatedAt        time.Time  `json:"createdAt"`
+}
+
+// Final reports whether the reservation is over and no longer holds its table.
+func (d ReservationDetails) Final() bool {
+	switch d.Status {
+	case ReservationCompleted, ReservationCancelledByGuest, ReservationCancelledByRestaurant, ReservationNoShow:
+		return true
+	}
+	return false
+}
+
+// NextActions are the actions the actor may take on a reservation in status that
+// starts at start.
+func NextActions(status, actor string, start, now time.Time) []string {
+	actions := make([]string, 0)
+	for _, action := range ReservationActions {
+		if action.Actor == actor && action.check(status, start, now) == nil {
+			actions = append(actions, action.Name)
+		}
+	}
+	return actions
+}
+
+// Transition returns the status the action moves a reservation to, or why the
+// actor can't take it.
+func Transition(status, name, actor string, start, now time.Time) (string, error) {
+	for _, action := range ReservationActions {
+		if action.Name != name {
+			continue
+		}
+		if action.Actor != actor {
+			return "", errors.New("only the " + action.Actor + " can " + name + " a reservation")
+		}
+		if err := action.check(status, start, now); err != nil {
+			return "", err
+		}
+		return action.To, nil
+	}
+	return "", errors.New("unknown action " + name)
+}
+
+func (a ReservationAction) check(status string, start, now time.Time) error {
+	allowed := false
+	for _, from := range a.From {
+		allowed = allowed || from == status
+	}
+	switch {
+	case !allowed:
+		return errors.New("can't " + a.Name + " a reservation that is " + status)
+	case a.BeforeStart && !now.Before(start):
+		return errors.New("can't " + a.Name + " a reservation that has already started")
+	case a.AfterStart && now.Before(start):
+		return errors.New("can't " + a.Name + " a reservation that hasn't started yet")
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+// RestaurantSettings are the restaurant details the restaurant service has no
+// fields for, so the gateway keeps them. Empty values fall back to the defaults
+// of the reservation config.
+type RestaurantSettings struct {
+	RestaurantID string `json:"restaurantID"`
+	Timezone     string `json:"timezone,omitempty"`
+	// MinOccupancy is the share of a table's seats, in percent, a party has to fill
+	MinOccupancy int                `json:"minOccupancy"`
+	Cancellation CancellationPolicy `json:"cancellation"`
+	UpdatedBy    string             `json:"updatedBy,omitempty"`
+	UpdatedAt    time.Time          `json:"updatedAt"`
+}
+
+// TableCombination is a group of tables a restaurant pushes together for parties
+// bigger than any of them.
+type TableCombination struct {
+	ID           string    `json:"id"`
+	RestaurantID string    `json:"restaurantID"`
+	TableIDs     []string  `json:"tableIDs"`
+	CreatedBy    string    `json:"createdBy"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// CancellationPolicy limits when guests can cancel. Up to FreeCancelMinutes before
+// the start a cancellation is free, later it counts as a late cancellation, and
+// within CutoffMinutes of the start it isn't possible at all. Guests with
+// MaxPenalties late cancellations and no-shows at the restaurant can't book there
+// any more. Zero values impose no limit.
+type CancellationPolicy struct {
+	FreeCancelMinutes int `json:"freeCancelMinutes"`
+	CutoffMinutes     int `json:"cutoffMinutes"`
+	MaxPenalties      int `json:"maxPenalties"`
+}
+
+// CheckCancel returns the penalty for cancelling a reservation that starts at start
+// at now, or why it can't be cancelled any more.
+func (p CancellationPolicy) CheckCancel(start, now time.Time) (string, error) {
+	left := start.Sub(now)
+	if p.CutoffMinutes > 0 && left < time.Duration(p.CutoffMinutes)*time.Minute {
+		return "", fmt.Errorf("reservations can't be cancelled less than %d minutes before they start", p.CutoffMinutes)
+	}
+	if p.FreeCancelMinutes > 0 && left < time.Duration(p.FreeCancelMinutes)*time.Minute {
+		return PenaltyLateCancel, nil
+	}
+	return "", nil
+}
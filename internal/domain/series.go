@@ -0,0 +1,138 @@
+package domain
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+
+	// MaxSeriesOccurrences bounds the reservations a series books at once.
+	MaxSeriesOccurrences = 60
+)
+
+const (
+	OccurrenceBooked    = "booked"
+	OccurrenceConflict  = "conflict"
+	OccurrenceSkipped   = "skipped"
+	OccurrenceCancelled = "cancelled"
+)
+
+const (
+	SeriesActive    = "active"
+	SeriesCancelled = "cancelled"
+)
+
+// Recurrence is the subset of an RFC 5545 RRULE the gateway books: FREQ=WEEKLY or
+// MONTHLY, INTERVAL, and an end with COUNT or UNTIL.
+type Recurrence struct {
+	Freq     string    `json:"freq"`
+	Interval int       `json:"interval"`
+	Count    int       `json:"count,omitempty"`
+	Until    time.Time `json:"until,omitempty"`
+}
+
+// ParseRecurrence parses a rule like "FREQ=WEEKLY;INTERVAL=2;UNTIL=20241231". A
+// date UNTIL is taken in loc and includes the whole day.
+func ParseRecurrence(rule string, loc *time.Location) (Recurrence, error) {
+	r := Recurrence{Interval: 1}
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+	for _, part := range strings.Split(rule, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return Recurrence{}, errors.New("must be KEY=VALUE parts separated by ;")
+		}
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.Freq = strings.ToUpper(value)
+			if r.Freq != FreqWeekly && r.Freq != FreqMonthly {
+				return Recurrence{}, errors.New("FREQ must be WEEKLY or MONTHLY")
+			}
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 {
+				return Recurrence{}, errors.New("INTERVAL must be a positive number")
+			}
+			r.Interval = interval
+		case "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 {
+				return Recurrence{}, errors.New("COUNT must be a positive number")
+			}
+			r.Count = count
+		case "UNTIL":
+			if until, err := time.Parse("20060102T150405Z", value); err == nil {
+				r.Until = until
+			} else if day, err := time.ParseInLocation("20060102", value, loc); err == nil {
+				r.Until = day.AddDate(0, 0, 1).Add(-time.Nanosecond)
+			} else {
+				return Recurrence{}, errors.New("UNTIL must be a date like 20241231 or a UTC time like 20241231T230000Z")
+			}
+		default:
+			return Recurrence{}, errors.New(key + " is not supported, use FREQ, INTERVAL, COUNT and UNTIL")
+		}
+	}
+	switch {
+	case r.Freq == "":
+		return Recurrence{}, errors.New("FREQ is required")
+	case r.Count == 0 && r.Until.IsZero():
+		return Recurrence{}, errors.New("COUNT or UNTIL is required")
+	case r.Count > 0 && !r.Until.IsZero():
+		return Recurrence{}, errors.New("COUNT and UNTIL can't be used together")
+	}
+	return r, nil
+}
+
+// Occurrences returns the starts of the series from start on, at most limit of
+// them. Monthly series skip the months without the day of start, like RFC 5545.
+func (r Recurrence) Occurrences(start time.Time, limit int) []time.Time {
+	var occurrences []time.Time
+	for i := 0; len(occurrences) < limit; i++ {
+		if r.Count > 0 && len(occurrences) == r.Count {
+			break
+		}
+		var next time.Time
+		switch r.Freq {
+		case FreqWeekly:
+			next = start.AddDate(0, 0, 7*r.Interval*i)
+		case FreqMonthly:
+			next = start.AddDate(0, r.Interval*i, 0)
+			if next.Day() != start.Day() {
+				continue
+			}
+		}
+		if !r.Until.IsZero() && next.After(r.Until) {
+			break
+		}
+		occurrences = append(occurrences, next)
+	}
+	return occurrences
+}
+
+// ReservationSeries is a reservation that recurs, booked as one reservation per
+// occurrence.
+type ReservationSeries struct {
+	ID           string             `json:"id"`
+	UserID       string             `json:"userID"`
+	RestaurantID string             `json:"restaurantID"`
+	TableID      string             `json:"tableID"`
+	PartySize    int                `json:"partySize"`
+	Rule         string             `json:"rule"`
+	Recurrence   Recurrence         `json:"recurrence"`
+	Status       string             `json:"status"`
+	Occurrences  []SeriesOccurrence `json:"occurrences"`
+	CreatedAt    time.Time          `json:"createdAt"`
+}
+
+// SeriesOccurrence is one start of a series. Booked occurrences have a
+// reservation, conflicting ones were left out because the table was taken, and
+// skipped and cancelled ones had their reservation cancelled by the guest.
+type SeriesOccurrence struct {
+	Start         time.Time `json:"start"`
+	Status        string    `json:"status"`
+	ReservationID string    `json:"reservationID,omitempty"`
+}
@@ -0,0 +1,28 @@
+package domain
+
+import "time"
+
+// StaffMember grants a user a staff role (restaurantAdmin or waiter) within a
+// single restaurant. The role in the jwt only says what the user can do, the
+// membership says where.
+type StaffMember struct {
+	RestaurantID string    `json:"restaurantID"`
+	UserID       string    `json:"userID"`
+	Role         string    `json:"role"`
+	AddedBy      string    `json:"addedBy"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// StaffInvite is sent by a restaurant admin to bring a waiter on board. Only the
+// hash of the token is stored.
+type StaffInvite struct {
+	ID           string     `json:"id"`
+	TokenHash    string     `json:"-"`
+	RestaurantID string     `json:"restaurantID"`
+	Email        string     `json:"email"`
+	Role         string     `json:"role"`
+	InvitedBy    string     `json:"invitedBy"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	ExpiresAt    time.Time  `json:"expiresAt"`
+	AcceptedAt   *time.Time `json:"acceptedAt,omitempty"`
+}
@@ -0,0 +1,49 @@
+package domain
+
+import "time"
+
+const (
+	AppealPending  = "pending"
+	AppealAccepted = "accepted"
+	AppealRejected = "rejected"
+)
+
+// Suspension blocks a user until Until, or for good when Until is nil. The user
+// can appeal once with the token sent in the notification, only its hash is stored.
+// Deactivated is set when the account was deactivated in the user service for the
+// suspension, it is activated again once the suspension ends and RestoredAt is set.
+type Suspension struct {
+	ID              string     `json:"id"`
+	UserID          string     `json:"userID"`
+	Reason          string     `json:"reason"`
+	SuspendedBy     string     `json:"suspendedBy"`
+	StartedAt       time.Time  `json:"startedAt"`
+	Until           *time.Time `json:"until,omitempty"`
+	LiftedAt        *time.Time `json:"liftedAt,omitempty"`
+	LiftedBy        string     `json:"liftedBy,omitempty"`
+	Deactivated     bool       `json:"deactivated,omitempty"`
+	RestoredAt      *time.Time `json:"restoredAt,omitempty"`
+	AppealTokenHash string     `json:"-"`
+	Appeal          *Appeal    `json:"appeal,omitempty"`
+}
+
+// Active reports whether the suspension still blocks the user at now.
+func (s Suspension) Active(now time.Time) bool {
+	return s.LiftedAt == nil && (s.Until == nil || now.Before(*s.Until))
+}
+
+// AwaitsRestore reports whether the suspension is over at now but the account it
+// deactivated hasn't been activated again.
+func (s Suspension) AwaitsRestore(now time.Time) bool {
+	return s.Deactivated && s.RestoredAt == nil && !s.Active(now)
+}
+
+// Appeal is the user's request to lift a suspension and the admin's answer.
+type Appeal struct {
+	Message     string     `json:"message"`
+	SubmittedAt time.Time  `json:"submittedAt"`
+	Status      string     `json:"status"`
+	Response    string     `json:"response,omitempty"`
+	ResolvedBy  string     `json:"resolvedBy,omitempty"`
+	ResolvedAt  *time.Time `json:"resolvedAt,omitempty"`
+}
@@ -13,6 +13,10 @@ const (
 	AdminRole           = "admin"
 	RestaurantAdminRole = "restaurantAdmin"
 	WaiterRole          = "waiter"
+	IntegrationRole     = "integration"
 	ActivatedRole       = "activated"
 	Plug                = "plug"
 )
+
+// Roles are the roles that can be granted to users by admins.
+var Roles = []string{UserRole, AdminRole, RestaurantAdminRole, WaiterRole}
@@ -0,0 +1,45 @@
+package domain
+
+import "time"
+
+const (
+	WaitlistWaiting = "waiting"
+	WaitlistOffered = "offered"
+	WaitlistClaimed = "claimed"
+	WaitlistExpired = "expired"
+	WaitlistLeft    = "left"
+)
+
+// WaitlistEntry is a guest waiting for a table for PartySize between From and To.
+// When a table frees up the guest gets an Offer, claimed with the token sent by
+// mail, only its hash is stored.
+type WaitlistEntry struct {
+	ID            string         `json:"id"`
+	UserID        string         `json:"userID"`
+	RestaurantID  string         `json:"restaurantID"`
+	PartySize     int            `json:"partySize"`
+	From          time.Time      `json:"from"`
+	To            time.Time      `json:"to"`
+	Status        string         `json:"status"`
+	Offer         *WaitlistOffer `json:"offer,omitempty"`
+	ReservationID string         `json:"reservationID,omitempty"`
+	CreatedAt     time.Time      `json:"createdAt"`
+}
+
+// WaitlistOffer holds a table for the guest until ExpiresAt.
+type WaitlistOffer struct {
+	TableID   string    `json:"tableID"`
+	Start     time.Time `json:"start"`
+	TokenHash string    `json:"-"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Wants reports whether the guest still waits for a table at start.
+func (e WaitlistEntry) Wants(start time.Time) bool {
+	return e.Status == WaitlistWaiting && !start.Before(e.From) && !start.After(e.To)
+}
+
+// Holds reports whether the entry holds an offered table at now.
+func (e WaitlistEntry) Holds(now time.Time) bool {
+	return e.Status == WaitlistOffered && e.Offer != nil && now.Before(e.Offer.ExpiresAt)
+}
@@ -0,0 +1,239 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reservista.kz/internal/domain"
+	"strings"
+	"time"
+)
+
+// Resolver finds the restaurant that owns the object with the given id, or for
+// the guest resolvers the user the object belongs to.
+type Resolver func(ctx context.Context, id string) (string, error)
+
+// StaffLookup returns the staff membership of a user within a restaurant and
+// domain.ErrNotFound if there is none.
+type StaffLookup interface {
+	Get(ctx context.Context, restaurantID, userID string) (domain.StaffMember, error)
+}
+
+const (
+	ResolverRestaurant  = "restaurant"
+	ResolverTable       = "table"
+	ResolverReservation = "reservation"
+
+	ResolverReservationGuest = "reservationGuest"
+)
+
+type conditionFunc func(ctx context.Context, s Subject) (*Violation, error)
+
+func (f conditionFunc) Check(ctx context.Context, s Subject) (*Violation, error) {
+	return f(ctx, s)
+}
+
+func deny(status int, format string, args ...interface{}) (*Violation, error) {
+	return &Violation{Status: status, Reason: fmt.Sprintf(format, args...)}, nil
+}
+
+// Authenticated requires a user or an API key.
+func Authenticated() Condition {
+	return conditionFunc(func(_ context.Context, s Subject) (*Violation, error) {
+		if !s.Authenticated {
+			return deny(http.StatusUnauthorized, "unauthorized access: missing roles")
+		}
+		return nil, nil
+	})
+}
+
+// AnyRole requires at least one of the roles.
+func AnyRole(roles ...string) Condition {
+	return conditionFunc(func(_ context.Context, s Subject) (*Violation, error) {
+		if !s.Authenticated {
+			return deny(http.StatusUnauthorized, "unauthorized access: missing roles")
+		}
+		if !hasAny(s.Roles, roles) {
+			return deny(http.StatusUnauthorized, "unauthorized access: access denied due to RBAC missing, requires one of %s", strings.Join(roles, ", "))
+		}
+		return nil, nil
+	})
+}
+
+// Activated requires the account to be activated. API keys count as activated.
+func Activated() Condition {
+	return conditionFunc(func(_ context.Context, s Subject) (*Violation, error) {
+		if !s.Authenticated {
+			return deny(http.StatusUnauthorized, "unauthorized access: missing activated field")
+		}
+		if !s.Activated {
+			return deny(http.StatusPartialContent, "activate your account first")
+		}
+		return nil, nil
+	})
+}
+
+// SelfOrRole allows users to access their own record, named by the path parameter
+// param, and users with one of roles every record.
+func SelfOrRole(param string, roles ...string) Condition {
+	return conditionFunc(func(_ context.Context, s Subject) (*Violation, error) {
+		if !s.Authenticated {
+			return deny(http.StatusUnauthorized, "unauthorized access: missing roles")
+		}
+		if s.UserID == "" || s.Params[param] != s.UserID && !hasAny(s.Roles, roles) {
+			return deny(http.StatusForbidden, "access denied: only your own record is available")
+		}
+		return nil, nil
+	})
+}
+
+// Scope requires API keys to carry the scope. Users are not affected.
+func Scope(scope string) Condition {
+	return conditionFunc(func(_ context.Context, s Subject) (*Violation, error) {
+		if s.APIKey != nil && !s.APIKey.HasScope(scope) {
+			return deny(http.StatusForbidden, "%s: %s", domain.ErrAPIKeyScope.Error(), scope)
+		}
+		return nil, nil
+	})
+}
+
+// Hours allows the route only between from and to ("15:04") in the location.
+// A window with from after to spans midnight.
+func Hours(from, to string, loc *time.Location) (Condition, error) {
+	start, err := time.Parse("15:04", from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start of hours: %w", err)
+	}
+	end, err := time.Parse("15:04", to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end of hours: %w", err)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	startMin, endMin := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	return conditionFunc(func(_ context.Context, s Subject) (*Violation, error) {
+		now := time.Now().In(loc)
+		minute := now.Hour()*60 + now.Minute()
+		var inside bool
+		if startMin <= endMin {
+			inside = minute >= startMin && minute < endMin
+		} else {
+			inside = minute >= startMin || minute < endMin
+		}
+		if !inside {
+			return deny(http.StatusForbidden, "route is only available between %s and %s (%s)", from, to, loc)
+		}
+		return nil, nil
+	}), nil
+}
+
+// SetResolver registers how ownership conditions find the restaurant of an object.
+func (e *Engine) SetResolver(name string, resolver Resolver) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.resolvers[name] = resolver
+}
+
+// Ownership requires the caller to be staff in one of staffRoles of the restaurant
+// that owns the object named by the path parameter param.
+func (e *Engine) Ownership(resolver, param string, staffRoles ...string) Condition {
+	return conditionFunc(func(ctx context.Context, s Subject) (*Violation, error) {
+		if !s.Authenticated {
+			return deny(http.StatusUnauthorized, "unauthorized access: missing roles")
+		}
+		id := s.Params[param]
+		if id == "" {
+			return deny(http.StatusBadRequest, "missing ID in the URL")
+		}
+		restaurantID := id
+		if resolver != ResolverRestaurant {
+			e.mu.RLock()
+			resolve, ok := e.resolvers[resolver]
+			e.mu.RUnlock()
+			if !ok {
+				return nil, fmt.Errorf("unknown ownership resolver %q", resolver)
+			}
+			var err error
+			restaurantID, err = resolve(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return e.CheckRestaurant(ctx, s, restaurantID, staffRoles...)
+	})
+}
+
+// GuestOrOwnership lets the user the object named by the path parameter param
+// belongs to through, found with the guest resolver, and requires Ownership with
+// resolver of everyone else.
+func (e *Engine) GuestOrOwnership(guest, resolver, param string, staffRoles ...string) Condition {
+	ownership := e.Ownership(resolver, param, staffRoles...)
+	return conditionFunc(func(ctx context.Context, s Subject) (*Violation, error) {
+		if !s.Authenticated {
+			return deny(http.StatusUnauthorized, "unauthorized access: missing roles")
+		}
+		id := s.Params[param]
+		if id == "" {
+			return deny(http.StatusBadRequest, "missing ID in the URL")
+		}
+		if s.APIKey == nil && s.UserID != "" {
+			e.mu.RLock()
+			resolve, ok := e.resolvers[guest]
+			e.mu.RUnlock()
+			if !ok {
+				return nil, fmt.Errorf("unknown guest resolver %q", guest)
+			}
+			userID, err := resolve(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if userID == s.UserID {
+				return nil, nil
+			}
+		}
+		return ownership.Check(ctx, s)
+	})
+}
+
+// CheckRestaurant checks that the subject is staff of the restaurant in one of
+// staffRoles. Global admins always pass, API keys have to belong to the restaurant.
+func (e *Engine) CheckRestaurant(ctx context.Context, s Subject, restaurantID string, staffRoles ...string) (*Violation, error) {
+	if restaurantID == "" {
+		return deny(http.StatusBadRequest, "missing restaurant id")
+	}
+	if hasAny(s.Roles, []string{domain.AdminRole}) {
+		return nil, nil
+	}
+	if s.APIKey != nil {
+		if s.APIKey.RestaurantID != restaurantID {
+			return deny(http.StatusForbidden, domain.ErrNotRestaurantStaff.Error())
+		}
+		return nil, nil
+	}
+	member, err := e.staff.Get(ctx, restaurantID, s.UserID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return deny(http.StatusForbidden, domain.ErrNotRestaurantStaff.Error())
+		}
+		return nil, err
+	}
+	// the membership role must also still be present in the token, so revoking
+	// the global role takes effect without touching memberships
+	if !hasAny([]string{member.Role}, staffRoles) || !hasAny(s.Roles, []string{member.Role}) {
+		return deny(http.StatusForbidden, domain.ErrNotRestaurantStaff.Error())
+	}
+	return nil, nil
+}
+
+func hasAny(have, want []string) bool {
+	for _, w := range want {
+		for _, h := range have {
+			if h == w {
+				return true
+			}
+		}
+	}
+	return false
+}
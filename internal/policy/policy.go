@@ -0,0 +1,161 @@
+package policy
+
+import (
+	"context"
+	"net/http"
+	"reservista.kz/internal/domain"
+	"reservista.kz/pkg/logger"
+	"strings"
+	"sync"
+)
+
+// Subject is the caller of a route as established by the identity middlewares.
+type Subject struct {
+	UserID        string
+	Roles         []string
+	Activated     bool
+	Authenticated bool
+	APIKey        *domain.APIKey
+	// Params are the path parameters of the route, used by ownership conditions.
+	Params map[string]string
+}
+
+// Violation explains why a condition denied the request. Status is the HTTP
+// status the gateway answers with.
+type Violation struct {
+	Status int    `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// Condition is a single requirement of a rule. An error means the condition
+// couldn't be evaluated, e.g. the target of an ownership check is unreachable.
+type Condition interface {
+	Check(ctx context.Context, s Subject) (*Violation, error)
+}
+
+// Rule lists the conditions for a route, e.g. Method "DELETE" and
+// Path "/api/restaurants/delete/:id". All conditions must hold.
+// Violations of a DryRun rule are only logged, which is meant for trying out rules
+// from the config; a route needs at least one enforced rule to be allowed.
+// Impersonation sessions may only call routes with a rule that sets
+// AllowImpersonation, reads included, as some GET routes change state.
+type Rule struct {
+	Method             string
+	Path               string
+	Conditions         []Condition
+	DryRun             bool
+	AllowImpersonation bool
+}
+
+// Decision is the outcome of evaluating every rule of a route.
+type Decision struct {
+	Route          string      `json:"route"`
+	Violations     []Violation `json:"violations,omitempty"`
+	DryRunDenials  []Violation `json:"dryRunDenials,omitempty"`
+	RulesEvaluated int         `json:"rulesEvaluated"`
+}
+
+func (d Decision) Allowed() bool {
+	return len(d.Violations) == 0
+}
+
+// Reasons returns the denial reasons of enforced rules.
+func (d Decision) Reasons() []string {
+	reasons := make([]string, 0, len(d.Violations))
+	for _, v := range d.Violations {
+		reasons = append(reasons, v.Reason)
+	}
+	return reasons
+}
+
+type Options struct {
+	Staff StaffLookup
+}
+
+type Engine struct {
+	staff StaffLookup
+
+	mu        sync.RWMutex
+	rules     map[string][]Rule
+	resolvers map[string]Resolver
+}
+
+func NewEngine(opts Options) *Engine {
+	return &Engine{
+		staff:     opts.Staff,
+		rules:     make(map[string][]Rule),
+		resolvers: make(map[string]Resolver),
+	}
+}
+
+func routeKey(method, path string) string {
+	return strings.ToUpper(method) + " " + path
+}
+
+// Register adds rules. Several rules for the same route are all evaluated, which
+// lets rules from the config tighten the ones defined in code.
+func (e *Engine) Register(rules ...Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, rule := range rules {
+		key := routeKey(rule.Method, rule.Path)
+		e.rules[key] = append(e.rules[key], rule)
+	}
+}
+
+// AllowsImpersonation reports whether an impersonation session may call the route.
+func (e *Engine) AllowsImpersonation(method, path string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, rule := range e.rules[routeKey(method, path)] {
+		if rule.AllowImpersonation {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate checks every rule of the route. Routes without an enforced rule are
+// denied, so a route can't be opened up by forgetting its rule.
+func (e *Engine) Evaluate(ctx context.Context, method, path string, s Subject) (Decision, error) {
+	key := routeKey(method, path)
+	e.mu.RLock()
+	rules := e.rules[key]
+	e.mu.RUnlock()
+
+	decision := Decision{Route: key, RulesEvaluated: len(rules)}
+	enforcedRules := 0
+	for _, rule := range rules {
+		if !rule.DryRun {
+			enforcedRules++
+		}
+	}
+	if enforcedRules == 0 {
+		decision.Violations = append(decision.Violations, Violation{Status: http.StatusForbidden, Reason: "no policy rule allows " + key})
+		return decision, nil
+	}
+	for _, rule := range rules {
+		enforced := !rule.DryRun
+		if enforced && !decision.Allowed() {
+			continue
+		}
+		for _, condition := range rule.Conditions {
+			violation, err := condition.Check(ctx, s)
+			if err != nil {
+				return decision, err
+			}
+			if violation == nil {
+				continue
+			}
+			if !enforced {
+				decision.DryRunDenials = append(decision.DryRunDenials, *violation)
+				logger.Infof("policy dry-run: %s would deny %q: %s", key, s.UserID, violation.Reason)
+				continue
+			}
+			decision.Violations = append(decision.Violations, *violation)
+			// the remaining conditions of an enforced rule don't change the outcome
+			break
+		}
+	}
+	return decision, nil
+}
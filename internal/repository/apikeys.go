@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"reservista.kz/internal/domain"
+	"sort"
+	"sync"
+	"time"
+)
+
+type APIKeysRepo struct {
+	mu   sync.RWMutex
+	keys map[string]domain.APIKey
+}
+
+func NewAPIKeysRepo() *APIKeysRepo {
+	return &APIKeysRepo{keys: make(map[string]domain.APIKey)}
+}
+
+func (r *APIKeysRepo) Create(_ context.Context, key domain.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.keys[key.ID]; ok {
+		return domain.ErrAlreadyExists
+	}
+	r.keys[key.ID] = key
+	return nil
+}
+
+func (r *APIKeysRepo) GetByID(_ context.Context, id string) (domain.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, ok := r.keys[id]
+	if !ok {
+		return domain.APIKey{}, domain.ErrNotFound
+	}
+	return key, nil
+}
+
+func (r *APIKeysRepo) GetByRestaurant(_ context.Context, restaurantID string) ([]domain.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	keys := make([]domain.APIKey, 0)
+	for _, key := range r.keys {
+		if key.RestaurantID == restaurantID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (r *APIKeysRepo) MarkUsed(_ context.Context, id string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key, ok := r.keys[id]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	key.LastUsedAt = &at
+	r.keys[id] = key
+	return nil
+}
+
+func (r *APIKeysRepo) Update(_ context.Context, key domain.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.keys[key.ID]; !ok {
+		return domain.ErrNotFound
+	}
+	r.keys[key.ID] = key
+	return nil
+}
+
+func (r *APIKeysRepo) DeleteByUser(_ context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, key := range r.keys {
+		if key.CreatedBy == userID {
+			delete(r.keys, id)
+		}
+	}
+	return nil
+}
+
+// storedAPIKey is the redis document of a key, the hash is left out of the JSON
+// of domain.APIKey so it never reaches a response.
+type storedAPIKey struct {
+	domain.APIKey
+	Hash string `json:"hash"`
+}
+
+// RedisAPIKeysRepo keeps the keys in redis, so partner integrations keep working
+// across restarts. The last use is kept apart from the key, so recording it
+// can't undo a concurrent rotation or revocation.
+type RedisAPIKeysRepo struct {
+	client redis.UniversalClient
+	prefix string
+	docs   *redisDocuments[storedAPIKey]
+}
+
+func NewRedisAPIKeysRepo(client redis.UniversalClient, prefix string) *RedisAPIKeysRepo {
+	return &RedisAPIKeysRepo{
+		client: client,
+		prefix: prefix,
+		docs: &redisDocuments[storedAPIKey]{
+			client: client,
+			prefix: prefix,
+			indexes: map[string]func(storedAPIKey) string{
+				"restaurant": func(key storedAPIKey) string { return key.RestaurantID },
+				"creator":    func(key storedAPIKey) string { return key.CreatedBy },
+			},
+		},
+	}
+}
+
+func (r *RedisAPIKeysRepo) Create(ctx context.Context, key domain.APIKey) error {
+	return r.docs.create(ctx, key.ID, storedAPIKey{APIKey: key, Hash: key.Hash})
+}
+
+func (r *RedisAPIKeysRepo) GetByID(ctx context.Context, id string) (domain.APIKey, error) {
+	stored, err := r.docs.get(ctx, id)
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+	return r.withLastUse(ctx, stored)
+}
+
+func (r *RedisAPIKeysRepo) GetByRestaurant(ctx context.Context, restaurantID string) ([]domain.APIKey, error) {
+	stored, err := r.docs.list(ctx, "restaurant", restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]domain.APIKey, 0, len(stored))
+	for _, s := range stored {
+		key, err := r.withLastUse(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (r *RedisAPIKeysRepo) MarkUsed(ctx context.Context, id string, at time.Time) error {
+	return r.client.Set(ctx, r.prefix+"used:"+id, at.Format(time.RFC3339Nano), 0).Err()
+}
+
+func (r *RedisAPIKeysRepo) Update(ctx context.Context, key domain.APIKey) error {
+	if _, err := r.docs.get(ctx, key.ID); err != nil {
+		return err
+	}
+	return r.docs.put(ctx, key.ID, storedAPIKey{APIKey: key, Hash: key.Hash})
+}
+
+func (r *RedisAPIKeysRepo) DeleteByUser(ctx context.Context, userID string) error {
+	keys, err := r.docs.list(ctx, "creator", userID)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := r.client.Del(ctx, r.prefix+"used:"+key.ID).Err(); err != nil {
+			return err
+		}
+	}
+	return r.docs.deleteBy(ctx, "creator", userID)
+}
+
+func (r *RedisAPIKeysRepo) withLastUse(ctx context.Context, stored storedAPIKey) (domain.APIKey, error) {
+	key := stored.APIKey
+	key.Hash = stored.Hash
+	used, err := r.client.Get(ctx, r.prefix+"used:"+key.ID).Result()
+	if errors.Is(err, redis.Nil) {
+		return key, nil
+	}
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+	if at, err := time.Parse(time.RFC3339Nano, used); err == nil {
+		key.LastUsedAt = &at
+	}
+	return key, nil
+}
@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/redis/go-redis/v9"
+	"reservista.kz/internal/domain"
+	"strings"
+	"sync"
+)
+
+// AuditRepo keeps the most recent audit entries in memory for the admin query
+// endpoint. The durable copy of the trail is written by the audit sinks.
+type AuditRepo struct {
+	mu         sync.RWMutex
+	entries    []domain.AuditEntry
+	maxEntries int
+}
+
+func NewAuditRepo(maxEntries int) *AuditRepo {
+	return &AuditRepo{maxEntries: maxEntries}
+}
+
+func (r *AuditRepo) Create(_ context.Context, entry domain.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+	if r.maxEntries > 0 && len(r.entries) > r.maxEntries {
+		r.entries = r.entries[len(r.entries)-r.maxEntries:]
+	}
+	return nil
+}
+
+func (r *AuditRepo) Anonymize(_ context.Context, userID, alias string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.entries {
+		r.entries[i].Anonymize(userID, alias)
+	}
+	return nil
+}
+
+// Find returns matching entries, newest first.
+func (r *AuditRepo) Find(_ context.Context, filter domain.AuditFilter) ([]domain.AuditEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make([]domain.AuditEntry, 0)
+	skipped := 0
+	for i := len(r.entries) - 1; i >= 0; i-- {
+		entry := r.entries[i]
+		if !matchesAudit(entry, filter) {
+			continue
+		}
+		if skipped < filter.Offset {
+			skipped++
+			continue
+		}
+		result = append(result, entry)
+		if filter.Limit > 0 && len(result) == filter.Limit {
+			break
+		}
+	}
+	return result, nil
+}
+
+// RedisAuditRepo keeps the latest maxEntries audit entries in redis, so the
+// history admins query survives restarts. prefix+"entries" orders the ids of the
+// entries by time, prefix+"entry:"+id holds an entry.
+type RedisAuditRepo struct {
+	client     redis.UniversalClient
+	prefix     string
+	maxEntries int
+}
+
+func NewRedisAuditRepo(client redis.UniversalClient, prefix string, maxEntries int) *RedisAuditRepo {
+	return &RedisAuditRepo{client: client, prefix: prefix, maxEntries: maxEntries}
+}
+
+func (r *RedisAuditRepo) Create(ctx context.Context, entry domain.AuditEntry) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, r.prefix+"entry:"+entry.ID, value, 0)
+		pipe.ZAdd(ctx, r.prefix+"entries", redis.Z{Score: float64(entry.Time.UnixMilli()), Member: entry.ID})
+		return nil
+	})
+	if err != nil || r.maxEntries <= 0 {
+		return err
+	}
+	dropped, err := r.client.ZRange(ctx, r.prefix+"entries", 0, int64(-r.maxEntries-1)).Result()
+	if err != nil || len(dropped) == 0 {
+		return err
+	}
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range dropped {
+			pipe.ZRem(ctx, r.prefix+"entries", id)
+			pipe.Del(ctx, r.prefix+"entry:"+id)
+		}
+		return nil
+	})
+	return err
+}
+
+// Anonymize rewrites the entries that mention the user. Entries dropped in the
+// meantime aren't written back.
+func (r *RedisAuditRepo) Anonymize(ctx context.Context, userID, alias string) error {
+	entries, err := r.newestFirst(ctx)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Anonymize(userID, alias) {
+			continue
+		}
+		value, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if err := r.client.SetXX(ctx, r.prefix+"entry:"+entry.ID, value, redis.KeepTTL).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Find returns matching entries, newest first.
+func (r *RedisAuditRepo) Find(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditEntry, error) {
+	entries, err := r.newestFirst(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]domain.AuditEntry, 0)
+	skipped := 0
+	for _, entry := range entries {
+		if !matchesAudit(entry, filter) {
+			continue
+		}
+		if skipped < filter.Offset {
+			skipped++
+			continue
+		}
+		result = append(result, entry)
+		if filter.Limit > 0 && len(result) == filter.Limit {
+			break
+		}
+	}
+	return result, nil
+}
+
+func (r *RedisAuditRepo) newestFirst(ctx context.Context) ([]domain.AuditEntry, error) {
+	ids, err := r.client.ZRevRange(ctx, r.prefix+"entries", 0, -1).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = r.prefix + "entry:" + id
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]domain.AuditEntry, 0, len(values))
+	for _, v := range values {
+		raw, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var entry domain.AuditEntry
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func matchesAudit(entry domain.AuditEntry, filter domain.AuditFilter) bool {
+	if filter.ActorID != "" && entry.ActorID != filter.ActorID {
+		return false
+	}
+	if filter.Action != "" && !strings.HasPrefix(entry.Action, filter.Action) {
+		return false
+	}
+	if filter.Route != "" && !strings.Contains(entry.Route, filter.Route) {
+		return false
+	}
+	if filter.Outcome != "" && entry.Outcome != filter.Outcome {
+		return false
+	}
+	if !filter.From.IsZero() && entry.Time.Before(filter.From) {
+		return false
+	}
+	if !filter.To.IsZero() && entry.Time.After(filter.To) {
+		return false
+	}
+	if filter.TargetID != "" {
+		found := false
+		for _, id := range entry.Targets {
+			if id == filter.TargetID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
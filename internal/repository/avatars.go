@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"reservista.kz/internal/domain"
+	"sync"
+)
+
+type AvatarsRepo struct {
+	mu      sync.RWMutex
+	avatars map[string]domain.Avatar
+}
+
+func NewAvatarsRepo() *AvatarsRepo {
+	return &AvatarsRepo{avatars: make(map[string]domain.Avatar)}
+}
+
+func (r *AvatarsRepo) Save(_ context.Context, avatar domain.Avatar) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.avatars[avatar.UserID] = avatar
+	return nil
+}
+
+func (r *AvatarsRepo) Get(_ context.Context, userID string) (domain.Avatar, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	avatar, ok := r.avatars[userID]
+	if !ok {
+		return domain.Avatar{}, domain.ErrNotFound
+	}
+	return avatar, nil
+}
+
+func (r *AvatarsRepo) Delete(_ context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.avatars[userID]; !ok {
+		return domain.ErrNotFound
+	}
+	delete(r.avatars, userID)
+	return nil
+}
+
+// storedAvatar is the redis document of an avatar, the owner and the S3 keys are
+// left out of the JSON of domain.Avatar so they never reach a response.
+type storedAvatar struct {
+	domain.Avatar
+	UserID string   `json:"userID"`
+	Keys   []string `json:"keys"`
+}
+
+// RedisAvatarsRepo keeps the avatars in redis. The user service has no field for
+// the avatar, so this is the only durable record of the URLs and of the S3 objects
+// to delete with the avatar.
+type RedisAvatarsRepo struct {
+	docs *redisDocuments[storedAvatar]
+}
+
+func NewRedisAvatarsRepo(client redis.UniversalClient, prefix string) *RedisAvatarsRepo {
+	return &RedisAvatarsRepo{docs: &redisDocuments[storedAvatar]{client: client, prefix: prefix}}
+}
+
+func (r *RedisAvatarsRepo) Save(ctx context.Context, avatar domain.Avatar) error {
+	return r.docs.put(ctx, avatar.UserID, storedAvatar{Avatar: avatar, UserID: avatar.UserID, Keys: avatar.Keys})
+}
+
+func (r *RedisAvatarsRepo) Get(ctx context.Context, userID string) (domain.Avatar, error) {
+	stored, err := r.docs.get(ctx, userID)
+	if err != nil {
+		return domain.Avatar{}, err
+	}
+	avatar := stored.Avatar
+	avatar.UserID, avatar.Keys = stored.UserID, stored.Keys
+	return avatar, nil
+}
+
+func (r *RedisAvatarsRepo) Delete(ctx context.Context, userID string) error {
+	if _, err := r.docs.get(ctx, userID); err != nil {
+		return err
+	}
+	return r.docs.delete(ctx, userID)
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"reservista.kz/internal/domain"
+	"sort"
+	"sync"
+)
+
+type TableCombinationsRepo struct {
+	mu           sync.RWMutex
+	combinations map[string]domain.TableCombination
+}
+
+func NewTableCombinationsRepo() *TableCombinationsRepo {
+	return &TableCombinationsRepo{combinations: make(map[string]domain.TableCombination)}
+}
+
+func (r *TableCombinationsRepo) Save(_ context.Context, combination domain.TableCombination) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.combinations[combination.ID] = combination
+	return nil
+}
+
+func (r *TableCombinationsRepo) Get(_ context.Context, id string) (domain.TableCombination, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	combination, ok := r.combinations[id]
+	if !ok {
+		return domain.TableCombination{}, domain.ErrNotFound
+	}
+	return combination, nil
+}
+
+func (r *TableCombinationsRepo) GetByRestaurant(_ context.Context, restaurantID string) ([]domain.TableCombination, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	combinations := make([]domain.TableCombination, 0)
+	for _, combination := range r.combinations {
+		if combination.RestaurantID == restaurantID {
+			combinations = append(combinations, combination)
+		}
+	}
+	sort.Slice(combinations, func(i, j int) bool { return combinations[i].CreatedAt.Before(combinations[j].CreatedAt) })
+	return combinations, nil
+}
+
+func (r *TableCombinationsRepo) Delete(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.combinations[id]; !ok {
+		return domain.ErrNotFound
+	}
+	delete(r.combinations, id)
+	return nil
+}
+
+// RedisTableCombinationsRepo keeps the table combinations in redis, so they
+// survive restarts.
+type RedisTableCombinationsRepo struct {
+	docs *redisDocuments[domain.TableCombination]
+}
+
+func NewRedisTableCombinationsRepo(client redis.UniversalClient, prefix string) *RedisTableCombinationsRepo {
+	return &RedisTableCombinationsRepo{docs: &redisDocuments[domain.TableCombination]{
+		client: client,
+		prefix: prefix,
+		indexes: map[string]func(domain.TableCombination) string{
+			"restaurant": func(combination domain.TableCombination) string { return combination.RestaurantID },
+		},
+	}}
+}
+
+func (r *RedisTableCombinationsRepo) Save(ctx context.Context, combination domain.TableCombination) error {
+	return r.docs.put(ctx, combination.ID, combination)
+}
+
+func (r *RedisTableCombinationsRepo) Get(ctx context.Context, id string) (domain.TableCombination, error) {
+	return r.docs.get(ctx, id)
+}
+
+func (r *RedisTableCombinationsRepo) GetByRestaurant(ctx context.Context, restaurantID string) ([]domain.TableCombination, error) {
+	combinations, err := r.docs.list(ctx, "restaurant", restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	if combinations == nil {
+		combinations = make([]domain.TableCombination, 0)
+	}
+	sort.Slice(combinations, func(i, j int) bool { return combinations[i].CreatedAt.Before(combinations[j].CreatedAt) })
+	return combinations, nil
+}
+
+func (r *RedisTableCombinationsRepo) Delete(ctx context.Context, id string) error {
+	if _, err := r.docs.get(ctx, id); err != nil {
+		return err
+	}
+	return r.docs.delete(ctx, id)
+}
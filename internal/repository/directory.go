@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/redis/go-redis/v9"
+	"reservista.kz/internal/domain"
+	"sort"
+	"sync"
+)
+
+// DirectoryRepo keeps the profiles of the users listed in the admin directory, as
+// the gateway last saw them.
+type DirectoryRepo struct {
+	mu    sync.RWMutex
+	users map[string]domain.DirectoryUser
+}
+
+func NewDirectoryRepo() *DirectoryRepo {
+	return &DirectoryRepo{users: make(map[string]domain.DirectoryUser)}
+}
+
+func (r *DirectoryRepo) Save(_ context.Context, user domain.DirectoryUser) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user.Roles = append([]string(nil), user.Roles...)
+	r.users[user.ID] = user
+	return nil
+}
+
+// GetAll returns every profile, ordered by id.
+func (r *DirectoryRepo) GetAll(_ context.Context) ([]domain.DirectoryUser, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	users := make([]domain.DirectoryUser, 0, len(r.users))
+	for _, user := range r.users {
+		user.Roles = append([]string(nil), user.Roles...)
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (r *DirectoryRepo) Delete(_ context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.users, userID)
+	return nil
+}
+
+// RedisDirectoryRepo keeps the profiles in a redis hash by user id, so users who
+// signed in before a restart stay listed.
+type RedisDirectoryRepo struct {
+	client redis.UniversalClient
+	key    string
+}
+
+func NewRedisDirectoryRepo(client redis.UniversalClient, prefix string) *RedisDirectoryRepo {
+	return &RedisDirectoryRepo{client: client, key: prefix + "profiles"}
+}
+
+func (r *RedisDirectoryRepo) Save(ctx context.Context, user domain.DirectoryUser) error {
+	value, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	return r.client.HSet(ctx, r.key, user.ID, value).Err()
+}
+
+// GetAll returns every profile, ordered by id.
+func (r *RedisDirectoryRepo) GetAll(ctx context.Context) ([]domain.DirectoryUser, error) {
+	values, err := r.client.HGetAll(ctx, r.key).Result()
+	if err != nil {
+		return nil, err
+	}
+	users := make([]domain.DirectoryUser, 0, len(values))
+	for _, value := range values {
+		var user domain.DirectoryUser
+		if err := json.Unmarshal([]byte(value), &user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (r *RedisDirectoryRepo) Delete(ctx context.Context, userID string) error {
+	return r.client.HDel(ctx, r.key, userID).Err()
+}
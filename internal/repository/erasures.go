@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"reservista.kz/internal/domain"
+	"sync"
+	"time"
+)
+
+// ErasuresRepo keeps the latest erasure request of every user.
+type ErasuresRepo struct {
+	mu       sync.RWMutex
+	requests map[string]domain.ErasureRequest
+	attempts map[string]int
+}
+
+func NewErasuresRepo() *ErasuresRepo {
+	return &ErasuresRepo{
+		requests: make(map[string]domain.ErasureRequest),
+		attempts: make(map[string]int),
+	}
+}
+
+func (r *ErasuresRepo) Save(_ context.Context, request domain.ErasureRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests[request.UserID] = request
+	return nil
+}
+
+func (r *ErasuresRepo) GetByUser(_ context.Context, userID string) (domain.ErasureRequest, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	request, ok := r.requests[userID]
+	if !ok {
+		return domain.ErasureRequest{}, domain.ErrNotFound
+	}
+	return request, nil
+}
+
+// GetDue returns scheduled requests whose grace period is over.
+func (r *ErasuresRepo) GetDue(_ context.Context, now time.Time) ([]domain.ErasureRequest, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var due []domain.ErasureRequest
+	for _, request := range r.requests {
+		if request.Status == domain.ErasureScheduled && request.ScheduledFor != nil && !request.ScheduledFor.After(now) {
+			due = append(due, request)
+		}
+	}
+	return due, nil
+}
+
+func (r *ErasuresRepo) AddAttempt(_ context.Context, requestID string, _ time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts[requestID]++
+	return r.attempts[requestID], nil
+}
+
+// storedErasure is the redis document of a request, the code hash is left out of
+// the JSON of domain.ErasureRequest so it never reaches a response.
+type storedErasure struct {
+	domain.ErasureRequest
+	CodeHash string `json:"codeHash,omitempty"`
+}
+
+// RedisErasuresRepo keeps the requests in redis, so a scheduled erasure is carried
+// out and an erased user stays signed out across restarts.
+type RedisErasuresRepo struct {
+	client redis.UniversalClient
+	prefix string
+	docs   *redisDocuments[storedErasure]
+}
+
+func NewRedisErasuresRepo(client redis.UniversalClient, prefix string) *RedisErasuresRepo {
+	return &RedisErasuresRepo{
+		client: client,
+		prefix: prefix,
+		docs: &redisDocuments[storedErasure]{
+			client: client,
+			prefix: prefix,
+			indexes: map[string]func(storedErasure) string{
+				"status": func(request storedErasure) string { return request.Status },
+			},
+		},
+	}
+}
+
+func (r *RedisErasuresRepo) Save(ctx context.Context, request domain.ErasureRequest) error {
+	return r.docs.put(ctx, request.UserID, storedErasure{ErasureRequest: request, CodeHash: request.CodeHash})
+}
+
+func (r *RedisErasuresRepo) GetByUser(ctx context.Context, userID string) (domain.ErasureRequest, error) {
+	stored, err := r.docs.get(ctx, userID)
+	if err != nil {
+		return domain.ErasureRequest{}, err
+	}
+	request := stored.ErasureRequest
+	request.CodeHash = stored.CodeHash
+	return request, nil
+}
+
+func (r *RedisErasuresRepo) GetDue(ctx context.Context, now time.Time) ([]domain.ErasureRequest, error) {
+	scheduled, err := r.docs.list(ctx, "status", domain.ErasureScheduled)
+	if err != nil {
+		return nil, err
+	}
+	var due []domain.ErasureRequest
+	for _, stored := range scheduled {
+		if stored.ScheduledFor != nil && !stored.ScheduledFor.After(now) {
+			due = append(due, stored.ErasureRequest)
+		}
+	}
+	return due, nil
+}
+
+func (r *RedisErasuresRepo) AddAttempt(ctx context.Context, requestID string, expiresAt time.Time) (int, error) {
+	key := r.prefix + "attempts:" + requestID
+	var attempts *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		attempts = pipe.Incr(ctx, key)
+		pipe.ExpireAt(ctx, key, expiresAt)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(attempts.Val()), nil
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"reservista.kz/internal/domain"
+	"strings"
+	"sync"
+	"time"
+)
+
+type idempotencyEntry struct {
+	request   domain.IdempotentRequest
+	expiresAt time.Time
+}
+
+type IdempotencyRepo struct {
+	mu      sync.Mutex
+	entries map[string]idempotencyEntry
+	sweptAt time.Time
+}
+
+func NewIdempotencyRepo() *IdempotencyRepo {
+	return &IdempotencyRepo{entries: make(map[string]idempotencyEntry)}
+}
+
+func (r *IdempotencyRepo) Begin(_ context.Context, key string, request domain.IdempotentRequest, ttl time.Duration) (domain.IdempotentRequest, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.sweep(now)
+	if entry, ok := r.entries[key]; ok && now.Before(entry.expiresAt) {
+		return entry.request, false, nil
+	}
+	r.entries[key] = idempotencyEntry{request: request, expiresAt: now.Add(ttl)}
+	return request, true, nil
+}
+
+func (r *IdempotencyRepo) Complete(_ context.Context, key string, request domain.IdempotentRequest, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[key] = idempotencyEntry{request: request, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (r *IdempotencyRepo) Release(_ context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.entries, key)
+	return nil
+}
+
+func (r *IdempotencyRepo) DeleteByUser(_ context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.entries {
+		if strings.HasPrefix(key, userID+"|") {
+			delete(r.entries, key)
+		}
+	}
+	return nil
+}
+
+// sweep drops expired entries, at most once a minute.
+func (r *IdempotencyRepo) sweep(now time.Time) {
+	if now.Sub(r.sweptAt) < time.Minute {
+		return
+	}
+	r.sweptAt = now
+	for key, entry := range r.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(r.entries, key)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"reservista.kz/internal/domain"
+	"strings"
+	"time"
+)
+
+// RedisIdempotencyRepo shares idempotency keys between gateway instances. Keys
+// expire on their own, so nothing has to clean them up. prefix+"user:"+userID
+// holds the keys of a user, for DeleteByUser.
+type RedisIdempotencyRepo struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+func NewRedisIdempotencyRepo(client redis.UniversalClient, prefix string) *RedisIdempotencyRepo {
+	return &RedisIdempotencyRepo{client: client, prefix: prefix}
+}
+
+func (r *RedisIdempotencyRepo) Begin(ctx context.Context, key string, request domain.IdempotentRequest, ttl time.Duration) (domain.IdempotentRequest, bool, error) {
+	value, err := json.Marshal(request)
+	if err != nil {
+		return domain.IdempotentRequest{}, false, err
+	}
+	// the stored request may expire between SETNX and GET, then the key is free again
+	for attempt := 0; attempt < 2; attempt++ {
+		claimed, err := r.client.SetNX(ctx, r.prefix+key, value, ttl).Result()
+		if err != nil {
+			return domain.IdempotentRequest{}, false, err
+		}
+		if claimed {
+			return request, true, r.index(ctx, key, ttl)
+		}
+		stored, err := r.client.Get(ctx, r.prefix+key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return domain.IdempotentRequest{}, false, err
+		}
+		var existing domain.IdempotentRequest
+		if err := json.Unmarshal(stored, &existing); err != nil {
+			return domain.IdempotentRequest{}, false, err
+		}
+		return existing, false, nil
+	}
+	return domain.IdempotentRequest{}, false, errors.New("idempotency key keeps expiring")
+}
+
+func (r *RedisIdempotencyRepo) Complete(ctx context.Context, key string, request domain.IdempotentRequest, ttl time.Duration) error {
+	value, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	if err := r.client.Set(ctx, r.prefix+key, value, ttl).Err(); err != nil {
+		return err
+	}
+	return r.index(ctx, key, ttl)
+}
+
+func (r *RedisIdempotencyRepo) Release(ctx context.Context, key string) error {
+	return r.client.Del(ctx, r.prefix+key).Err()
+}
+
+func (r *RedisIdempotencyRepo) DeleteByUser(ctx context.Context, userID string) error {
+	keys, err := r.client.SMembers(ctx, r.prefix+"user:"+userID).Result()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := r.client.Del(ctx, r.prefix+key).Err(); err != nil {
+			return err
+		}
+	}
+	return r.client.Del(ctx, r.prefix+"user:"+userID).Err()
+}
+
+func (r *RedisIdempotencyRepo) index(ctx context.Context, key string, ttl time.Duration) error {
+	userID, _, found := strings.Cut(key, "|")
+	if !found {
+		return nil
+	}
+	return addToExpiringSet(ctx, r.client, r.prefix+"user:"+userID, key, ttl)
+}
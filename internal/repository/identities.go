@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"reservista.kz/internal/domain"
+	"sync"
+	"time"
+)
+
+type IdentitiesRepo struct {
+	mu         sync.RWMutex
+	identities map[string]domain.Identity
+}
+
+func NewIdentitiesRepo() *IdentitiesRepo {
+	return &IdentitiesRepo{identities: make(map[string]domain.Identity)}
+}
+
+func identityKey(provider, subject string) string {
+	return provider + "|" + subject
+}
+
+func (r *IdentitiesRepo) Create(_ context.Context, identity domain.Identity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := identityKey(identity.Provider, identity.Subject)
+	if _, ok := r.identities[key]; ok {
+		return domain.ErrAlreadyExists
+	}
+	if identity.CreatedAt.IsZero() {
+		identity.CreatedAt = time.Now()
+	}
+	r.identities[key] = identity
+	return nil
+}
+
+func (r *IdentitiesRepo) Get(_ context.Context, provider, subject string) (domain.Identity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	identity, ok := r.identities[identityKey(provider, subject)]
+	if !ok {
+		return domain.Identity{}, domain.ErrNotFound
+	}
+	return identity, nil
+}
+
+func (r *IdentitiesRepo) GetByUser(_ context.Context, userID string) ([]domain.Identity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var identities []domain.Identity
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+func (r *IdentitiesRepo) DeleteByUser(_ context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, identity := range r.identities {
+		if identity.UserID == userID {
+			delete(r.identities, key)
+		}
+	}
+	return nil
+}
+
+// RedisIdentitiesRepo keeps the links in redis, so users that only ever signed in
+// with a provider can still sign in after a restart.
+type RedisIdentitiesRepo struct {
+	docs *redisDocuments[domain.Identity]
+}
+
+func NewRedisIdentitiesRepo(client redis.UniversalClient, prefix string) *RedisIdentitiesRepo {
+	return &RedisIdentitiesRepo{docs: &redisDocuments[domain.Identity]{
+		client: client,
+		prefix: prefix,
+		indexes: map[string]func(domain.Identity) string{
+			"user": func(identity domain.Identity) string { return identity.UserID },
+		},
+	}}
+}
+
+func (r *RedisIdentitiesRepo) Create(ctx context.Context, identity domain.Identity) error {
+	if identity.CreatedAt.IsZero() {
+		identity.CreatedAt = time.Now()
+	}
+	return r.docs.create(ctx, identityKey(identity.Provider, identity.Subject), identity)
+}
+
+func (r *RedisIdentitiesRepo) Get(ctx context.Context, provider, subject string) (domain.Identity, error) {
+	return r.docs.get(ctx, identityKey(provider, subject))
+}
+
+func (r *RedisIdentitiesRepo) GetByUser(ctx context.Context, userID string) ([]domain.Identity, error) {
+	return r.docs.list(ctx, "user", userID)
+}
+
+func (r *RedisIdentitiesRepo) DeleteByUser(ctx context.Context, userID string) error {
+	identities, err := r.docs.list(ctx, "user", userID)
+	if err != nil {
+		return err
+	}
+	for _, identity := range identities {
+		if err := r.docs.delete(ctx, identityKey(identity.Provider, identity.Subject)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
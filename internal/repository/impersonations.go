@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"reservista.kz/internal/domain"
+	"sort"
+	"sync"
+)
+
+type ImpersonationsRepo struct {
+	mu       sync.RWMutex
+	sessions map[string]domain.Impersonation
+}
+
+func NewImpersonationsRepo() *ImpersonationsRepo {
+	return &ImpersonationsRepo{sessions: make(map[string]domain.Impersonation)}
+}
+
+func (r *ImpersonationsRepo) Create(_ context.Context, session domain.Impersonation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sessions[session.ID]; ok {
+		return domain.ErrAlreadyExists
+	}
+	r.sessions[session.ID] = session
+	return nil
+}
+
+func (r *ImpersonationsRepo) Get(_ context.Context, id string) (domain.Impersonation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	session, ok := r.sessions[id]
+	if !ok {
+		return domain.Impersonation{}, domain.ErrNotFound
+	}
+	return session, nil
+}
+
+func (r *ImpersonationsRepo) Update(_ context.Context, session domain.Impersonation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sessions[session.ID]; !ok {
+		return domain.ErrNotFound
+	}
+	r.sessions[session.ID] = session
+	return nil
+}
+
+func (r *ImpersonationsRepo) GetByUser(_ context.Context, userID string) ([]domain.Impersonation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var sessions []domain.Impersonation
+	for _, session := range r.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+// GetByActor returns the sessions in which the user impersonated others.
+func (r *ImpersonationsRepo) GetByActor(_ context.Context, actorID string) ([]domain.Impersonation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var sessions []domain.Impersonation
+	for _, session := range r.sessions {
+		if session.ActorID == actorID {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+// RedisImpersonationsRepo keeps impersonation sessions in redis, so their tokens
+// stay valid, and can be ended, across restarts.
+type RedisImpersonationsRepo struct {
+	docs *redisDocuments[domain.Impersonation]
+}
+
+func NewRedisImpersonationsRepo(client redis.UniversalClient, prefix string) *RedisImpersonationsRepo {
+	return &RedisImpersonationsRepo{docs: &redisDocuments[domain.Impersonation]{
+		client: client,
+		prefix: prefix,
+		indexes: map[string]func(domain.Impersonation) string{
+			"user":  func(session domain.Impersonation) string { return session.UserID },
+			"actor": func(session domain.Impersonation) string { return session.ActorID },
+		},
+	}}
+}
+
+func (r *RedisImpersonationsRepo) Create(ctx context.Context, session domain.Impersonation) error {
+	return r.docs.create(ctx, session.ID, session)
+}
+
+func (r *RedisImpersonationsRepo) Get(ctx context.Context, id string) (domain.Impersonation, error) {
+	return r.docs.get(ctx, id)
+}
+
+func (r *RedisImpersonationsRepo) Update(ctx context.Context, session domain.Impersonation) error {
+	if _, err := r.docs.get(ctx, session.ID); err != nil {
+		return err
+	}
+	return r.docs.put(ctx, session.ID, session)
+}
+
+// GetByUser returns the sessions in which the user was impersonated, oldest first.
+func (r *RedisImpersonationsRepo) GetByUser(ctx context.Context, userID string) ([]domain.Impersonation, error) {
+	sessions, err := r.docs.list(ctx, "user", userID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].StartedAt.Before(sessions[j].StartedAt) })
+	return sessions, nil
+}
+
+// GetByActor returns the sessions in which the user impersonated others, oldest
+// first.
+func (r *RedisImpersonationsRepo) GetByActor(ctx context.Context, actorID string) ([]domain.Impersonation, error) {
+	sessions, err := r.docs.list(ctx, "actor", actorID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].StartedAt.Before(sessions[j].StartedAt) })
+	return sessions, nil
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"reservista.kz/internal/domain"
+	"sync"
+)
+
+type StaffInvitesRepo struct {
+	mu      sync.RWMutex
+	invites map[string]domain.StaffInvite
+}
+
+func NewStaffInvitesRepo() *StaffInvitesRepo {
+	return &StaffInvitesRepo{invites: make(map[string]domain.StaffInvite)}
+}
+
+func (r *StaffInvitesRepo) Create(_ context.Context, invite domain.StaffInvite) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.invites[invite.ID]; ok {
+		return domain.ErrAlreadyExists
+	}
+	r.invites[invite.ID] = invite
+	return nil
+}
+
+func (r *StaffInvitesRepo) GetByTokenHash(_ context.Context, tokenHash string) (domain.StaffInvite, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, invite := range r.invites {
+		if invite.TokenHash == tokenHash {
+			return invite, nil
+		}
+	}
+	return domain.StaffInvite{}, domain.ErrNotFound
+}
+
+func (r *StaffInvitesRepo) Update(_ context.Context, invite domain.StaffInvite) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.invites[invite.ID]; !ok {
+		return domain.ErrNotFound
+	}
+	r.invites[invite.ID] = invite
+	return nil
+}
+
+func (r *StaffInvitesRepo) DeleteByUser(_ context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, invite := range r.invites {
+		if invite.InvitedBy == userID {
+			delete(r.invites, id)
+		}
+	}
+	return nil
+}
+
+// storedInvite is the redis document of an invite, the token hash is left out of
+// the JSON of domain.StaffInvite so it never reaches a response.
+type storedInvite struct {
+	domain.StaffInvite
+	TokenHash string `json:"tokenHash"`
+}
+
+// RedisStaffInvitesRepo keeps the invites in redis, so links mailed before a
+// restart can still be accepted.
+type RedisStaffInvitesRepo struct {
+	docs *redisDocuments[storedInvite]
+}
+
+func NewRedisStaffInvitesRepo(client redis.UniversalClient, prefix string) *RedisStaffInvitesRepo {
+	return &RedisStaffInvitesRepo{docs: &redisDocuments[storedInvite]{
+		client: client,
+		prefix: prefix,
+		indexes: map[string]func(storedInvite) string{
+			"token":   func(invite storedInvite) string { return invite.TokenHash },
+			"inviter": func(invite storedInvite) string { return invite.InvitedBy },
+		},
+	}}
+}
+
+func (r *RedisStaffInvitesRepo) Create(ctx context.Context, invite domain.StaffInvite) error {
+	return r.docs.create(ctx, invite.ID, storedInvite{StaffInvite: invite, TokenHash: invite.TokenHash})
+}
+
+func (r *RedisStaffInvitesRepo) GetByTokenHash(ctx context.Context, tokenHash string) (domain.StaffInvite, error) {
+	if tokenHash == "" {
+		return domain.StaffInvite{}, domain.ErrNotFound
+	}
+	found, err := r.docs.list(ctx, "token", tokenHash)
+	if err != nil {
+		return domain.StaffInvite{}, err
+	}
+	if len(found) == 0 {
+		return domain.StaffInvite{}, domain.ErrNotFound
+	}
+	return found[0].restore(), nil
+}
+
+func (r *RedisStaffInvitesRepo) Update(ctx context.Context, invite domain.StaffInvite) error {
+	if _, err := r.docs.get(ctx, invite.ID); err != nil {
+		return err
+	}
+	return r.docs.put(ctx, invite.ID, storedInvite{StaffInvite: invite, TokenHash: invite.TokenHash})
+}
+
+func (r *RedisStaffInvitesRepo) DeleteByUser(ctx context.Context, userID string) error {
+	return r.docs.deleteBy(ctx, "inviter", userID)
+}
+
+func (s storedInvite) restore() domain.StaffInvite {
+	invite := s.StaffInvite
+	invite.TokenHash = s.TokenHash
+	return invite
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"reservista.kz/internal/domain"
+	"sort"
+	"sync"
+	"time"
+)
+
+type OIDCStatesRepo struct {
+	mu     sync.Mutex
+	states map[string]domain.OIDCState
+}
+
+func NewOIDCStatesRepo() *OIDCStatesRepo {
+	return &OIDCStatesRepo{states: make(map[string]domain.OIDCState)}
+}
+
+func (r *OIDCStatesRepo) Save(_ context.Context, state domain.OIDCState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	// abandoned logins are dropped lazily on every write
+	for key, s := range r.states {
+		if now.After(s.ExpiresAt) {
+			delete(r.states, key)
+		}
+	}
+	r.states[state.State] = state
+	return nil
+}
+
+func (r *OIDCStatesRepo) Pop(_ context.Context, state string) (domain.OIDCState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.states[state]
+	if !ok {
+		return domain.OIDCState{}, domain.ErrOIDCStateInvalid
+	}
+	delete(r.states, state)
+	if time.Now().After(s.ExpiresAt) {
+		return domain.OIDCState{}, domain.ErrOIDCStateInvalid
+	}
+	return s, nil
+}
+
+func (r *OIDCStatesRepo) GetByLinkUser(_ context.Context, userID string) ([]domain.OIDCState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	states := make([]domain.OIDCState, 0)
+	for _, s := range r.states {
+		if s.LinkUserID == userID && now.Before(s.ExpiresAt) {
+			states = append(states, s)
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].ExpiresAt.Before(states[j].ExpiresAt) })
+	return states, nil
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"reservista.kz/internal/domain"
+	"sort"
+	"sync"
+)
+
+type PenaltiesRepo struct {
+	mu        sync.RWMutex
+	penalties map[string][]domain.GuestPenalty
+}
+
+func NewPenaltiesRepo() *PenaltiesRepo {
+	return &PenaltiesRepo{penalties: make(map[string][]domain.GuestPenalty)}
+}
+
+func (r *PenaltiesRepo) Add(_ context.Context, penalty domain.GuestPenalty) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.penalties[penalty.UserID] = append(r.penalties[penalty.UserID], penalty)
+	return nil
+}
+
+// GetByUser returns the penalties of the user at the restaurant, oldest first.
+func (r *PenaltiesRepo) GetByUser(_ context.Context, restaurantID, userID string) ([]domain.GuestPenalty, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	penalties := make([]domain.GuestPenalty, 0)
+	for _, penalty := range r.penalties[userID] {
+		if penalty.RestaurantID == restaurantID {
+			penalties = append(penalties, penalty)
+		}
+	}
+	sort.Slice(penalties, func(i, j int) bool { return penalties[i].CreatedAt.Before(penalties[j].CreatedAt) })
+	return penalties, nil
+}
+
+func (r *PenaltiesRepo) DeleteByUser(_ context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.penalties, userID)
+	return nil
+}
+
+// RedisPenaltiesRepo keeps the penalties in redis, indexed by guest.
+type RedisPenaltiesRepo struct {
+	docs *redisDocuments[domain.GuestPenalty]
+}
+
+func NewRedisPenaltiesRepo(client redis.UniversalClient, prefix string) *RedisPenaltiesRepo {
+	return &RedisPenaltiesRepo{docs: &redisDocuments[domain.GuestPenalty]{
+		client: client,
+		prefix: prefix,
+		indexes: map[string]func(domain.GuestPenalty) string{
+			"user": func(penalty domain.GuestPenalty) string { return penalty.UserID },
+		},
+	}}
+}
+
+func (r *RedisPenaltiesRepo) Add(ctx context.Context, penalty domain.GuestPenalty) error {
+	return r.docs.create(ctx, penalty.ID, penalty)
+}
+
+// GetByUser returns the penalties of the user at the restaurant, oldest first.
+func (r *RedisPenaltiesRepo) GetByUser(ctx context.Context, restaurantID, userID string) ([]domain.GuestPenalty, error) {
+	list, err := r.docs.list(ctx, "user", userID)
+	if err != nil {
+		return nil, err
+	}
+	penalties := make([]domain.GuestPenalty, 0, len(list))
+	for _, penalty := range list {
+		if penalty.RestaurantID == restaurantID {
+			penalties = append(penalties, penalty)
+		}
+	}
+	sort.Slice(penalties, func(i, j int) bool { return penalties[i].CreatedAt.Before(penalties[j].CreatedAt) })
+	return penalties, nil
+}
+
+func (r *RedisPenaltiesRepo) DeleteByUser(ctx context.Context, userID string) error {
+	return r.docs.deleteBy(ctx, "user", userID)
+}
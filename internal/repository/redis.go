@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"reservista.kz/internal/domain"
+	"time"
+)
+
+// redisDocuments keeps JSON documents under prefix+"doc:"+id. Every index maps a
+// value computed from a document to the set of ids of the documents with that
+// value, so documents can be listed without scanning keys. Empty values aren't
+// indexed. Index entries are checked against the document when listing, a stale
+// entry left behind by concurrent writers is skipped and removed.
+type redisDocuments[T any] struct {
+	client  redis.UniversalClient
+	prefix  string
+	indexes map[string]func(T) string
+}
+
+func (d *redisDocuments[T]) key(id string) string {
+	return d.prefix + "doc:" + id
+}
+
+func (d *redisDocuments[T]) indexKey(index, value string) string {
+	return d.prefix + "index:" + index + ":" + value
+}
+
+func (d *redisDocuments[T]) get(ctx context.Context, id string) (T, error) {
+	var doc T
+	value, err := d.client.Get(ctx, d.key(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return doc, domain.ErrNotFound
+	}
+	if err != nil {
+		return doc, err
+	}
+	err = json.Unmarshal(value, &doc)
+	return doc, err
+}
+
+// create stores a new document, it fails with domain.ErrAlreadyExists when the id
+// is taken.
+func (d *redisDocuments[T]) create(ctx context.Context, id string, doc T) error {
+	value, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	created, err := d.client.SetNX(ctx, d.key(id), value, 0).Result()
+	if err != nil {
+		return err
+	}
+	if !created {
+		return domain.ErrAlreadyExists
+	}
+	_, err = d.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for index, valueOf := range d.indexes {
+			if v := valueOf(doc); v != "" {
+				pipe.SAdd(ctx, d.indexKey(index, v), id)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// put creates or replaces the document.
+func (d *redisDocuments[T]) put(ctx context.Context, id string, doc T) error {
+	old, err := d.get(ctx, id)
+	exists := err == nil
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return err
+	}
+	value, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	_, err = d.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, d.key(id), value, 0)
+		d.reindex(ctx, pipe, id, old, exists, doc)
+		return nil
+	})
+	return err
+}
+
+// reindex moves the document from the index values of old, if it existed, to the
+// ones of doc.
+func (d *redisDocuments[T]) reindex(ctx context.Context, pipe redis.Pipeliner, id string, old T, exists bool, doc T) {
+	for index, valueOf := range d.indexes {
+		v := valueOf(doc)
+		if exists {
+			if previous := valueOf(old); previous != v && previous != "" {
+				pipe.SRem(ctx, d.indexKey(index, previous), id)
+			}
+		}
+		if v != "" {
+			pipe.SAdd(ctx, d.indexKey(index, v), id)
+		}
+	}
+}
+
+// maxSwapAttempts bounds how often compareAndPut starts over after a concurrent
+// write to the document.
+const maxSwapAttempts = 5
+
+// compareAndPut replaces the stored document with doc only if check accepts the
+// stored one, and reports whether it did. The document is watched while it is
+// checked, a concurrent write makes it check again.
+func (d *redisDocuments[T]) compareAndPut(ctx context.Context, id string, doc T, check func(T) bool) (bool, error) {
+	value, err := json.Marshal(doc)
+	if err != nil {
+		return false, err
+	}
+	for attempt := 0; attempt < maxSwapAttempts; attempt++ {
+		swapped := false
+		err := d.client.Watch(ctx, func(tx *redis.Tx) error {
+			raw, err := tx.Get(ctx, d.key(id)).Bytes()
+			if errors.Is(err, redis.Nil) {
+				return domain.ErrNotFound
+			}
+			if err != nil {
+				return err
+			}
+			var old T
+			if err := json.Unmarshal(raw, &old); err != nil {
+				return err
+			}
+			if !check(old) {
+				return nil
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, d.key(id), value, 0)
+				d.reindex(ctx, pipe, id, old, true, doc)
+				return nil
+			})
+			swapped = err == nil
+			return err
+		}, d.key(id))
+		if !errors.Is(err, redis.TxFailedErr) {
+			return swapped, err
+		}
+	}
+	return false, redis.TxFailedErr
+}
+
+func (d *redisDocuments[T]) delete(ctx context.Context, id string) error {
+	old, err := d.get(ctx, id)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = d.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, d.key(id))
+		for index, valueOf := range d.indexes {
+			if v := valueOf(old); v != "" {
+				pipe.SRem(ctx, d.indexKey(index, v), id)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// deleteBy deletes the documents whose index has the given value.
+func (d *redisDocuments[T]) deleteBy(ctx context.Context, index, value string) error {
+	ids, err := d.client.SMembers(ctx, d.indexKey(index, value)).Result()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := d.delete(ctx, id); err != nil {
+			return err
+		}
+	}
+	return d.client.Del(ctx, d.indexKey(index, value)).Err()
+}
+
+// list returns the documents whose index has the given value.
+func (d *redisDocuments[T]) list(ctx context.Context, index, value string) ([]T, error) {
+	indexKey := d.indexKey(index, value)
+	ids, err := d.client.SMembers(ctx, indexKey).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = d.key(id)
+	}
+	values, err := d.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	var docs []T
+	for i, v := range values {
+		raw, ok := v.(string)
+		var doc T
+		if ok {
+			if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+				return nil, err
+			}
+		}
+		if !ok || d.indexes[index](doc) != value {
+			d.client.SRem(ctx, indexKey, ids[i])
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// addToExpiringSet adds member to the set at key and keeps the set at least ttl
+// longer, for indexes of keys that expire on their own.
+func addToExpiringSet(ctx context.Context, client redis.UniversalClient, key, member string, ttl time.Duration) error {
+	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, key, member)
+		// NX gives a new set its expiry, GT only ever extends it
+		pipe.ExpireNX(ctx, key, ttl)
+		pipe.ExpireGT(ctx, key, ttl)
+		return nil
+	})
+	return err
+}
+
+// NewRedisRepositories keeps the data that has to outlive the gateway process in
+// redis, everything else is kept in memory like with NewRepositories.
+func NewRedisRepositories(client redis.UniversalClient, prefix string, auditMaxEntries int) *Repositories {
+	repos := NewRepositories(auditMaxEntries)
+	repos.Identities = NewRedisIdentitiesRepo(client, prefix+"identities:")
+	repos.APIKeys = NewRedisAPIKeysRepo(client, prefix+"apikeys:")
+	repos.Staff = NewRedisStaffRepo(client, prefix+"staff:")
+	repos.Invites = NewRedisStaffInvitesRepo(client, prefix+"invites:")
+	repos.Audit = NewRedisAuditRepo(client, prefix+"audit:", auditMaxEntries)
+	repos.Impersonations = NewRedisImpersonationsRepo(client, prefix+"impersonations:")
+	repos.Erasures = NewRedisErasuresRepo(client, prefix+"erasures:")
+	repos.Avatars = NewRedisAvatarsRepo(client, prefix+"avatars:")
+	repos.Directory = NewRedisDirectoryRepo(client, prefix+"directory:")
+	repos.Suspensions = NewRedisSuspensionsRepo(client, prefix+"suspensions:")
+	repos.Series = NewRedisSeriesRepo(client, prefix+"series:")
+	repos.Combinations = NewRedisTableCombinationsRepo(client, prefix+"combinations:")
+	repos.Reservations = NewRedisReservationDetailsRepo(client, prefix+"reservations:")
+	repos.Restaurants = NewRedisRestaurantSettingsRepo(client, prefix+"restaurants:")
+	repos.Penalties = NewRedisPenaltiesRepo(client, prefix+"penalties:")
+	repos.Waitlist = NewRedisWaitlistRepo(client, prefix+"waitlist:")
+	return repos
+}
@@ -0,0 +1,639 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"reservista.kz/internal/domain"
+	"testing"
+	"time"
+)
+
+func newTestRedis(t *testing.T) redis.UniversalClient {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestRedisIdentitiesSurviveRestart(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	identity := domain.Identity{Provider: "google", Subject: "sub-1", UserID: "user-1", Email: "guest@example.com"}
+	if err := NewRedisIdentitiesRepo(client, "gateway:identities:").Create(ctx, identity); err != nil {
+		t.Fatal(err)
+	}
+
+	// a new repo over the same redis is the gateway after a restart
+	repo := NewRedisIdentitiesRepo(client, "gateway:identities:")
+	if err := repo.Create(ctx, identity); !errors.Is(err, domain.ErrAlreadyExists) {
+		t.Errorf("Create of a linked identity = %v, want %v", err, domain.ErrAlreadyExists)
+	}
+	got, err := repo.Get(ctx, "google", "sub-1")
+	if err != nil || got.UserID != "user-1" {
+		t.Fatalf("Get = %+v, %v", got, err)
+	}
+	byUser, err := repo.GetByUser(ctx, "user-1")
+	if err != nil || len(byUser) != 1 {
+		t.Fatalf("GetByUser = %+v, %v", byUser, err)
+	}
+
+	if err := repo.DeleteByUser(ctx, "user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Get(ctx, "google", "sub-1"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Get after DeleteByUser = %v, want %v", err, domain.ErrNotFound)
+	}
+	if byUser, _ := repo.GetByUser(ctx, "user-1"); len(byUser) != 0 {
+		t.Errorf("GetByUser after DeleteByUser = %+v", byUser)
+	}
+}
+
+func TestRedisDocumentsReindexOnPut(t *testing.T) {
+	ctx := context.Background()
+	docs := &redisDocuments[domain.Identity]{
+		client: newTestRedis(t),
+		prefix: "test:",
+		indexes: map[string]func(domain.Identity) string{
+			"user": func(identity domain.Identity) string { return identity.UserID },
+		},
+	}
+	if err := docs.put(ctx, "1", domain.Identity{UserID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := docs.put(ctx, "1", domain.Identity{UserID: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := docs.list(ctx, "user", "a"); len(got) != 0 {
+		t.Errorf("list of the old value = %+v, want none", got)
+	}
+	if got, _ := docs.list(ctx, "user", "b"); len(got) != 1 {
+		t.Errorf("list of the new value = %+v, want one", got)
+	}
+}
+
+func TestRedisAPIKeysKeepHashAndRevocation(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRedisAPIKeysRepo(newTestRedis(t), "gateway:apikeys:")
+	key := domain.APIKey{ID: "key-1", RestaurantID: "restaurant-1", Hash: "hash", CreatedAt: time.Now()}
+	if err := repo.Create(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+
+	// a request authenticated before the revocation records its use afterwards
+	used, _ := repo.GetByID(ctx, "key-1")
+	revokedAt := time.Now()
+	key.RevokedAt = &revokedAt
+	if err := repo.Update(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.MarkUsed(ctx, used.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repo.GetByID(ctx, "key-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Hash != "hash" {
+		t.Errorf("Hash = %q, want it kept", got.Hash)
+	}
+	if got.RevokedAt == nil || got.LastUsedAt == nil {
+		t.Errorf("RevokedAt = %v, LastUsedAt = %v, want both set", got.RevokedAt, got.LastUsedAt)
+	}
+	if keys, _ := repo.GetByRestaurant(ctx, "restaurant-1"); len(keys) != 1 {
+		t.Errorf("GetByRestaurant = %+v, want the key", keys)
+	}
+}
+
+func TestRedisStaffMemberships(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRedisStaffRepo(newTestRedis(t), "gateway:staff:")
+	member := domain.StaffMember{RestaurantID: "restaurant-1", UserID: "user-1", Role: domain.WaiterRole}
+	if err := repo.Add(ctx, member); err != nil {
+		t.Fatal(err)
+	}
+	member.Role = domain.RestaurantAdminRole
+	if err := repo.Add(ctx, member); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.Get(ctx, "restaurant-1", "user-1")
+	if err != nil || got.Role != domain.RestaurantAdminRole {
+		t.Fatalf("Get = %+v, %v, want the replaced role", got, err)
+	}
+	if members, _ := repo.GetByUser(ctx, "user-1"); len(members) != 1 {
+		t.Errorf("GetByUser = %+v, want one membership", members)
+	}
+	if err := repo.Remove(ctx, "restaurant-1", "user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Remove(ctx, "restaurant-1", "user-1"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("second Remove = %v, want %v", err, domain.ErrNotFound)
+	}
+	if members, _ := repo.GetByRestaurant(ctx, "restaurant-1"); len(members) != 0 {
+		t.Errorf("GetByRestaurant after Remove = %+v", members)
+	}
+}
+
+func TestRedisStaffInvitesKeepTokenHash(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	invite := domain.StaffInvite{ID: "invite-1", TokenHash: "hash-1", RestaurantID: "restaurant-1", Email: "waiter@example.com"}
+	if err := NewRedisStaffInvitesRepo(client, "gateway:invites:").Create(ctx, invite); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewRedisStaffInvitesRepo(client, "gateway:invites:")
+	got, err := repo.GetByTokenHash(ctx, "hash-1")
+	if err != nil || got.ID != "invite-1" || got.TokenHash != "hash-1" {
+		t.Fatalf("GetByTokenHash = %+v, %v", got, err)
+	}
+	accepted := time.Now()
+	got.AcceptedAt = &accepted
+	if err := repo.Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := repo.GetByTokenHash(ctx, "hash-1"); got.AcceptedAt == nil {
+		t.Errorf("GetByTokenHash after Update = %+v, want it accepted", got)
+	}
+	if err := repo.Update(ctx, domain.StaffInvite{ID: "invite-2"}); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Update of an unknown invite = %v, want %v", err, domain.ErrNotFound)
+	}
+}
+
+func TestRedisAuditKeepsLatestEntries(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	repo := NewRedisAuditRepo(client, "gateway:audit:", 2)
+	now := time.Now().UTC()
+	entries := []domain.AuditEntry{
+		{ID: "entry-1", ActorID: "user-1", IP: "10.0.0.1", Time: now},
+		{ID: "entry-2", ActorID: "user-2", IP: "10.0.0.2", Time: now.Add(time.Second)},
+		{ID: "entry-3", ActorID: "user-1", IP: "10.0.0.1", Time: now.Add(2 * time.Second)},
+	}
+	for _, entry := range entries {
+		if err := repo.Create(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo = NewRedisAuditRepo(client, "gateway:audit:", 2)
+	entries, err := repo.Find(ctx, domain.AuditFilter{})
+	if err != nil || len(entries) != 2 || entries[0].ID != "entry-3" || entries[1].ID != "entry-2" {
+		t.Fatalf("Find = %+v, %v, want entry-3 and entry-2", entries, err)
+	}
+	if err := repo.Anonymize(ctx, "user-1", "erased-1"); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := repo.Find(ctx, domain.AuditFilter{ActorID: "user-1"}); len(entries) != 0 {
+		t.Errorf("Find of the erased user = %+v, want none", entries)
+	}
+	entries, err = repo.Find(ctx, domain.AuditFilter{ActorID: "erased-1"})
+	if err != nil || len(entries) != 1 || entries[0].ID != "entry-3" || entries[0].IP != "" {
+		t.Errorf("Find of the alias = %+v, %v, want entry-3 without its IP", entries, err)
+	}
+	if n, _ := client.Exists(ctx, "gateway:audit:entry:entry-1").Result(); n != 0 {
+		t.Errorf("the dropped entry is still stored")
+	}
+}
+
+func TestRedisImpersonations(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	session := domain.Impersonation{ID: "session-1", ActorID: "admin-1", UserID: "user-1", StartedAt: now, ExpiresAt: now.Add(time.Hour)}
+	if err := NewRedisImpersonationsRepo(client, "gateway:impersonations:").Create(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewRedisImpersonationsRepo(client, "gateway:impersonations:")
+	got, err := repo.Get(ctx, "session-1")
+	if err != nil || !got.Active() {
+		t.Fatalf("Get = %+v, %v, want the active session", got, err)
+	}
+	got.EndedAt = &now
+	if err := repo.Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := repo.GetByUser(ctx, "user-1")
+	if err != nil || len(sessions) != 1 || sessions[0].Active() {
+		t.Errorf("GetByUser = %+v, %v, want the ended session", sessions, err)
+	}
+	sessions, err = repo.GetByActor(ctx, "admin-1")
+	if err != nil || len(sessions) != 1 || sessions[0].ID != "session-1" {
+		t.Errorf("GetByActor = %+v, %v, want session-1", sessions, err)
+	}
+}
+
+func TestRedisErasures(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	repo := NewRedisErasuresRepo(client, "gateway:erasures:")
+	requests := []domain.ErasureRequest{
+		{ID: "e-1", UserID: "user-1", CodeHash: "hash", Status: domain.ErasurePending, ConfirmBy: future},
+		{ID: "e-2", UserID: "user-2", Status: domain.ErasureScheduled, ScheduledFor: &past},
+		{ID: "e-3", UserID: "user-3", Status: domain.ErasureScheduled, ScheduledFor: &future},
+	}
+	for _, request := range requests {
+		if err := repo.Save(ctx, request); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo = NewRedisErasuresRepo(client, "gateway:erasures:")
+	pending, err := repo.GetByUser(ctx, "user-1")
+	if err != nil || pending.CodeHash != "hash" {
+		t.Fatalf("GetByUser = %+v, %v, want the code hash kept", pending, err)
+	}
+	due, err := repo.GetDue(ctx, now)
+	if err != nil || len(due) != 1 || due[0].ID != "e-2" {
+		t.Fatalf("GetDue = %+v, %v, want e-2", due, err)
+	}
+	requests[1].Status = domain.ErasureCompleted
+	if err := repo.Save(ctx, requests[1]); err != nil {
+		t.Fatal(err)
+	}
+	if due, _ := repo.GetDue(ctx, now); len(due) != 0 {
+		t.Errorf("GetDue after completion = %+v", due)
+	}
+
+	for want := 1; want <= 3; want++ {
+		if attempts, err := repo.AddAttempt(ctx, "e-1", future); err != nil || attempts != want {
+			t.Fatalf("AddAttempt = %d, %v, want %d", attempts, err, want)
+		}
+	}
+	if ttl := client.TTL(ctx, "gateway:erasures:attempts:e-1").Val(); ttl <= 0 {
+		t.Errorf("attempts don't expire, ttl = %v", ttl)
+	}
+}
+
+func TestRedisAvatarsKeepKeys(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	avatar := domain.Avatar{
+		UserID:    "user-1",
+		URLs:      map[string]string{"detail": "https://cdn.example/a-512.png", "list": "https://cdn.example/a-96.png"},
+		Keys:      []string{"avatars/a-512.png", "avatars/a-96.png"},
+		UpdatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	if err := NewRedisAvatarsRepo(client, "gateway:avatars:").Save(ctx, avatar); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewRedisAvatarsRepo(client, "gateway:avatars:")
+	got, err := repo.Get(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UserID != avatar.UserID || len(got.Keys) != 2 || got.URLs["list"] != avatar.URLs["list"] || !got.UpdatedAt.Equal(avatar.UpdatedAt) {
+		t.Errorf("Get = %+v, want %+v", got, avatar)
+	}
+	if err := repo.Delete(ctx, "user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(ctx, "user-1"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("second Delete = %v, want %v", err, domain.ErrNotFound)
+	}
+}
+
+func TestRedisDirectory(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	repo := NewRedisDirectoryRepo(client, "gateway:directory:")
+	for _, user := range []domain.DirectoryUser{
+		{ID: "user-3", Name: "Dana"},
+		{ID: "user-2", Name: "Aigerim"},
+		{ID: "user-1", Name: "Arman"},
+		{ID: "user-2", Name: "Aigerim", Roles: []string{domain.AdminRole}, Activated: true},
+	} {
+		if err := repo.Save(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := NewRedisDirectoryRepo(client, "gateway:directory:").Delete(ctx, "user-3"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].ID != "user-1" || got[1].ID != "user-2" || !got[1].Activated || len(got[1].Roles) != 1 {
+		t.Errorf("GetAll = %+v, want user-1 and the updated user-2", got)
+	}
+}
+
+func TestRedisSuspensions(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	repo := NewRedisSuspensionsRepo(client, "gateway:suspensions:")
+	now := time.Now().UTC().Truncate(time.Second)
+	until := now.Add(time.Hour)
+	first := domain.Suspension{ID: "s-1", UserID: "user-1", StartedAt: now, Until: &until, Deactivated: true, AppealTokenHash: "hash-1"}
+	second := domain.Suspension{ID: "s-2", UserID: "user-1", StartedAt: now, AppealTokenHash: "hash-2"}
+	for _, suspension := range []domain.Suspension{first, second} {
+		if err := repo.Save(ctx, suspension); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// saving an older suspension again doesn't make it the latest
+	first.Appeal = &domain.Appeal{Status: domain.AppealPending, SubmittedAt: now}
+	if err := repo.Save(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+
+	repo = NewRedisSuspensionsRepo(client, "gateway:suspensions:")
+	latest, err := repo.GetByUser(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.ID != "s-2" || latest.AppealTokenHash != "hash-2" {
+		t.Errorf("GetByUser = %+v, want s-2 with its token hash", latest)
+	}
+	byToken, err := repo.GetByAppealTokenHash(ctx, "hash-1")
+	if err != nil || byToken.ID != "s-1" {
+		t.Errorf("GetByAppealTokenHash = %+v, %v, want s-1", byToken, err)
+	}
+	appeals, err := repo.GetPendingAppeals(ctx)
+	if err != nil || len(appeals) != 1 || appeals[0].ID != "s-1" {
+		t.Errorf("GetPendingAppeals = %+v, %v, want s-1", appeals, err)
+	}
+
+	if ended, err := repo.GetAwaitingRestore(ctx, now); err != nil || len(ended) != 0 {
+		t.Errorf("GetAwaitingRestore before the end = %+v, %v, want none", ended, err)
+	}
+	ended, err := repo.GetAwaitingRestore(ctx, until)
+	if err != nil || len(ended) != 1 || ended[0].ID != "s-1" {
+		t.Fatalf("GetAwaitingRestore after the end = %+v, %v, want s-1", ended, err)
+	}
+	ended[0].RestoredAt = &until
+	if err := repo.Save(ctx, ended[0]); err != nil {
+		t.Fatal(err)
+	}
+	if ended, err := repo.GetAwaitingRestore(ctx, until); err != nil || len(ended) != 0 {
+		t.Errorf("GetAwaitingRestore after restoring = %+v, %v, want none", ended, err)
+	}
+}
+
+func TestRedisSeries(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	older := domain.ReservationSeries{ID: "series-1", UserID: "user-1", Status: domain.SeriesActive, CreatedAt: now.Add(-time.Hour),
+		Occurrences: []domain.SeriesOccurrence{{Start: now, Status: domain.OccurrenceBooked, ReservationID: "r-1"}}}
+	newer := domain.ReservationSeries{ID: "series-2", UserID: "user-1", Status: domain.SeriesActive, CreatedAt: now}
+	other := domain.ReservationSeries{ID: "series-3", UserID: "user-2", CreatedAt: now}
+	repo := NewRedisSeriesRepo(client, "gateway:series:")
+	for _, series := range []domain.ReservationSeries{newer, older, other} {
+		if err := repo.Save(ctx, series); err != nil {
+			t.Fatal(err)
+		}
+	}
+	older.Occurrences[0].Status = domain.OccurrenceSkipped
+	if err := repo.Save(ctx, older); err != nil {
+		t.Fatal(err)
+	}
+
+	repo = NewRedisSeriesRepo(client, "gateway:series:")
+	got, err := repo.Get(ctx, "series-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Occurrences) != 1 || got.Occurrences[0].Status != domain.OccurrenceSkipped || !got.Occurrences[0].Start.Equal(now) {
+		t.Errorf("Get = %+v, want the skipped occurrence", got)
+	}
+	list, err := repo.GetByUser(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != "series-1" || list[1].ID != "series-2" {
+		t.Errorf("GetByUser = %+v, want series-1 and series-2, oldest first", list)
+	}
+}
+
+func TestRedisTableCombinations(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	older := domain.TableCombination{ID: "combination-1", RestaurantID: "restaurant-1", TableIDs: []string{"t-1", "t-2"}, CreatedAt: now.Add(-time.Hour)}
+	newer := domain.TableCombination{ID: "combination-2", RestaurantID: "restaurant-1", TableIDs: []string{"t-2", "t-3"}, CreatedAt: now}
+	repo := NewRedisTableCombinationsRepo(client, "gateway:combinations:")
+	for _, combination := range []domain.TableCombination{newer, older} {
+		if err := repo.Save(ctx, combination); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo = NewRedisTableCombinationsRepo(client, "gateway:combinations:")
+	list, err := repo.GetByRestaurant(ctx, "restaurant-1")
+	if err != nil || len(list) != 2 || list[0].ID != "combination-1" || len(list[0].TableIDs) != 2 {
+		t.Fatalf("GetByRestaurant = %+v, %v, want both, oldest first", list, err)
+	}
+	if err := repo.Delete(ctx, "combination-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(ctx, "combination-1"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Delete of a deleted combination = %v, want %v", err, domain.ErrNotFound)
+	}
+	if list, _ := repo.GetByRestaurant(ctx, "restaurant-1"); len(list) != 1 {
+		t.Errorf("GetByRestaurant after Delete = %+v, want one", list)
+	}
+}
+
+func TestRedisReservationDetails(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	first := domain.ReservationDetails{ReservationID: "r-1", UserID: "user-1", PartySize: 6, GroupID: "group-1", Status: domain.ReservationPending, CreatedAt: now}
+	second := domain.ReservationDetails{ReservationID: "r-2", UserID: "user-1", PartySize: 6, GroupID: "group-1", Status: domain.ReservationPending, CreatedAt: now.Add(time.Second)}
+	single := domain.ReservationDetails{ReservationID: "r-3", UserID: "user-2", PartySize: 2, Status: domain.ReservationPending, CreatedAt: now}
+	repo := NewRedisReservationDetailsRepo(client, "gateway:reservations:")
+	for _, details := range []domain.ReservationDetails{second, first, single} {
+		if err := repo.Save(ctx, details); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first.Status = domain.ReservationConfirmed
+	first.History = []domain.ReservationEvent{{Action: "confirm", From: domain.ReservationPending, To: domain.ReservationConfirmed, At: now}}
+	if err := repo.Save(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+
+	repo = NewRedisReservationDetailsRepo(client, "gateway:reservations:")
+	got, err := repo.Get(ctx, "r-1")
+	if err != nil || got.Status != domain.ReservationConfirmed || len(got.History) != 1 || got.PartySize != 6 {
+		t.Fatalf("Get = %+v, %v, want the confirmed reservation with its history", got, err)
+	}
+	group, err := repo.GetByGroup(ctx, "group-1")
+	if err != nil || len(group) != 2 || group[0].ReservationID != "r-1" || group[1].ReservationID != "r-2" {
+		t.Errorf("GetByGroup = %+v, %v, want r-1 and r-2 in the order of booking", group, err)
+	}
+	if err := repo.Delete(ctx, "r-2"); err != nil {
+		t.Fatal(err)
+	}
+	if group, _ := repo.GetByGroup(ctx, "group-1"); len(group) != 1 {
+		t.Errorf("GetByGroup after Delete = %+v, want r-1", group)
+	}
+	if _, err := repo.Get(ctx, "r-2"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Get after Delete = %v, want %v", err, domain.ErrNotFound)
+	}
+	if err := repo.DeleteByUser(ctx, "user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Get(ctx, "r-1"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Get after DeleteByUser = %v, want %v", err, domain.ErrNotFound)
+	}
+	if _, err := repo.Get(ctx, "r-3"); err != nil {
+		t.Errorf("Get of another guest after DeleteByUser = %v", err)
+	}
+}
+
+func TestRedisRestaurantSettings(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	settings := domain.RestaurantSettings{RestaurantID: "restaurant-1", Timezone: "Asia/Almaty", MinOccupancy: 50,
+		Cancellation: domain.CancellationPolicy{FreeCancelMinutes: 120, CutoffMinutes: 30, MaxPenalties: 3}}
+	if err := NewRedisRestaurantSettingsRepo(client, "gateway:restaurants:").Save(ctx, settings); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewRedisRestaurantSettingsRepo(client, "gateway:restaurants:")
+	got, err := repo.Get(ctx, "restaurant-1")
+	if err != nil || got.Timezone != "Asia/Almaty" || got.Cancellation != settings.Cancellation {
+		t.Errorf("Get = %+v, %v, want %+v", got, err, settings)
+	}
+	if _, err := repo.Get(ctx, "restaurant-2"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Get of unknown restaurant = %v, want %v", err, domain.ErrNotFound)
+	}
+}
+
+func TestRedisPenalties(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	repo := NewRedisPenaltiesRepo(client, "gateway:penalties:")
+	for _, penalty := range []domain.GuestPenalty{
+		{ID: "p-2", UserID: "user-1", RestaurantID: "restaurant-1", Kind: domain.PenaltyNoShow, CreatedAt: now},
+		{ID: "p-1", UserID: "user-1", RestaurantID: "restaurant-1", Kind: domain.PenaltyNoShow, CreatedAt: now.Add(-time.Hour)},
+		{ID: "p-3", UserID: "user-1", RestaurantID: "restaurant-2", Kind: domain.PenaltyNoShow, CreatedAt: now},
+		{ID: "p-4", UserID: "user-2", RestaurantID: "restaurant-1", Kind: domain.PenaltyNoShow, CreatedAt: now},
+	} {
+		if err := repo.Add(ctx, penalty); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo = NewRedisPenaltiesRepo(client, "gateway:penalties:")
+	list, err := repo.GetByUser(ctx, "restaurant-1", "user-1")
+	if err != nil || len(list) != 2 || list[0].ID != "p-1" || list[1].ID != "p-2" {
+		t.Errorf("GetByUser = %+v, %v, want p-1 and p-2, oldest first", list, err)
+	}
+	if err := repo.DeleteByUser(ctx, "user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := repo.GetByUser(ctx, "restaurant-2", "user-1"); len(list) != 0 {
+		t.Errorf("GetByUser after DeleteByUser = %+v, want none", list)
+	}
+	if list, _ := repo.GetByUser(ctx, "restaurant-1", "user-2"); len(list) != 1 {
+		t.Errorf("GetByUser of another guest = %+v, want p-4", list)
+	}
+}
+
+func TestRedisWaitlist(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	first := domain.WaitlistEntry{ID: "w-1", UserID: "user-1", RestaurantID: "restaurant-1", PartySize: 2, From: now, To: now.Add(time.Hour),
+		Status: domain.WaitlistWaiting, CreatedAt: now.Add(-time.Minute)}
+	second := domain.WaitlistEntry{ID: "w-2", UserID: "user-2", RestaurantID: "restaurant-1", PartySize: 4, From: now, To: now.Add(time.Hour),
+		Status: domain.WaitlistWaiting, CreatedAt: now}
+	repo := NewRedisWaitlistRepo(client, "gateway:waitlist:")
+	for _, entry := range []domain.WaitlistEntry{second, first} {
+		if err := repo.Save(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	offered := first
+	offered.Status = domain.WaitlistOffered
+	offered.Offer = &domain.WaitlistOffer{TableID: "table-1", Start: now, TokenHash: "hash-1", ExpiresAt: now.Add(15 * time.Minute)}
+	if saved, err := repo.CompareAndSave(ctx, offered, domain.WaitlistWaiting); err != nil || !saved {
+		t.Fatalf("CompareAndSave of a waiting entry = %v, %v, want true", saved, err)
+	}
+	claimed := offered
+	claimed.Status = domain.WaitlistClaimed
+	if saved, err := repo.CompareAndSave(ctx, claimed, domain.WaitlistWaiting); err != nil || saved {
+		t.Errorf("CompareAndSave of an entry no longer waiting = %v, %v, want false", saved, err)
+	}
+	if _, err := repo.CompareAndSave(ctx, domain.WaitlistEntry{ID: "w-3"}, domain.WaitlistWaiting); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("CompareAndSave of an unknown entry = %v, want %v", err, domain.ErrNotFound)
+	}
+
+	repo = NewRedisWaitlistRepo(client, "gateway:waitlist:")
+	got, err := repo.GetByOfferTokenHash(ctx, "hash-1")
+	if err != nil || got.ID != "w-1" || got.Offer == nil || got.Offer.TokenHash != "hash-1" || got.Offer.TableID != "table-1" {
+		t.Fatalf("GetByOfferTokenHash = %+v, %v, want the offer of w-1", got, err)
+	}
+	list, err := repo.GetByRestaurant(ctx, "restaurant-1")
+	if err != nil || len(list) != 2 || list[0].ID != "w-1" || list[1].ID != "w-2" {
+		t.Errorf("GetByRestaurant = %+v, %v, want w-1 and w-2 in the order they joined", list, err)
+	}
+	if list, _ := repo.GetByStatus(ctx, domain.WaitlistWaiting); len(list) != 1 || list[0].ID != "w-2" {
+		t.Errorf("GetByStatus(waiting) = %+v, want w-2", list)
+	}
+	if list, _ := repo.GetByUser(ctx, "user-1"); len(list) != 1 || list[0].Status != domain.WaitlistOffered {
+		t.Errorf("GetByUser = %+v, want the offered w-1", list)
+	}
+}
+
+func TestRedisRemindersDeleteByUser(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	repo := NewRedisRemindersRepo(client, "gateway:reminders:")
+	for _, job := range []domain.ReminderJob{
+		{ID: "r-1|24h", ReservationID: "r-1", UserID: "user-1", Start: start, SendAt: start.Add(-24 * time.Hour), Status: domain.ReminderPending},
+		{ID: "r-2|24h", ReservationID: "r-2", UserID: "user-2", Start: start, SendAt: start.Add(-24 * time.Hour), Status: domain.ReminderPending},
+	} {
+		if err := repo.Schedule(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.AddToken(ctx, "r-1|24h", "hash-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.DeleteByUser(ctx, "user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetByTokenHash(ctx, "hash-1"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("GetByTokenHash after DeleteByUser = %v, want %v", err, domain.ErrNotFound)
+	}
+	due, err := repo.Due(ctx, start, time.Minute, 10)
+	if err != nil || len(due) != 1 || due[0].ID != "r-2|24h" {
+		t.Errorf("Due = %+v, %v, want only the job of the other user", due, err)
+	}
+}
+
+func TestRedisIdempotencyDeleteByUser(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	repo := NewRedisIdempotencyRepo(client, "gateway:idempotency:")
+	request := domain.IdempotentRequest{Fingerprint: "f", Completed: true, Status: 201}
+	for _, key := range []string{"user-1|a", "user-1|b", "user-2|a"} {
+		if err := repo.Complete(ctx, key, request, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := repo.DeleteByUser(ctx, "user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, claimed, err := repo.Begin(ctx, "user-1|a", domain.IdempotentRequest{Fingerprint: "g"}, time.Minute); err != nil || !claimed {
+		t.Errorf("Begin after DeleteByUser = %v, %v, want the key free again", claimed, err)
+	}
+	if stored, claimed, err := repo.Begin(ctx, "user-2|a", domain.IdempotentRequest{Fingerprint: "g"}, time.Minute); err != nil || claimed || stored.Status != 201 {
+		t.Errorf("Begin of another user = %+v, %v, %v, want the stored response", stored, claimed, err)
+	}
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"reservista.kz/internal/domain"
+	"sort"
+	"sync"
+	"time"
+)
+
+// reminderRetention is how long jobs are kept after their reservation started,
+// so that scheduling the same reminder again doesn't send it twice.
+const reminderRetention = 24 * time.Hour
+
+type RemindersRepo struct {
+	mu     sync.Mutex
+	jobs   map[string]domain.ReminderJob
+	tokens map[string]string
+}
+
+func NewRemindersRepo() *RemindersRepo {
+	return &RemindersRepo{jobs: make(map[string]domain.ReminderJob), tokens: make(map[string]string)}
+}
+
+func (r *RemindersRepo) Schedule(_ context.Context, job domain.ReminderJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.jobs[job.ID]
+	if ok && existing.SendAt.Equal(job.SendAt) {
+		return nil
+	}
+	// links mailed for the old time still lead to the reservation
+	job.TokenHashes = existing.TokenHashes
+	r.jobs[job.ID] = job
+	return nil
+}
+
+func (r *RemindersRepo) Due(_ context.Context, now time.Time, lease time.Duration, limit int) ([]domain.ReminderJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var due []domain.ReminderJob
+	for id, job := range r.jobs {
+		if now.After(job.Start.Add(reminderRetention)) {
+			r.delete(id)
+			continue
+		}
+		if job.Status == domain.ReminderPending && !job.SendAt.After(now) && !job.LeaseUntil.After(now) {
+			due = append(due, job)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].SendAt.Before(due[j].SendAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	for i := range due {
+		due[i].Attempts++
+		due[i].LeaseUntil = now.Add(lease)
+		r.jobs[due[i].ID] = due[i]
+	}
+	return due, nil
+}
+
+func (r *RemindersRepo) AddToken(_ context.Context, id, tokenHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	job.TokenHashes = append(append([]string(nil), job.TokenHashes...), tokenHash)
+	r.jobs[id] = job
+	r.tokens[tokenHash] = id
+	return nil
+}
+
+func (r *RemindersRepo) Finish(_ context.Context, id, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	job.Status = status
+	r.jobs[id] = job
+	return nil
+}
+
+func (r *RemindersRepo) GetByTokenHash(_ context.Context, tokenHash string) (domain.ReminderJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[r.tokens[tokenHash]]
+	if !ok {
+		return domain.ReminderJob{}, domain.ErrNotFound
+	}
+	return job, nil
+}
+
+func (r *RemindersRepo) DeleteByUser(_ context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, job := range r.jobs {
+		if job.UserID == userID {
+			r.delete(id)
+		}
+	}
+	return nil
+}
+
+func (r *RemindersRepo) delete(id string) {
+	for _, tokenHash := range r.jobs[id].TokenHashes {
+		delete(r.tokens, tokenHash)
+	}
+	delete(r.jobs, id)
+}
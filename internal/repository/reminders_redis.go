@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"reservista.kz/internal/domain"
+	"strconv"
+	"time"
+)
+
+// RedisRemindersRepo keeps reminder jobs across restarts and shares them between
+// gateway instances. Pending jobs are indexed by SendAt in a sorted set, and a
+// job is claimed with a lease key, so only one instance sends it at a time.
+// prefix+"user:"+userID holds the jobs of a user, for DeleteByUser.
+type RedisRemindersRepo struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+func NewRedisRemindersRepo(client redis.UniversalClient, prefix string) *RedisRemindersRepo {
+	return &RedisRemindersRepo{client: client, prefix: prefix}
+}
+
+func (r *RedisRemindersRepo) Schedule(ctx context.Context, job domain.ReminderJob) error {
+	existing, err := r.get(ctx, job.ID)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return err
+	}
+	if err == nil && existing.SendAt.Equal(job.SendAt) {
+		return nil
+	}
+	// links mailed for the old time still lead to the reservation
+	job.TokenHashes = existing.TokenHashes
+	if err := r.save(ctx, job); err != nil {
+		return err
+	}
+	return r.client.ZAdd(ctx, r.prefix+"due", redis.Z{Score: float64(job.SendAt.Unix()), Member: job.ID}).Err()
+}
+
+func (r *RedisRemindersRepo) Due(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]domain.ReminderJob, error) {
+	ids, err := r.client.ZRangeByScore(ctx, r.prefix+"due", &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.Unix(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	var due []domain.ReminderJob
+	for _, id := range ids {
+		claimed, err := r.client.SetNX(ctx, r.prefix+"lease:"+id, now.Unix(), lease).Result()
+		if err != nil {
+			return due, err
+		}
+		if !claimed {
+			continue
+		}
+		job, err := r.get(ctx, id)
+		if errors.Is(err, domain.ErrNotFound) || (err == nil && job.Status != domain.ReminderPending) {
+			r.client.ZRem(ctx, r.prefix+"due", id)
+			continue
+		}
+		if err != nil {
+			return due, err
+		}
+		job.Attempts++
+		job.LeaseUntil = now.Add(lease)
+		if err := r.save(ctx, job); err != nil {
+			return due, err
+		}
+		due = append(due, job)
+	}
+	return due, nil
+}
+
+func (r *RedisRemindersRepo) AddToken(ctx context.Context, id, tokenHash string) error {
+	job, err := r.get(ctx, id)
+	if err != nil {
+		return err
+	}
+	job.TokenHashes = append(job.TokenHashes, tokenHash)
+	if err := r.client.Set(ctx, r.prefix+"token:"+tokenHash, id, r.ttl(job)).Err(); err != nil {
+		return err
+	}
+	return r.save(ctx, job)
+}
+
+func (r *RedisRemindersRepo) Finish(ctx context.Context, id, status string) error {
+	job, err := r.get(ctx, id)
+	if err != nil {
+		return err
+	}
+	job.Status = status
+	if err := r.save(ctx, job); err != nil {
+		return err
+	}
+	return r.client.ZRem(ctx, r.prefix+"due", id).Err()
+}
+
+func (r *RedisRemindersRepo) GetByTokenHash(ctx context.Context, tokenHash string) (domain.ReminderJob, error) {
+	id, err := r.client.Get(ctx, r.prefix+"token:"+tokenHash).Result()
+	if errors.Is(err, redis.Nil) {
+		return domain.ReminderJob{}, domain.ErrNotFound
+	}
+	if err != nil {
+		return domain.ReminderJob{}, err
+	}
+	return r.get(ctx, id)
+}
+
+func (r *RedisRemindersRepo) DeleteByUser(ctx context.Context, userID string) error {
+	ids, err := r.client.SMembers(ctx, r.prefix+"user:"+userID).Result()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		job, err := r.get(ctx, id)
+		if err != nil && !errors.Is(err, domain.ErrNotFound) {
+			return err
+		}
+		keys := []string{r.prefix + "job:" + id, r.prefix + "lease:" + id}
+		for _, tokenHash := range job.TokenHashes {
+			keys = append(keys, r.prefix+"token:"+tokenHash)
+		}
+		if err := r.client.Del(ctx, keys...).Err(); err != nil {
+			return err
+		}
+		if err := r.client.ZRem(ctx, r.prefix+"due", id).Err(); err != nil {
+			return err
+		}
+	}
+	return r.client.Del(ctx, r.prefix+"user:"+userID).Err()
+}
+
+func (r *RedisRemindersRepo) get(ctx context.Context, id string) (domain.ReminderJob, error) {
+	stored, err := r.client.Get(ctx, r.prefix+"job:"+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return domain.ReminderJob{}, domain.ErrNotFound
+	}
+	if err != nil {
+		return domain.ReminderJob{}, err
+	}
+	var job domain.ReminderJob
+	err = json.Unmarshal(stored, &job)
+	return job, err
+}
+
+func (r *RedisRemindersRepo) save(ctx context.Context, job domain.ReminderJob) error {
+	value, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	if err := r.client.Set(ctx, r.prefix+"job:"+job.ID, value, r.ttl(job)).Err(); err != nil {
+		return err
+	}
+	return addToExpiringSet(ctx, r.client, r.prefix+"user:"+job.UserID, job.ID, r.ttl(job))
+}
+
+// ttl keeps a job until reminderRetention after its reservation started.
+func (r *RedisRemindersRepo) ttl(job domain.ReminderJob) time.Duration {
+	if ttl := time.Until(job.Start.Add(reminderRetention)); ttl > time.Second {
+		return ttl
+	}
+	return time.Second
+}
@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"reservista.kz/internal/domain"
+	"time"
+)
+
+// Identities stores links between external OIDC accounts and users.
+type Identities interface {
+	Create(ctx context.Context, identity domain.Identity) error
+	Get(ctx context.Context, provider, subject string) (domain.Identity, error)
+	GetByUser(ctx context.Context, userID string) ([]domain.Identity, error)
+	DeleteByUser(ctx context.Context, userID string) error
+}
+
+// OIDCStates keeps the state of authorization requests in flight.
+// Pop returns the state only once.
+type OIDCStates interface {
+	Save(ctx context.Context, state domain.OIDCState) error
+	Pop(ctx context.Context, state string) (domain.OIDCState, error)
+	// GetByLinkUser returns the unexpired states of links the user started.
+	GetByLinkUser(ctx context.Context, userID string) ([]domain.OIDCState, error)
+}
+
+// APIKeys stores partner API keys, the secrets themselves are kept hashed.
+// MarkUsed records the last use of a key without touching the rest of it.
+type APIKeys interface {
+	Create(ctx context.Context, key domain.APIKey) error
+	GetByID(ctx context.Context, id string) (domain.APIKey, error)
+	GetByRestaurant(ctx context.Context, restaurantID string) ([]domain.APIKey, error)
+	MarkUsed(ctx context.Context, id string, at time.Time) error
+	Update(ctx context.Context, key domain.APIKey) error
+	// DeleteByUser drops the keys the user created.
+	DeleteByUser(ctx context.Context, userID string) error
+}
+
+// Staff stores which users work at which restaurant and in what role.
+type Staff interface {
+	Add(ctx context.Context, member domain.StaffMember) error
+	Get(ctx context.Context, restaurantID, userID string) (domain.StaffMember, error)
+	GetByRestaurant(ctx context.Context, restaurantID string) ([]domain.StaffMember, error)
+	GetByUser(ctx context.Context, userID string) ([]domain.StaffMember, error)
+	Remove(ctx context.Context, restaurantID, userID string) error
+}
+
+// StaffInvites stores pending and accepted staff invites.
+type StaffInvites interface {
+	Create(ctx context.Context, invite domain.StaffInvite) error
+	GetByTokenHash(ctx context.Context, tokenHash string) (domain.StaffInvite, error)
+	Update(ctx context.Context, invite domain.StaffInvite) error
+	// DeleteByUser drops the invites the user sent.
+	DeleteByUser(ctx context.Context, userID string) error
+}
+
+// Impersonations stores impersonation sessions so they can be ended early.
+type Impersonations interface {
+	Create(ctx context.Context, session domain.Impersonation) error
+	Get(ctx context.Context, id string) (domain.Impersonation, error)
+	GetByUser(ctx context.Context, userID string) ([]domain.Impersonation, error)
+	GetByActor(ctx context.Context, actorID string) ([]domain.Impersonation, error)
+	Update(ctx context.Context, session domain.Impersonation) error
+}
+
+// Avatars stores the profile pictures of users.
+type Avatars interface {
+	Save(ctx context.Context, avatar domain.Avatar) error
+	Get(ctx context.Context, userID string) (domain.Avatar, error)
+	Delete(ctx context.Context, userID string) error
+}
+
+// Directory stores the profiles of the users listed in the admin user directory.
+type Directory interface {
+	Save(ctx context.Context, user domain.DirectoryUser) error
+	GetAll(ctx context.Context) ([]domain.DirectoryUser, error)
+	Delete(ctx context.Context, userID string) error
+}
+
+// Suspensions stores suspensions and bans along with their appeals.
+type Suspensions interface {
+	Save(ctx context.Context, suspension domain.Suspension) error
+	GetByUser(ctx context.Context, userID string) (domain.Suspension, error)
+	GetByAppealTokenHash(ctx context.Context, tokenHash string) (domain.Suspension, error)
+	GetPendingAppeals(ctx context.Context) ([]domain.Suspension, error)
+	GetAwaitingRestore(ctx context.Context, now time.Time) ([]domain.Suspension, error)
+	DeleteByUser(ctx context.Context, userID string) error
+}
+
+// RestaurantSettings stores the gateway's settings of restaurants.
+type RestaurantSettings interface {
+	Save(ctx context.Context, settings domain.RestaurantSettings) error
+	Get(ctx context.Context, restaurantID string) (domain.RestaurantSettings, error)
+}
+
+// Reservations stores the gateway's details of reservations.
+type Reservations interface {
+	Save(ctx context.Context, details domain.ReservationDetails) error
+	Get(ctx context.Context, reservationID string) (domain.ReservationDetails, error)
+	GetByGroup(ctx context.Context, groupID string) ([]domain.ReservationDetails, error)
+	Delete(ctx context.Context, reservationID string) error
+	DeleteByUser(ctx context.Context, userID string) error
+}
+
+// Penalties stores the late cancellations and no-shows of guests.
+type Penalties interface {
+	Add(ctx context.Context, penalty domain.GuestPenalty) error
+	GetByUser(ctx context.Context, restaurantID, userID string) ([]domain.GuestPenalty, error)
+	DeleteByUser(ctx context.Context, userID string) error
+}
+
+// Reminders stores the reminder jobs of reservations. Due claims the jobs that
+// are due and not leased, Schedule keeps a job that was already sent for the
+// same time, so a reminder goes out once per offset.
+type Reminders interface {
+	Schedule(ctx context.Context, job domain.ReminderJob) error
+	Due(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]domain.ReminderJob, error)
+	AddToken(ctx context.Context, id, tokenHash string) error
+	Finish(ctx context.Context, id, status string) error
+	GetByTokenHash(ctx context.Context, tokenHash string) (domain.ReminderJob, error)
+	// DeleteByUser drops the jobs of the user along with their links.
+	DeleteByUser(ctx context.Context, userID string) error
+}
+
+// Series stores recurring reservations.
+type Series interface {
+	Save(ctx context.Context, series domain.ReservationSeries) error
+	Get(ctx context.Context, id string) (domain.ReservationSeries, error)
+	GetByUser(ctx context.Context, userID string) ([]domain.ReservationSeries, error)
+	DeleteByUser(ctx context.Context, userID string) error
+}
+
+// Waitlist stores the guests waiting for a table.
+type Waitlist interface {
+	Save(ctx context.Context, entry domain.WaitlistEntry) error
+	CompareAndSave(ctx context.Context, entry domain.WaitlistEntry, status string) (bool, error)
+	Get(ctx context.Context, id string) (domain.WaitlistEntry, error)
+	GetByRestaurant(ctx context.Context, restaurantID string) ([]domain.WaitlistEntry, error)
+	GetByUser(ctx context.Context, userID string) ([]domain.WaitlistEntry, error)
+	GetByStatus(ctx context.Context, status string) ([]domain.WaitlistEntry, error)
+	GetByOfferTokenHash(ctx context.Context, tokenHash string) (domain.WaitlistEntry, error)
+	DeleteByUser(ctx context.Context, userID string) error
+}
+
+// Idempotency keeps the requests made with an idempotency key. Begin claims a free
+// key for the request and reports true, or returns the request that holds it.
+// Complete stores the response of the request, Release frees the key again.
+// Keys are the id of the caller and the key it sent, joined by "|", so
+// DeleteByUser can drop the responses stored for a user.
+type Idempotency interface {
+	Begin(ctx context.Context, key string, request domain.IdempotentRequest, ttl time.Duration) (domain.IdempotentRequest, bool, error)
+	Complete(ctx context.Context, key string, request domain.IdempotentRequest, ttl time.Duration) error
+	Release(ctx context.Context, key string) error
+	DeleteByUser(ctx context.Context, userID string) error
+}
+
+// TableCombinations stores the combinable table groups of restaurants.
+type TableCombinations interface {
+	Save(ctx context.Context, combination domain.TableCombination) error
+	Get(ctx context.Context, id string) (domain.TableCombination, error)
+	GetByRestaurant(ctx context.Context, restaurantID string) ([]domain.TableCombination, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// Erasures stores the latest erasure request of every user.
+type Erasures interface {
+	Save(ctx context.Context, request domain.ErasureRequest) error
+	GetByUser(ctx context.Context, userID string) (domain.ErasureRequest, error)
+	GetDue(ctx context.Context, now time.Time) ([]domain.ErasureRequest, error)
+	// AddAttempt counts a confirmation attempt of the request and returns the
+	// attempts so far. The count is dropped after expiresAt.
+	AddAttempt(ctx context.Context, requestID string, expiresAt time.Time) (int, error)
+}
+
+// AuditLog stores audit entries for querying.
+type AuditLog interface {
+	Create(ctx context.Context, entry domain.AuditEntry) error
+	Find(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditEntry, error)
+	// Anonymize replaces the id of an erased user in every entry, see
+	// domain.AuditEntry.Anonymize.
+	Anonymize(ctx context.Context, userID, alias string) error
+}
+
+// Repositories holds the data the gateway owns itself, i.e. everything
+// that isn't served by one of the microservices.
+type Repositories struct {
+	Identities     Identities
+	OIDCStates     OIDCStates
+	APIKeys        APIKeys
+	Staff          Staff
+	Invites        StaffInvites
+	Audit          AuditLog
+	Impersonations Impersonations
+	Erasures       Erasures
+	Avatars        Avatars
+	Directory      Directory
+	Suspensions    Suspensions
+	Restaurants    RestaurantSettings
+	Reservations   Reservations
+	Combinations   TableCombinations
+	Idempotency    Idempotency
+	Penalties      Penalties
+	Waitlist       Waitlist
+	Series         Series
+	Reminders      Reminders
+}
+
+func NewRepositories(auditMaxEntries int) *Repositories {
+	return &Repositories{
+		Identities:     NewIdentitiesRepo(),
+		OIDCStates:     NewOIDCStatesRepo(),
+		APIKeys:        NewAPIKeysRepo(),
+		Staff:          NewStaffRepo(),
+		Invites:        NewStaffInvitesRepo(),
+		Audit:          NewAuditRepo(auditMaxEntries),
+		Impersonations: NewImpersonationsRepo(),
+		Erasures:       NewErasuresRepo(),
+		Avatars:        NewAvatarsRepo(),
+		Directory:      NewDirectoryRepo(),
+		Suspensions:    NewSuspensionsRepo(),
+		Restaurants:    NewRestaurantSettingsRepo(),
+		Reservations:   NewReservationDetailsRepo(),
+		Combinations:   NewTableCombinationsRepo(),
+		Idempotency:    NewIdempotencyRepo(),
+		Penalties:      NewPenaltiesRepo(),
+		Waitlist:       NewWaitlistRepo(),
+		Series:         NewSeriesRepo(),
+		Reminders:      NewRemindersRepo(),
+	}
+}
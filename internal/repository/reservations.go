@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"reservista.kz/internal/domain"
+	"sort"
+	"sync"
+)
+
+type ReservationDetailsRepo struct {
+	mu      sync.RWMutex
+	details map[string]domain.ReservationDetails
+}
+
+func NewReservationDetailsRepo() *ReservationDetailsRepo {
+	return &ReservationDetailsRepo{details: make(map[string]domain.ReservationDetails)}
+}
+
+func (r *ReservationDetailsRepo) Save(_ context.Context, details domain.ReservationDetails) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.details[details.ReservationID] = details
+	return nil
+}
+
+func (r *ReservationDetailsRepo) Get(_ context.Context, reservationID string) (domain.ReservationDetails, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	details, ok := r.details[reservationID]
+	if !ok {
+		return domain.ReservationDetails{}, domain.ErrNotFound
+	}
+	return details, nil
+}
+
+// GetByGroup returns the reservations booked together, in the order of booking.
+func (r *ReservationDetailsRepo) GetByGroup(_ context.Context, groupID string) ([]domain.ReservationDetails, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	group := make([]domain.ReservationDetails, 0)
+	for _, details := range r.details {
+		if details.GroupID == groupID {
+			group = append(group, details)
+		}
+	}
+	sort.Slice(group, func(i, j int) bool { return group[i].CreatedAt.Before(group[j].CreatedAt) })
+	return group, nil
+}
+
+func (r *ReservationDetailsRepo) Delete(_ context.Context, reservationID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.details, reservationID)
+	return nil
+}
+
+func (r *ReservationDetailsRepo) DeleteByUser(_ context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, details := range r.details {
+		if details.UserID == userID {
+			delete(r.details, id)
+		}
+	}
+	return nil
+}
+
+// RedisReservationDetailsRepo keeps the details of reservations in redis. The
+// reservation service only knows the booking itself, so this is the only record
+// of the status, history and party size of a reservation.
+type RedisReservationDetailsRepo struct {
+	docs *redisDocuments[domain.ReservationDetails]
+}
+
+func NewRedisReservationDetailsRepo(client redis.UniversalClient, prefix string) *RedisReservationDetailsRepo {
+	return &RedisReservationDetailsRepo{docs: &redisDocuments[domain.ReservationDetails]{
+		client: client,
+		prefix: prefix,
+		indexes: map[string]func(domain.ReservationDetails) string{
+			"group": func(details domain.ReservationDetails) string { return details.GroupID },
+			"user":  func(details domain.ReservationDetails) string { return details.UserID },
+		},
+	}}
+}
+
+func (r *RedisReservationDetailsRepo) Save(ctx context.Context, details domain.ReservationDetails) error {
+	return r.docs.put(ctx, details.ReservationID, details)
+}
+
+func (r *RedisReservationDetailsRepo) Get(ctx context.Context, reservationID string) (domain.ReservationDetails, error) {
+	return r.docs.get(ctx, reservationID)
+}
+
+// GetByGroup returns the reservations booked together, in the order of booking.
+func (r *RedisReservationDetailsRepo) GetByGroup(ctx context.Context, groupID string) ([]domain.ReservationDetails, error) {
+	group, err := r.docs.list(ctx, "group", groupID)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		group = make([]domain.ReservationDetails, 0)
+	}
+	sort.Slice(group, func(i, j int) bool { return group[i].CreatedAt.Before(group[j].CreatedAt) })
+	return group, nil
+}
+
+func (r *RedisReservationDetailsRepo) Delete(ctx context.Context, reservationID string) error {
+	return r.docs.delete(ctx, reservationID)
+}
+
+func (r *RedisReservationDetailsRepo) DeleteByUser(ctx context.Context, userID string) error {
+	return r.docs.deleteBy(ctx, "user", userID)
+}
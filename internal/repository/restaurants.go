@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"reservista.kz/internal/domain"
+	"sync"
+)
+
+type RestaurantSettingsRepo struct {
+	mu       sync.RWMutex
+	settings map[string]domain.RestaurantSettings
+}
+
+func NewRestaurantSettingsRepo() *RestaurantSettingsRepo {
+	return &RestaurantSettingsRepo{settings: make(map[string]domain.RestaurantSettings)}
+}
+
+func (r *RestaurantSettingsRepo) Save(_ context.Context, settings domain.RestaurantSettings) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.settings[settings.RestaurantID] = settings
+	return nil
+}
+
+func (r *RestaurantSettingsRepo) Get(_ context.Context, restaurantID string) (domain.RestaurantSettings, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	settings, ok := r.settings[restaurantID]
+	if !ok {
+		return domain.RestaurantSettings{}, domain.ErrNotFound
+	}
+	return settings, nil
+}
+
+// RedisRestaurantSettingsRepo keeps the settings of the restaurants in redis, the
+// restaurant service has no place for them.
+type RedisRestaurantSettingsRepo struct {
+	docs *redisDocuments[domain.RestaurantSettings]
+}
+
+func NewRedisRestaurantSettingsRepo(client redis.UniversalClient, prefix string) *RedisRestaurantSettingsRepo {
+	return &RedisRestaurantSettingsRepo{docs: &redisDocuments[domain.RestaurantSettings]{client: client, prefix: prefix}}
+}
+
+func (r *RedisRestaurantSettingsRepo) Save(ctx context.Context, settings domain.RestaurantSettings) error {
+	return r.docs.put(ctx, settings.RestaurantID, settings)
+}
+
+func (r *RedisRestaurantSettingsRepo) Get(ctx context.Context, restaurantID string) (domain.RestaurantSettings, error) {
+	return r.docs.get(ctx, restaurantID)
+}
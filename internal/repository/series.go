@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"reservista.kz/internal/domain"
+	"sort"
+	"sync"
+)
+
+type SeriesRepo struct {
+	mu     sync.RWMutex
+	series map[string]domain.ReservationSeries
+}
+
+func NewSeriesRepo() *SeriesRepo {
+	return &SeriesRepo{series: make(map[string]domain.ReservationSeries)}
+}
+
+func (r *SeriesRepo) Save(_ context.Context, series domain.ReservationSeries) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	series.Occurrences = append([]domain.SeriesOccurrence(nil), series.Occurrences...)
+	r.series[series.ID] = series
+	return nil
+}
+
+func (r *SeriesRepo) Get(_ context.Context, id string) (domain.ReservationSeries, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	series, ok := r.series[id]
+	if !ok {
+		return domain.ReservationSeries{}, domain.ErrNotFound
+	}
+	series.Occurrences = append([]domain.SeriesOccurrence(nil), series.Occurrences...)
+	return series, nil
+}
+
+func (r *SeriesRepo) GetByUser(_ context.Context, userID string) ([]domain.ReservationSeries, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]domain.ReservationSeries, 0)
+	for _, series := range r.series {
+		if series.UserID == userID {
+			series.Occurrences = append([]domain.SeriesOccurrence(nil), series.Occurrences...)
+			list = append(list, series)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, nil
+}
+
+func (r *SeriesRepo) DeleteByUser(_ context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, series := range r.series {
+		if series.UserID == userID {
+			delete(r.series, id)
+		}
+	}
+	return nil
+}
+
+// RedisSeriesRepo keeps the series in redis. The reservation service only knows
+// the single reservations, so this is the only record of what belongs together.
+type RedisSeriesRepo struct {
+	docs *redisDocuments[domain.ReservationSeries]
+}
+
+func NewRedisSeriesRepo(client redis.UniversalClient, prefix string) *RedisSeriesRepo {
+	return &RedisSeriesRepo{docs: &redisDocuments[domain.ReservationSeries]{
+		client: client,
+		prefix: prefix,
+		indexes: map[string]func(domain.ReservationSeries) string{
+			"user": func(series domain.ReservationSeries) string { return series.UserID },
+		},
+	}}
+}
+
+func (r *RedisSeriesRepo) Save(ctx context.Context, series domain.ReservationSeries) error {
+	return r.docs.put(ctx, series.ID, series)
+}
+
+func (r *RedisSeriesRepo) Get(ctx context.Context, id string) (domain.ReservationSeries, error) {
+	return r.docs.get(ctx, id)
+}
+
+func (r *RedisSeriesRepo) GetByUser(ctx context.Context, userID string) ([]domain.ReservationSeries, error) {
+	list, err := r.docs.list(ctx, "user", userID)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = make([]domain.ReservationSeries, 0)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, nil
+}
+
+func (r *RedisSeriesRepo) DeleteByUser(ctx context.Context, userID string) error {
+	return r.docs.deleteBy(ctx, "user", userID)
+}
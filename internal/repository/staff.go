@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"reservista.kz/internal/domain"
+	"sort"
+	"sync"
+)
+
+type StaffRepo struct {
+	mu      sync.RWMutex
+	members map[string]domain.StaffMember
+}
+
+func NewStaffRepo() *StaffRepo {
+	return &StaffRepo{members: make(map[string]domain.StaffMember)}
+}
+
+func staffKey(restaurantID, userID string) string {
+	return restaurantID + "|" + userID
+}
+
+// Add creates the membership or replaces the role of an existing one.
+func (r *StaffRepo) Add(_ context.Context, member domain.StaffMember) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.members[staffKey(member.RestaurantID, member.UserID)] = member
+	return nil
+}
+
+func (r *StaffRepo) Get(_ context.Context, restaurantID, userID string) (domain.StaffMember, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	member, ok := r.members[staffKey(restaurantID, userID)]
+	if !ok {
+		return domain.StaffMember{}, domain.ErrNotFound
+	}
+	return member, nil
+}
+
+func (r *StaffRepo) GetByRestaurant(_ context.Context, restaurantID string) ([]domain.StaffMember, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	members := make([]domain.StaffMember, 0)
+	for _, member := range r.members {
+		if member.RestaurantID == restaurantID {
+			members = append(members, member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].CreatedAt.Before(members[j].CreatedAt) })
+	return members, nil
+}
+
+func (r *StaffRepo) GetByUser(_ context.Context, userID string) ([]domain.StaffMember, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	members := make([]domain.StaffMember, 0)
+	for _, member := range r.members {
+		if member.UserID == userID {
+			members = append(members, member)
+		}
+	}
+	return members, nil
+}
+
+func (r *StaffRepo) Remove(_ context.Context, restaurantID, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := staffKey(restaurantID, userID)
+	if _, ok := r.members[key]; !ok {
+		return domain.ErrNotFound
+	}
+	delete(r.members, key)
+	return nil
+}
+
+// RedisStaffRepo keeps the memberships in redis. Every ownership check relies on
+// them, so staff would be locked out of their restaurants after a restart
+// otherwise.
+type RedisStaffRepo struct {
+	docs *redisDocuments[domain.StaffMember]
+}
+
+func NewRedisStaffRepo(client redis.UniversalClient, prefix string) *RedisStaffRepo {
+	return &RedisStaffRepo{docs: &redisDocuments[domain.StaffMember]{
+		client: client,
+		prefix: prefix,
+		indexes: map[string]func(domain.StaffMember) string{
+			"restaurant": func(member domain.StaffMember) string { return member.RestaurantID },
+			"user":       func(member domain.StaffMember) string { return member.UserID },
+		},
+	}}
+}
+
+func (r *RedisStaffRepo) Add(ctx context.Context, member domain.StaffMember) error {
+	return r.docs.put(ctx, staffKey(member.RestaurantID, member.UserID), member)
+}
+
+func (r *RedisStaffRepo) Get(ctx context.Context, restaurantID, userID string) (domain.StaffMember, error) {
+	return r.docs.get(ctx, staffKey(restaurantID, userID))
+}
+
+func (r *RedisStaffRepo) GetByRestaurant(ctx context.Context, restaurantID string) ([]domain.StaffMember, error) {
+	members, err := r.docs.list(ctx, "restaurant", restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	if members == nil {
+		members = make([]domain.StaffMember, 0)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].CreatedAt.Before(members[j].CreatedAt) })
+	return members, nil
+}
+
+func (r *RedisStaffRepo) GetByUser(ctx context.Context, userID string) ([]domain.StaffMember, error) {
+	members, err := r.docs.list(ctx, "user", userID)
+	if members == nil && err == nil {
+		members = make([]domain.StaffMember, 0)
+	}
+	return members, err
+}
+
+func (r *RedisStaffRepo) Remove(ctx context.Context, restaurantID, userID string) error {
+	key := staffKey(restaurantID, userID)
+	if _, err := r.docs.get(ctx, key); err != nil {
+		return err
+	}
+	return r.docs.delete(ctx, key)
+}
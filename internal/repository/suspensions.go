@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"reservista.kz/internal/domain"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SuspensionsRepo keeps every suspension, GetByUser returns the latest one.
+type SuspensionsRepo struct {
+	mu          sync.RWMutex
+	suspensions map[string]domain.Suspension
+	latest      map[string]string
+}
+
+func NewSuspensionsRepo() *SuspensionsRepo {
+	return &SuspensionsRepo{
+		suspensions: make(map[string]domain.Suspension),
+		latest:      make(map[string]string),
+	}
+}
+
+func (r *SuspensionsRepo) Save(_ context.Context, suspension domain.Suspension) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.suspensions[suspension.ID]; !ok {
+		r.latest[suspension.UserID] = suspension.ID
+	}
+	r.suspensions[suspension.ID] = suspension
+	return nil
+}
+
+func (r *SuspensionsRepo) GetByUser(_ context.Context, userID string) (domain.Suspension, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.latest[userID]
+	if !ok {
+		return domain.Suspension{}, domain.ErrNotFound
+	}
+	return r.suspensions[id], nil
+}
+
+func (r *SuspensionsRepo) GetByAppealTokenHash(_ context.Context, tokenHash string) (domain.Suspension, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, suspension := range r.suspensions {
+		if suspension.AppealTokenHash == tokenHash {
+			return suspension, nil
+		}
+	}
+	return domain.Suspension{}, domain.ErrNotFound
+}
+
+// GetPendingAppeals returns the suspensions with an unanswered appeal, oldest
+// appeal first.
+func (r *SuspensionsRepo) GetPendingAppeals(_ context.Context) ([]domain.Suspension, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make([]domain.Suspension, 0)
+	for _, suspension := range r.suspensions {
+		if suspension.Appeal != nil && suspension.Appeal.Status == domain.AppealPending {
+			result = append(result, suspension)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Appeal.SubmittedAt.Before(result[j].Appeal.SubmittedAt)
+	})
+	return result, nil
+}
+
+// GetAwaitingRestore returns the suspensions that are over but whose account is
+// still deactivated.
+func (r *SuspensionsRepo) GetAwaitingRestore(_ context.Context, now time.Time) ([]domain.Suspension, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var result []domain.Suspension
+	for _, suspension := range r.suspensions {
+		if suspension.AwaitsRestore(now) {
+			result = append(result, suspension)
+		}
+	}
+	return result, nil
+}
+
+func (r *SuspensionsRepo) DeleteByUser(_ context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, suspension := range r.suspensions {
+		if suspension.UserID == userID {
+			delete(r.suspensions, id)
+		}
+	}
+	delete(r.latest, userID)
+	return nil
+}
+
+// storedSuspension is the redis document of a suspension, the appeal token hash
+// is left out of the JSON of domain.Suspension so it never reaches a response.
+type storedSuspension struct {
+	domain.Suspension
+	AppealTokenHash string `json:"appealTokenHash,omitempty"`
+}
+
+// RedisSuspensionsRepo keeps the suspensions in redis, so a suspended user stays
+// blocked across restarts. prefix+"latest:"+userID holds the id of the latest
+// suspension of a user.
+type RedisSuspensionsRepo struct {
+	client redis.UniversalClient
+	prefix string
+	docs   *redisDocuments[storedSuspension]
+}
+
+func NewRedisSuspensionsRepo(client redis.UniversalClient, prefix string) *RedisSuspensionsRepo {
+	return &RedisSuspensionsRepo{
+		client: client,
+		prefix: prefix,
+		docs: &redisDocuments[storedSuspension]{
+			client: client,
+			prefix: prefix,
+			indexes: map[string]func(storedSuspension) string{
+				"user":         func(s storedSuspension) string { return s.UserID },
+				"appeal_token": func(s storedSuspension) string { return s.AppealTokenHash },
+				"appeal_status": func(s storedSuspension) string {
+					if s.Appeal == nil {
+						return ""
+					}
+					return s.Appeal.Status
+				},
+				// deactivated accounts stay indexed until they are activated again
+				"restore": func(s storedSuspension) string {
+					if !s.Deactivated || s.RestoredAt != nil {
+						return ""
+					}
+					return "pending"
+				},
+			},
+		},
+	}
+}
+
+func (r *RedisSuspensionsRepo) Save(ctx context.Context, suspension domain.Suspension) error {
+	stored := storedSuspension{Suspension: suspension, AppealTokenHash: suspension.AppealTokenHash}
+	err := r.docs.create(ctx, suspension.ID, stored)
+	if errors.Is(err, domain.ErrAlreadyExists) {
+		return r.docs.put(ctx, suspension.ID, stored)
+	}
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, r.prefix+"latest:"+suspension.UserID, suspension.ID, 0).Err()
+}
+
+func (r *RedisSuspensionsRepo) GetByUser(ctx context.Context, userID string) (domain.Suspension, error) {
+	id, err := r.client.Get(ctx, r.prefix+"latest:"+userID).Result()
+	if errors.Is(err, redis.Nil) {
+		return domain.Suspension{}, domain.ErrNotFound
+	}
+	if err != nil {
+		return domain.Suspension{}, err
+	}
+	stored, err := r.docs.get(ctx, id)
+	if err != nil {
+		return domain.Suspension{}, err
+	}
+	return stored.restore(), nil
+}
+
+func (r *RedisSuspensionsRepo) GetByAppealTokenHash(ctx context.Context, tokenHash string) (domain.Suspension, error) {
+	if tokenHash == "" {
+		return domain.Suspension{}, domain.ErrNotFound
+	}
+	found, err := r.docs.list(ctx, "appeal_token", tokenHash)
+	if err != nil {
+		return domain.Suspension{}, err
+	}
+	if len(found) == 0 {
+		return domain.Suspension{}, domain.ErrNotFound
+	}
+	return found[0].restore(), nil
+}
+
+func (r *RedisSuspensionsRepo) GetPendingAppeals(ctx context.Context) ([]domain.Suspension, error) {
+	pending, err := r.docs.list(ctx, "appeal_status", domain.AppealPending)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]domain.Suspension, 0, len(pending))
+	for _, stored := range pending {
+		result = append(result, stored.restore())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Appeal.SubmittedAt.Before(result[j].Appeal.SubmittedAt)
+	})
+	return result, nil
+}
+
+func (r *RedisSuspensionsRepo) GetAwaitingRestore(ctx context.Context, now time.Time) ([]domain.Suspension, error) {
+	deactivated, err := r.docs.list(ctx, "restore", "pending")
+	if err != nil {
+		return nil, err
+	}
+	var result []domain.Suspension
+	for _, stored := range deactivated {
+		if stored.AwaitsRestore(now) {
+			result = append(result, stored.restore())
+		}
+	}
+	return result, nil
+}
+
+func (r *RedisSuspensionsRepo) DeleteByUser(ctx context.Context, userID string) error {
+	if err := r.docs.deleteBy(ctx, "user", userID); err != nil {
+		return err
+	}
+	return r.client.Del(ctx, r.prefix+"latest:"+userID).Err()
+}
+
+func (s storedSuspension) restore() domain.Suspension {
+	suspension := s.Suspension
+	suspension.AppealTokenHash = s.AppealTokenHash
+	return suspension
+}
@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"reservista.kz/internal/domain"
+	"sort"
+	"sync"
+)
+
+type WaitlistRepo struct {
+	mu      sync.RWMutex
+	entries map[string]domain.WaitlistEntry
+}
+
+func NewWaitlistRepo() *WaitlistRepo {
+	return &WaitlistRepo{entries: make(map[string]domain.WaitlistEntry)}
+}
+
+func (r *WaitlistRepo) Save(_ context.Context, entry domain.WaitlistEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[entry.ID] = entry
+	return nil
+}
+
+// CompareAndSave saves the entry only if the stored one is still in status, and
+// reports whether it did. Claims, expiry and leaving race for offered entries,
+// only one of them wins.
+func (r *WaitlistRepo) CompareAndSave(_ context.Context, entry domain.WaitlistEntry, status string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.entries[entry.ID]
+	if !ok {
+		return false, domain.ErrNotFound
+	}
+	if stored.Status != status {
+		return false, nil
+	}
+	r.entries[entry.ID] = entry
+	return true, nil
+}
+
+func (r *WaitlistRepo) Get(_ context.Context, id string) (domain.WaitlistEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entry, ok := r.entries[id]
+	if !ok {
+		return domain.WaitlistEntry{}, domain.ErrNotFound
+	}
+	return entry, nil
+}
+
+// GetByRestaurant returns the entries of a restaurant in the order they joined.
+func (r *WaitlistRepo) GetByRestaurant(_ context.Context, restaurantID string) ([]domain.WaitlistEntry, error) {
+	return r.filter(func(entry domain.WaitlistEntry) bool { return entry.RestaurantID == restaurantID }), nil
+}
+
+func (r *WaitlistRepo) GetByUser(_ context.Context, userID string) ([]domain.WaitlistEntry, error) {
+	return r.filter(func(entry domain.WaitlistEntry) bool { return entry.UserID == userID }), nil
+}
+
+func (r *WaitlistRepo) GetByStatus(_ context.Context, status string) ([]domain.WaitlistEntry, error) {
+	return r.filter(func(entry domain.WaitlistEntry) bool { return entry.Status == status }), nil
+}
+
+func (r *WaitlistRepo) GetByOfferTokenHash(_ context.Context, tokenHash string) (domain.WaitlistEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, entry := range r.entries {
+		if entry.Offer != nil && entry.Offer.TokenHash == tokenHash {
+			return entry, nil
+		}
+	}
+	return domain.WaitlistEntry{}, domain.ErrNotFound
+}
+
+func (r *WaitlistRepo) DeleteByUser(_ context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, entry := range r.entries {
+		if entry.UserID == userID {
+			delete(r.entries, id)
+		}
+	}
+	return nil
+}
+
+func (r *WaitlistRepo) filter(keep func(domain.WaitlistEntry) bool) []domain.WaitlistEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entries := make([]domain.WaitlistEntry, 0)
+	for _, entry := range r.entries {
+		if keep(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].CreatedAt.Before(entries[j].CreatedAt) })
+	return entries
+}
+
+// storedWaitlistEntry is the redis document of an entry, the token hash of the
+// offer is left out of the JSON of domain.WaitlistOffer so it never reaches a
+// response.
+type storedWaitlistEntry struct {
+	domain.WaitlistEntry
+	OfferTokenHash string `json:"offerTokenHash,omitempty"`
+}
+
+// RedisWaitlistRepo keeps the waitlist in redis, so guests keep their place and
+// mailed offers can still be claimed after a restart.
+type RedisWaitlistRepo struct {
+	docs *redisDocuments[storedWaitlistEntry]
+}
+
+func NewRedisWaitlistRepo(client redis.UniversalClient, prefix string) *RedisWaitlistRepo {
+	return &RedisWaitlistRepo{docs: &redisDocuments[storedWaitlistEntry]{
+		client: client,
+		prefix: prefix,
+		indexes: map[string]func(storedWaitlistEntry) string{
+			"restaurant": func(entry storedWaitlistEntry) string { return entry.RestaurantID },
+			"user":       func(entry storedWaitlistEntry) string { return entry.UserID },
+			"status":     func(entry storedWaitlistEntry) string { return entry.Status },
+			"offer":      func(entry storedWaitlistEntry) string { return entry.OfferTokenHash },
+		},
+	}}
+}
+
+func (r *RedisWaitlistRepo) Save(ctx context.Context, entry domain.WaitlistEntry) error {
+	return r.docs.put(ctx, entry.ID, storeWaitlistEntry(entry))
+}
+
+// CompareAndSave saves the entry only if the stored one is still in status, and
+// reports whether it did. The check and the write are one redis transaction, so
+// only one of the gateways racing for an offer wins.
+func (r *RedisWaitlistRepo) CompareAndSave(ctx context.Context, entry domain.WaitlistEntry, status string) (bool, error) {
+	return r.docs.compareAndPut(ctx, entry.ID, storeWaitlistEntry(entry), func(stored storedWaitlistEntry) bool {
+		return stored.Status == status
+	})
+}
+
+func (r *RedisWaitlistRepo) Get(ctx context.Context, id string) (domain.WaitlistEntry, error) {
+	stored, err := r.docs.get(ctx, id)
+	if err != nil {
+		return domain.WaitlistEntry{}, err
+	}
+	return stored.restore(), nil
+}
+
+// GetByRestaurant returns the entries of a restaurant in the order they joined.
+func (r *RedisWaitlistRepo) GetByRestaurant(ctx context.Context, restaurantID string) ([]domain.WaitlistEntry, error) {
+	return r.list(ctx, "restaurant", restaurantID)
+}
+
+func (r *RedisWaitlistRepo) GetByUser(ctx context.Context, userID string) ([]domain.WaitlistEntry, error) {
+	return r.list(ctx, "user", userID)
+}
+
+func (r *RedisWaitlistRepo) GetByStatus(ctx context.Context, status string) ([]domain.WaitlistEntry, error) {
+	return r.list(ctx, "status", status)
+}
+
+func (r *RedisWaitlistRepo) GetByOfferTokenHash(ctx context.Context, tokenHash string) (domain.WaitlistEntry, error) {
+	if tokenHash == "" {
+		return domain.WaitlistEntry{}, domain.ErrNotFound
+	}
+	found, err := r.list(ctx, "offer", tokenHash)
+	if err != nil {
+		return domain.WaitlistEntry{}, err
+	}
+	if len(found) == 0 {
+		return domain.WaitlistEntry{}, domain.ErrNotFound
+	}
+	return found[0], nil
+}
+
+func (r *RedisWaitlistRepo) DeleteByUser(ctx context.Context, userID string) error {
+	return r.docs.deleteBy(ctx, "user", userID)
+}
+
+func (r *RedisWaitlistRepo) list(ctx context.Context, index, value string) ([]domain.WaitlistEntry, error) {
+	stored, err := r.docs.list(ctx, index, value)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]domain.WaitlistEntry, len(stored))
+	for i, entry := range stored {
+		entries[i] = entry.restore()
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].CreatedAt.Before(entries[j].CreatedAt) })
+	return entries, nil
+}
+
+func storeWaitlistEntry(entry domain.WaitlistEntry) storedWaitlistEntry {
+	stored := storedWaitlistEntry{WaitlistEntry: entry}
+	if entry.Offer != nil {
+		stored.OfferTokenHash = entry.Offer.TokenHash
+	}
+	return stored
+}
+
+func (s storedWaitlistEntry) restore() domain.WaitlistEntry {
+	entry := s.WaitlistEntry
+	if entry.Offer != nil {
+		offer := *entry.Offer
+		offer.TokenHash = s.OfferTokenHash
+		entry.Offer = &offer
+	}
+	return entry
+}
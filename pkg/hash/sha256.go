@@ -0,0 +1,27 @@
+package hash
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+)
+
+// SHA256Hasher hashes high entropy secrets such as API keys with HMAC-SHA256,
+// where a slow password hash isn't needed.
+type SHA256Hasher struct {
+	salt string
+}
+
+func NewSHA256Hasher(salt string) *SHA256Hasher {
+	return &SHA256Hasher{salt: salt}
+}
+
+func (h *SHA256Hasher) Hash(secret string) (string, error) {
+	mac := hmac.New(sha256.New, []byte(h.salt))
+
+	if _, err := mac.Write([]byte(secret)); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", mac.Sum(nil)), nil
+}
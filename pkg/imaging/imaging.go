@@ -0,0 +1,100 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported image type, expected jpeg or png")
+	ErrTooLarge        = errors.New("image dimensions are too large")
+)
+
+// SupportedTypes are the content types Decode accepts.
+var SupportedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+}
+
+// Decode sniffs the content type of data instead of trusting the client and
+// refuses images with more than maxPixels pixels before decoding them.
+func Decode(data []byte, maxPixels int) (image.Image, error) {
+	if !SupportedTypes[http.DetectContentType(data)] {
+		return nil, ErrUnsupportedType
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// CropSquare cuts a size x size square at x, y. A size of 0 takes the largest
+// square in the center of the image.
+func CropSquare(img image.Image, x, y, size int) (image.Image, error) {
+	b := img.Bounds()
+	if size == 0 {
+		size = b.Dx()
+		if b.Dy() < size {
+			size = b.Dy()
+		}
+		x, y = (b.Dx()-size)/2, (b.Dy()-size)/2
+	}
+	rect := image.Rect(b.Min.X+x, b.Min.Y+y, b.Min.X+x+size, b.Min.Y+y+size)
+	if size <= 0 || x < 0 || y < 0 || !rect.In(b) {
+		return nil, errors.New("crop is outside of the image")
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for py := 0; py < size; py++ {
+		for px := 0; px < size; px++ {
+			dst.Set(px, py, img.At(rect.Min.X+px, rect.Min.Y+py))
+		}
+	}
+	return dst, nil
+}
+
+// Resize scales img to width x height by averaging the source pixels each target
+// pixel covers, which is good enough for downscaling photos.
+func Resize(img image.Image, width, height int) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := b.Min.Y + y*b.Dy()/height
+		y1 := b.Min.Y + (y+1)*b.Dy()/height
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < width; x++ {
+			x0 := b.Min.X + x*b.Dx()/width
+			x1 := b.Min.X + (x+1)*b.Dx()/width
+			if x1 == x0 {
+				x1++
+			}
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+// EncodeJPEG writes img as a JPEG, transparent parts end up black.
+func EncodeJPEG(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+}
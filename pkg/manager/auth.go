@@ -17,7 +17,9 @@ import (
 // TokenManager provides logic for JWT & Refresh tokens generation and parsing.
 type TokenManager interface {
 	NewAccessToken(string, time.Duration, []string, string, bool) (string, error)
+	NewImpersonationToken(userID, actorID, sessionID string, ttl time.Duration, roles []string, issuer string, activated bool) (string, error)
 	Parse(accessToken string) (string, []string, bool, error)
+	ParseClaims(accessToken string) (*CustomClaims, error)
 	NewRefreshToken() (string, error)
 	HexToObjectID(string) (primitive.ObjectID, error)
 	ParseActivationToken(string) (string, time.Time, error)
@@ -31,9 +33,16 @@ type CustomClaims struct {
 	UserID    string   `json:"user_id"`
 	Roles     []string `json:"roles"`
 	Activated bool     `json:"activated"`
+	// Actor is set on impersonation tokens and names who acts as UserID.
+	Actor *ActorClaim `json:"act,omitempty"`
 	jwt.StandardClaims
 }
 
+// ActorClaim is the "act" claim of RFC 8693.
+type ActorClaim struct {
+	Subject string `json:"sub"`
+}
+
 func NewManager(signingKey string) (*Manager, error) {
 	if signingKey == "" {
 		return nil, errors.New("empty signing key")
@@ -58,9 +67,38 @@ func (m *Manager) NewAccessToken(userID string, ttl time.Duration, roles []strin
 	return token.SignedString([]byte(m.signingKey))
 }
 
+// NewImpersonationToken issues an access token of userID on behalf of actorID. The
+// session id goes to the jti claim so the impersonation can be ended before it expires.
+func (m *Manager) NewImpersonationToken(userID, actorID, sessionID string, ttl time.Duration, roles []string, issuer string, activated bool) (string, error) {
+	claims := CustomClaims{
+		UserID:    userID,
+		Roles:     roles,
+		Activated: activated,
+		Actor:     &ActorClaim{Subject: actorID},
+		StandardClaims: jwt.StandardClaims{
+			Id:        sessionID,
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+			Issuer:    issuer,
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	return token.SignedString([]byte(m.signingKey))
+}
+
 // Parse taking from the payload of JWT user id and returns it in string format. Token is still returned
 // in both cases, if it is expired or not.
 func (m *Manager) Parse(accessToken string) (string, []string, bool, error) {
+	claims, err := m.ParseClaims(accessToken)
+	if claims == nil {
+		return "", nil, false, err
+	}
+	return claims.UserID, claims.Roles, claims.Activated, err
+}
+
+// ParseClaims works like Parse but returns every claim of the token.
+func (m *Manager) ParseClaims(accessToken string) (*CustomClaims, error) {
 	token, err := jwt.ParseWithClaims(accessToken, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -73,16 +111,16 @@ func (m *Manager) Parse(accessToken string) (string, []string, bool, error) {
 		if errors.As(err, &validationError) && validationError.Errors&jwt.ValidationErrorExpired != 0 {
 			err = errors.New("token is expired")
 		} else {
-			return "", nil, false, err
+			return nil, err
 		}
 	}
 
 	claims, ok := token.Claims.(*CustomClaims)
 	if !ok {
-		return "", nil, false, fmt.Errorf("error getting user claims from token")
+		return nil, fmt.Errorf("error getting user claims from token")
 	}
 
-	return claims.UserID, claims.Roles, claims.Activated, err
+	return claims, err
 }
 
 func (m *Manager) NewRefreshToken() (string, error) {
@@ -0,0 +1,224 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockProvider is a local OIDC issuer. It hands out one code per authorization
+// request and signs the id tokens of the code's request with the key of kid.
+type mockProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+
+	mu          sync.Mutex
+	codes       map[string]url.Values
+	jwksFetches int
+	claims      jwt.MapClaims
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockProvider{t: t, key: key, kid: "key-1", codes: make(map[string]url.Values)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(discoveryDocument{
+			Issuer:                m.server.URL,
+			AuthorizationEndpoint: m.server.URL + "/authorize",
+			TokenEndpoint:         m.server.URL + "/token",
+			JWKSURI:               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		m.jwksFetches++
+		kid := m.kid
+		m.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string][]jsonWebKey{"keys": {{
+			Kid: kid,
+			Kty: "RSA",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", m.token)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+// authorize plays the user consenting at the provider and returns the code the
+// provider redirects back with.
+func (m *mockProvider) authorize(authURL string) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code := "code-" + u.Query().Get("state")
+	m.codes[code] = u.Query()
+	return code
+}
+
+func (m *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m.mu.Lock()
+	request, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	claims, kid := m.claims, m.kid
+	m.mu.Unlock()
+	if !ok || CodeChallenge(r.PostForm.Get("code_verifier")) != request.Get("code_challenge") {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(tokenResponse{Error: "invalid_grant"})
+		return
+	}
+	idClaims := jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            request.Get("client_id"),
+		"sub":            "subject-1",
+		"email":          "guest@example.com",
+		"email_verified": true,
+		"given_name":     "Aigerim",
+		"nonce":          request.Get("nonce"),
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	}
+	for name, value := range claims {
+		idClaims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, idClaims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(m.key)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	json.NewEncoder(w).Encode(tokenResponse{AccessToken: "access", IDToken: signed, TokenType: "Bearer"})
+}
+
+func (m *mockProvider) rotateKey(kid string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.kid = kid
+}
+
+func (m *mockProvider) fetches() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.jwksFetches
+}
+
+func (m *mockProvider) provider() *GenericProvider {
+	return NewProvider("mock", Config{
+		Issuer:      m.server.URL,
+		ClientID:    "gateway",
+		RedirectURL: "http://localhost:8000/api/auth/oidc/mock/callback",
+	})
+}
+
+// login runs the authorization code flow against the mock provider.
+func login(t *testing.T, m *mockProvider, p *GenericProvider, nonce string) (*Identity, error) {
+	verifier, err := RandomString(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL := p.AuthCodeURL("state-"+verifier, "nonce", CodeChallenge(verifier))
+	if authURL == "" {
+		t.Fatal("AuthCodeURL returned no URL")
+	}
+	return p.Exchange(context.Background(), m.authorize(authURL), verifier, nonce)
+}
+
+func TestProviderExchange(t *testing.T) {
+	m := newMockProvider(t)
+	identity, err := login(t, m, m.provider(), "nonce")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	want := Identity{Provider: "mock", Subject: "subject-1", Email: "guest@example.com", EmailVerified: true, GivenName: "Aigerim"}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestProviderRejectsInvalidTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		nonce  string
+		want   error
+	}{
+		{name: "nonce mismatch", nonce: "other", want: ErrNonceMismatch},
+		{name: "foreign audience", claims: jwt.MapClaims{"aud": "someone-else"}, nonce: "nonce", want: ErrInvalidIDToken},
+		{name: "foreign issuer", claims: jwt.MapClaims{"iss": "https://evil.example"}, nonce: "nonce", want: ErrInvalidIDToken},
+		{name: "expired", claims: jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}, nonce: "nonce", want: ErrInvalidIDToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockProvider(t)
+			m.claims = tt.claims
+			_, err := login(t, m, m.provider(), tt.nonce)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Exchange error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestProviderRejectsWrongVerifier(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider()
+	authURL := p.AuthCodeURL("state", "nonce", CodeChallenge("verifier"))
+	if _, err := p.Exchange(context.Background(), m.authorize(authURL), "another verifier", "nonce"); err == nil {
+		t.Error("Exchange succeeded with a verifier that doesn't match the challenge")
+	}
+}
+
+func TestKeySetRefetchIsRateLimited(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider()
+	if _, err := login(t, m, p, "nonce"); err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	// the provider rotates its key, tokens with the new kid are rejected until
+	// the refresh interval has passed
+	m.rotateKey("key-2")
+	for i := 0; i < 3; i++ {
+		if _, err := login(t, m, p, "nonce"); !errors.Is(err, ErrInvalidIDToken) {
+			t.Fatalf("Exchange with an unknown kid = %v, want %v", err, ErrInvalidIDToken)
+		}
+	}
+	if n := m.fetches(); n != 1 {
+		t.Errorf("jwks fetched %d times, want 1", n)
+	}
+
+	p.keys.fetchedAt = time.Now().Add(-jwksRefreshInterval)
+	if _, err := login(t, m, p, "nonce"); err != nil {
+		t.Fatalf("Exchange after the refresh interval: %v", err)
+	}
+	if n := m.fetches(); n != 2 {
+		t.Errorf("jwks fetched %d times, want 2", n)
+	}
+}
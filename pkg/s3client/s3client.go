@@ -6,12 +6,15 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"io"
 	"mime/multipart"
 )
 
 type S3Client struct {
 	uploader *s3manager.Uploader
+	svc      *s3.S3
 	bucket   string
 }
 
@@ -26,6 +29,7 @@ func NewS3Client(region, httpAddress, accessKey, privateKey, bucket string) *S3C
 
 	return &S3Client{
 		uploader: uploader,
+		svc:      s3.New(sess),
 		bucket:   bucket,
 	}
 }
@@ -47,3 +51,25 @@ func (s *S3Client) UploadFile(ctx context.Context, file multipart.File, fileHead
 	}
 	return result.Location, nil
 }
+
+// Upload stores body under key and returns its URL.
+func (s *S3Client) Upload(ctx context.Context, key, contentType string, body io.Reader) (string, error) {
+	result, err := s.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", err
+	}
+	return result.Location, nil
+}
+
+func (s *S3Client) Delete(ctx context.Context, key string) error {
+	_, err := s.svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}